@@ -6,10 +6,13 @@ import (
 	"CapIot.influxDB/internal/repository"
 	"CapIot.influxDB/internal/routes"
 	"CapIot.influxDB/internal/service"
+	"context"
 	"fmt"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
+	"time"
+	_ "time/tzdata" // The runtime image has no zoneinfo database
 )
 
 func enableCORS(next http.Handler) http.Handler {
@@ -36,14 +39,39 @@ func main() {
 
 	// Initialize repo, service, controller
 	repo := repository.NewInfluxDBRepository(cfg.InfluxDBURL, cfg.InfluxDBToken, cfg.InfluxDBOrg)
-	svc := service.NewDataService(repo)
+	units := service.NewUnitRegistry(cfg.FieldUnits)
+	quality := service.NewQualityMonitor(cfg.QualityWindow, cfg.FieldLimits, cfg.FieldMaxRates)
+	alerts := service.NewAlertService(repo)
+	if err := alerts.LoadRules(context.Background()); err != nil {
+		log.Printf("Alert rules not loaded: %v", err)
+	}
+	alerts.Start(context.Background(), cfg.AlertCheckInterval)
+	notifications := service.NewNotificationService(repo, service.NewWebhookClient(10*time.Second), cfg.NotifyMaxAttempts, cfg.NotifyBackoff)
+	if err := notifications.Load(context.Background()); err != nil {
+		log.Printf("Webhooks not loaded: %v", err)
+	}
+	alerts.Subscribe(notifications.Notify)
+	timezones := service.NewTimezoneRegistry(cfg.DefaultTimezone, cfg.LocationTimezones)
+	carbon := service.NewCarbonIntensityRegistry(cfg.CarbonIntensity, cfg.LocationCountries, cfg.DefaultCountry, cfg.CarbonIntensityBucket)
+	degreeDays := service.NewDegreeDayRegistry(cfg.OutdoorTemperatureSensors, cfg.HeatingBaseTemperature, cfg.CoolingBaseTemperature)
+	svc := service.NewDataService(repo, units, quality, alerts, timezones, carbon, degreeDays, cfg.HeartbeatTimeout, cfg.LocationConsumptionDevices)
+	if err := svc.LoadCalibrations(context.Background()); err != nil {
+		log.Printf("Calibration profiles not loaded, values are written uncalibrated: %v", err)
+	}
+	if err := svc.LoadVirtualSensors(context.Background()); err != nil {
+		log.Printf("Virtual sensors not loaded: %v", err)
+	}
+	if err := svc.WarmLatestCache(context.Background()); err != nil {
+		log.Printf("Latest value cache not warmed, values are loaded on first request: %v", err)
+	}
 	ctrl := controller.NewDataController(svc)
+	alertCtrl := controller.NewAlertController(alerts, notifications)
 
 	// Initialize the mux.Router
 	router := mux.NewRouter()
 
 	// Register all routes with the mux.Router
-	routes.RegisterRoutes(router, ctrl)
+	routes.RegisterRoutes(router, ctrl, alertCtrl)
 
 	// Wrap the mux.Router with the CORS middleware
 	corsHandler := enableCORS(router)
@@ -1,10 +1,14 @@
 package config
 
 import (
+	"CapIot.influxDB/internal/models"
 	"fmt"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds the application's configuration.
@@ -15,6 +19,43 @@ type Config struct {
 	DefaultLocation string
 	Port            string
 	ApiURL          string
+	// FieldUnits overrides or extends the canonical unit of each field (field -> unit symbol).
+	FieldUnits map[string]string
+	// QualityWindow is the number of identical consecutive values after which a series is flagged as stuck.
+	QualityWindow int
+	// FieldLimits overrides the physically possible range of each field (field -> range).
+	FieldLimits map[string]models.ValueRange
+	// FieldMaxRates overrides the largest plausible rate of change of each field, in units per second.
+	FieldMaxRates map[string]float64
+	// AlertCheckInterval is how often the missing_data alert rules are checked.
+	AlertCheckInterval time.Duration
+	// NotifyMaxAttempts is the number of delivery attempts of a webhook notification before it is dead-lettered.
+	NotifyMaxAttempts int
+	// NotifyBackoff is the wait after the first failed delivery attempt, doubled after each further failure.
+	NotifyBackoff time.Duration
+	// HeartbeatTimeout is the silence after which a device is considered offline in availability reports.
+	HeartbeatTimeout time.Duration
+	// DefaultTimezone is the IANA timezone calendar windows align to when neither the request nor the location sets one.
+	DefaultTimezone string
+	// LocationTimezones sets the IANA timezone of each location (location -> timezone).
+	LocationTimezones map[string]string
+	// CarbonIntensity is the static grid carbon intensity of each country, in gCO2e/kWh (country -> intensity).
+	CarbonIntensity map[string]float64
+	// LocationCountries sets the grid country of each location (location -> country).
+	LocationCountries map[string]string
+	// DefaultCountry is the grid country of the locations without one.
+	DefaultCountry string
+	// CarbonIntensityBucket holds the time-varying carbon intensity series.
+	CarbonIntensityBucket string
+	// OutdoorTemperatureSensors sets the outdoor temperature sensor of each location (location -> device[:field]).
+	OutdoorTemperatureSensors map[string]string
+	// LocationConsumptionDevices lists the consumption devices of each location (location -> devices), consumption
+	// data carrying no location.
+	LocationConsumptionDevices map[string][]string
+	// HeatingBaseTemperature is the default base temperature of heating degree-days, in °C.
+	HeatingBaseTemperature float64
+	// CoolingBaseTemperature is the default base temperature of cooling degree-days, in °C.
+	CoolingBaseTemperature float64
 }
 
 // LoadConfig loads the configuration from environment variables.
@@ -26,15 +67,143 @@ func LoadConfig() (Config, error) {
 	}
 
 	cfg := Config{
-		InfluxDBURL:     os.Getenv("INFLUXDB_URL"),
-		InfluxDBToken:   os.Getenv("INFLUXDB_TOKEN"),
-		InfluxDBOrg:     os.Getenv("INFLUXDB_ORG"),
-		DefaultLocation: "default_location", // Could also come from an env var
-		ApiURL:          os.Getenv("API_URL"),
-		Port:            "8000", // Make this configurable
+		InfluxDBURL:               os.Getenv("INFLUXDB_URL"),
+		InfluxDBToken:             os.Getenv("INFLUXDB_TOKEN"),
+		InfluxDBOrg:               os.Getenv("INFLUXDB_ORG"),
+		DefaultLocation:           "default_location", // Could also come from an env var
+		ApiURL:                    os.Getenv("API_URL"),
+		Port:                      "8000", // Make this configurable
+		FieldUnits:                parseKeyValueList(os.Getenv("FIELD_UNITS")),
+		QualityWindow:             12,
+		FieldLimits:               make(map[string]models.ValueRange),
+		FieldMaxRates:             make(map[string]float64),
+		AlertCheckInterval:        30 * time.Second,
+		NotifyMaxAttempts:         5,
+		NotifyBackoff:             time.Second,
+		HeartbeatTimeout:          30 * time.Second,
+		DefaultTimezone:           "UTC",
+		LocationTimezones:         parseKeyValueList(os.Getenv("LOCATION_TIMEZONES")),
+		CarbonIntensity:           make(map[string]float64),
+		LocationCountries:         parseKeyValueList(os.Getenv("LOCATION_COUNTRIES")),
+		DefaultCountry:            os.Getenv("DEFAULT_COUNTRY"),
+		CarbonIntensityBucket:     "carbon_intensity",
+		OutdoorTemperatureSensors: parseKeyValueList(os.Getenv("OUTDOOR_TEMPERATURE_SENSORS")),
+		HeatingBaseTemperature:    18,
+		CoolingBaseTemperature:    22,
+	}
+	if raw := os.Getenv("QUALITY_WINDOW"); raw != "" {
+		window, err := strconv.Atoi(raw)
+		if err != nil || window < 2 {
+			return Config{}, fmt.Errorf("invalid QUALITY_WINDOW '%s': must be an integer >= 2", raw)
+		}
+		cfg.QualityWindow = window
+	}
+	if raw := os.Getenv("ALERT_CHECK_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			return Config{}, fmt.Errorf("invalid ALERT_CHECK_INTERVAL '%s': must be a positive duration", raw)
+		}
+		cfg.AlertCheckInterval = interval
+	}
+	if raw := os.Getenv("NOTIFY_MAX_ATTEMPTS"); raw != "" {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil || attempts < 1 {
+			return Config{}, fmt.Errorf("invalid NOTIFY_MAX_ATTEMPTS '%s': must be an integer >= 1", raw)
+		}
+		cfg.NotifyMaxAttempts = attempts
+	}
+	if raw := os.Getenv("NOTIFY_BACKOFF"); raw != "" {
+		backoff, err := time.ParseDuration(raw)
+		if err != nil || backoff <= 0 {
+			return Config{}, fmt.Errorf("invalid NOTIFY_BACKOFF '%s': must be a positive duration", raw)
+		}
+		cfg.NotifyBackoff = backoff
+	}
+	if raw := os.Getenv("HEARTBEAT_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			return Config{}, fmt.Errorf("invalid HEARTBEAT_TIMEOUT '%s': must be a positive duration", raw)
+		}
+		cfg.HeartbeatTimeout = timeout
+	}
+	if raw := os.Getenv("DEFAULT_TIMEZONE"); raw != "" {
+		cfg.DefaultTimezone = raw
+	}
+	if _, err := models.LoadTimezone(cfg.DefaultTimezone); err != nil {
+		return Config{}, fmt.Errorf("invalid DEFAULT_TIMEZONE '%s': %w", cfg.DefaultTimezone, err)
+	}
+	for location, zone := range cfg.LocationTimezones {
+		if _, err := models.LoadTimezone(zone); err != nil {
+			return Config{}, fmt.Errorf("invalid LOCATION_TIMEZONES entry '%s=%s': %w", location, zone, err)
+		}
+	}
+	for field, raw := range parseKeyValueList(os.Getenv("FIELD_LIMITS")) {
+		minRaw, maxRaw, ok := strings.Cut(raw, ":")
+		min, errMin := strconv.ParseFloat(minRaw, 64)
+		max, errMax := strconv.ParseFloat(maxRaw, 64)
+		if !ok || errMin != nil || errMax != nil || min > max {
+			return Config{}, fmt.Errorf("invalid FIELD_LIMITS entry '%s=%s': expected field=min:max", field, raw)
+		}
+		cfg.FieldLimits[field] = models.ValueRange{Min: min, Max: max}
+	}
+	for field, raw := range parseKeyValueList(os.Getenv("FIELD_MAX_RATE")) {
+		rate, err := strconv.ParseFloat(raw, 64)
+		if err != nil || rate <= 0 {
+			return Config{}, fmt.Errorf("invalid FIELD_MAX_RATE entry '%s=%s': expected a positive number", field, raw)
+		}
+		cfg.FieldMaxRates[field] = rate
+	}
+	for country, raw := range parseKeyValueList(os.Getenv("CARBON_INTENSITY")) {
+		intensity, err := strconv.ParseFloat(raw, 64)
+		if err != nil || intensity < 0 {
+			return Config{}, fmt.Errorf("invalid CARBON_INTENSITY entry '%s=%s': expected a non-negative number of gCO2e/kWh", country, raw)
+		}
+		cfg.CarbonIntensity[country] = intensity
+	}
+	if raw := os.Getenv("CARBON_INTENSITY_BUCKET"); raw != "" {
+		cfg.CarbonIntensityBucket = raw
+	}
+	for name, target := range map[string]*float64{"HEATING_BASE_TEMPERATURE": &cfg.HeatingBaseTemperature, "COOLING_BASE_TEMPERATURE": &cfg.CoolingBaseTemperature} {
+		if raw := os.Getenv(name); raw != "" {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return Config{}, fmt.Errorf("invalid %s '%s': must be a number of °C", name, raw)
+			}
+			*target = value
+		}
+	}
+	cfg.LocationConsumptionDevices = make(map[string][]string)
+	for location, raw := range parseKeyValueList(os.Getenv("LOCATION_CONSUMPTION_DEVICES")) {
+		for _, deviceID := range strings.Split(raw, "|") {
+			if deviceID = strings.TrimSpace(deviceID); deviceID != "" {
+				cfg.LocationConsumptionDevices[location] = append(cfg.LocationConsumptionDevices[location], deviceID)
+			}
+		}
+	}
+	if cfg.HeatingBaseTemperature > cfg.CoolingBaseTemperature {
+		return Config{}, fmt.Errorf("invalid HEATING_BASE_TEMPERATURE %g: must not be greater than COOLING_BASE_TEMPERATURE %g", cfg.HeatingBaseTemperature, cfg.CoolingBaseTemperature)
 	}
 	if cfg.InfluxDBURL == "" || cfg.InfluxDBToken == "" || cfg.InfluxDBOrg == "" {
 		return Config{}, fmt.Errorf("InfluxDB configuration is incomplete. Please set INFLUXDB_URL, INFLUXDB_TOKEN, and INFLUXDB_ORG environment variables")
 	}
 	return cfg, nil
 }
+
+// parseKeyValueList parses a comma-separated list of key=value pairs, e.g. "pressure=hPa,co2=ppm".
+// Malformed entries are logged and skipped.
+func parseKeyValueList(raw string) map[string]string {
+	values := make(map[string]string)
+	if strings.TrimSpace(raw) == "" {
+		return values
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			log.Printf("Ignoring malformed configuration entry '%s'", pair)
+			continue
+		}
+		values[key] = value
+	}
+	return values
+}
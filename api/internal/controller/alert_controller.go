@@ -0,0 +1,259 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/middleware"
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/service"
+	"CapIot.influxDB/internal/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+// AlertController handles HTTP requests for alert rules, alert history and alert notifications.
+type AlertController struct {
+	service       *service.AlertService
+	notifications *service.NotificationService
+}
+
+// NewAlertController creates a new AlertController.
+func NewAlertController(service *service.AlertService, notifications *service.NotificationService) *AlertController {
+	return &AlertController{
+		service:       service,
+		notifications: notifications,
+	}
+}
+
+// HandleListRules returns the alert rules of a location.
+func (c *AlertController) HandleListRules(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, c.service.ListRules(mux.Vars(r)["locationID"]))
+}
+
+// HandleGetRule returns one alert rule of a location.
+func (c *AlertController) HandleGetRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	rule, err := c.service.GetRule(vars["locationID"], vars["ruleID"])
+	if err != nil {
+		respondWithServiceError(w, err, "Error fetching alert rule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, rule)
+}
+
+// HandleCreateRule creates an alert rule for a location.
+func (c *AlertController) HandleCreateRule(w http.ResponseWriter, r *http.Request) {
+	var rule models.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeBadRequest, "Invalid request payload", err.Error(), http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	if !authorizeRuleDevice(w, r, mux.Vars(r)["locationID"], rule) {
+		return
+	}
+
+	created, err := c.service.CreateRule(r.Context(), mux.Vars(r)["locationID"], rule)
+	if err != nil {
+		respondWithServiceError(w, err, "Error creating alert rule")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+// HandleUpdateRule replaces an alert rule of a location.
+func (c *AlertController) HandleUpdateRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var rule models.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeBadRequest, "Invalid request payload", err.Error(), http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	if !authorizeRuleDevice(w, r, vars["locationID"], rule) {
+		return
+	}
+
+	updated, err := c.service.UpdateRule(r.Context(), vars["locationID"], vars["ruleID"], rule)
+	if err != nil {
+		respondWithServiceError(w, err, "Error updating alert rule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// authorizeRuleDevice checks the rights of the user on the device a rule watches: on the device of the location for
+// sensor rules, on the device alone for consumption rules, which are not scoped by location.
+func authorizeRuleDevice(w http.ResponseWriter, r *http.Request, locationID string, rule models.AlertRule) bool {
+	if rule.DeviceID == "" {
+		return true
+	}
+	if rule.Source == models.SourceConsumption {
+		locationID = ""
+	}
+	return authorizeDevices(w, r, locationID, []string{rule.DeviceID})
+}
+
+// HandleDeleteRule deletes an alert rule of a location.
+func (c *AlertController) HandleDeleteRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := c.service.DeleteRule(r.Context(), vars["locationID"], vars["ruleID"]); err != nil {
+		respondWithServiceError(w, err, "Error deleting alert rule")
+		return
+	}
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleAlertHistory returns the alert events of a location, most recent first.
+func (c *AlertController) HandleAlertHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := models.AlertHistoryRequest{
+		LocationID:     mux.Vars(r)["locationID"],
+		DeviceID:       query.Get("device_id"),
+		RuleID:         query.Get("rule_id"),
+		State:          query.Get("state"),
+		TimeRangeStart: query.Get("time_range_start"),
+		TimeRangeStop:  query.Get("time_range_stop"),
+	}
+	if req.DeviceID != "" && !authorizeDevices(w, r, req.LocationID, []string{req.DeviceID}) {
+		return
+	}
+
+	events, err := c.service.GetAlertHistory(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error fetching alert history")
+		return
+	}
+	if req.DeviceID == "" {
+		var ok bool
+		if events, ok = permittedAlertEvents(w, r, req.LocationID, events); !ok {
+			return
+		}
+	}
+	respondWithJSON(w, http.StatusOK, events)
+}
+
+// permittedAlertEvents keeps the alert events of the devices of the location the user may access. It responds with
+// the error and returns false when the rights cannot be checked.
+func permittedAlertEvents(w http.ResponseWriter, r *http.Request, locationID string, events []models.AlertEvent) ([]models.AlertEvent, bool) {
+	var deviceIDs []string
+	seen := make(map[string]bool)
+	for _, event := range events {
+		if !seen[event.DeviceID] {
+			seen[event.DeviceID] = true
+			deviceIDs = append(deviceIDs, event.DeviceID)
+		}
+	}
+
+	allowed, err := middleware.CheckUserRightsForEach(r.Header.Get("Authorization"), deviceIDs, locationID)
+	if err != nil {
+		log.Printf("Error checking device rights: %v", err)
+		utils.RespondWithError(w, models.NewAPIError(models.ErrorCodeInternalServerError, "Error checking device rights", nil, http.StatusInternalServerError))
+		return nil, false
+	}
+	permitted := make(map[string]bool, len(deviceIDs))
+	for i, deviceID := range deviceIDs {
+		permitted[deviceID] = allowed[i]
+	}
+
+	filtered := []models.AlertEvent{}
+	for _, event := range events {
+		if permitted[event.DeviceID] {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered, true
+}
+
+// HandleListWebhooks returns the webhooks of a location.
+func (c *AlertController) HandleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, c.notifications.ListWebhooks(mux.Vars(r)["locationID"]))
+}
+
+// HandleCreateWebhook creates a webhook for a location.
+func (c *AlertController) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeBadRequest, "Invalid request payload", err.Error(), http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+
+	created, err := c.notifications.CreateWebhook(r.Context(), mux.Vars(r)["locationID"], webhook)
+	if err != nil {
+		respondWithServiceError(w, err, "Error creating webhook")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+// HandleUpdateWebhook replaces a webhook of a location.
+func (c *AlertController) HandleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeBadRequest, "Invalid request payload", err.Error(), http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+
+	updated, err := c.notifications.UpdateWebhook(r.Context(), vars["locationID"], vars["webhookID"], webhook)
+	if err != nil {
+		respondWithServiceError(w, err, "Error updating webhook")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// HandleDeleteWebhook deletes a webhook of a location.
+func (c *AlertController) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := c.notifications.DeleteWebhook(r.Context(), vars["locationID"], vars["webhookID"]); err != nil {
+		respondWithServiceError(w, err, "Error deleting webhook")
+		return
+	}
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleTestWebhook sends a test notification to a webhook and reports the outcome.
+func (c *AlertController) HandleTestWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	result, err := c.notifications.TestWebhook(r.Context(), vars["locationID"], vars["webhookID"])
+	if err != nil {
+		respondWithServiceError(w, err, "Error sending test notification")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// HandleListDeadLetters returns the undelivered notifications of a location.
+func (c *AlertController) HandleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, c.notifications.ListDeadLetters(mux.Vars(r)["locationID"]))
+}
+
+// HandleRetryDeadLetter redelivers an undelivered notification in the background.
+func (c *AlertController) HandleRetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	result, err := c.notifications.RetryDeadLetter(r.Context(), vars["locationID"], vars["letterID"])
+	if err != nil {
+		respondWithServiceError(w, err, "Error retrying notification")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, result)
+}
+
+// HandleDeleteDeadLetter discards an undelivered notification.
+func (c *AlertController) HandleDeleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := c.notifications.DeleteDeadLetter(r.Context(), vars["locationID"], vars["letterID"]); err != nil {
+		respondWithServiceError(w, err, "Error deleting dead letter")
+		return
+	}
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
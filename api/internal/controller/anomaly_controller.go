@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"net/http"
+	"strconv"
+)
+
+// HandleSensorAnomalies returns the anomalous intervals of a sensor field over a time range.
+func (c *DataController) HandleSensorAnomalies(w http.ResponseWriter, r *http.Request) {
+	c.handleAnomalies(w, r, models.SourceSensor)
+}
+
+// HandleConsumptionAnomalies returns the anomalous intervals of a consumption metric over a time range.
+func (c *DataController) HandleConsumptionAnomalies(w http.ResponseWriter, r *http.Request) {
+	c.handleAnomalies(w, r, models.SourceConsumption)
+}
+
+// handleAnomalies parses an anomaly detection request of the given source.
+func (c *DataController) handleAnomalies(w http.ResponseWriter, r *http.Request, source string) {
+	query := r.URL.Query()
+	req := models.AnomalyRequest{
+		Source:         source,
+		LocationID:     query.Get("location_id"),
+		DeviceID:       query.Get("device_id"),
+		Field:          query.Get("field"),
+		TimeRangeStart: query.Get("time_range_start"),
+		TimeRangeStop:  query.Get("time_range_stop"),
+		WindowPeriod:   query.Get("window_period"),
+		Timezone:       query.Get("timezone"),
+		Unit:           query.Get("unit"),
+		Method:         query.Get("method"),
+		Seasonality:    query.Get("seasonality"),
+		Baseline:       query.Get("baseline"),
+	}
+
+	if raw := query.Get("threshold"); raw != "" {
+		threshold, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "threshold must be a number", nil, http.StatusBadRequest)
+			utils.RespondWithError(w, apiErr)
+			return
+		}
+		req.Threshold = &threshold
+	}
+	var err error
+	if req.RollingWindow, err = parseIntParam(query.Get("rolling_window")); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "rolling_window must be an integer", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	if req.IncludeScores, err = parseBoolParam(query.Get("include_scores")); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "include_scores must be a boolean", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+
+	// A virtual sensor field may read other devices than the one checked by the middleware
+	if source == models.SourceSensor && !c.authorizeVirtualInputs(w, r, req.LocationID, []string{req.DeviceID}, []string{req.Field}) {
+		return
+	}
+
+	anomalies, err := c.service.DetectAnomalies(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error detecting anomalies")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, anomalies)
+}
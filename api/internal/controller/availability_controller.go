@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// HandleHeartbeat handles the heartbeats published by a device.
+func (c *DataController) HandleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	c.handleDeviceEvent(w, r, models.DeviceEventHeartbeat)
+}
+
+// HandleDeviceStatus handles the status transitions published by a device.
+func (c *DataController) HandleDeviceStatus(w http.ResponseWriter, r *http.Request) {
+	c.handleDeviceEvent(w, r, models.DeviceEventStatus)
+}
+
+// handleDeviceEvent stores a device event of the given type.
+func (c *DataController) handleDeviceEvent(w http.ResponseWriter, r *http.Request, eventType string) {
+	vars := mux.Vars(r)
+
+	var event models.DeviceEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeBadRequest, fmt.Sprintf("error unmarshalling JSON: %v", err), nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+
+	if event.DeviceID == "" {
+		event.DeviceID = vars["deviceID"]
+	}
+	if event.DeviceID != vars["deviceID"] {
+		apiErr := models.NewAPIError(models.ErrorCodeForbidden, "device_id does not match the device in the URL", nil, http.StatusForbidden)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	event.Type = eventType
+
+	if err := c.service.SaveDeviceEvent(r.Context(), vars["locationID"], event); err != nil {
+		respondWithServiceError(w, err, "error processing device event")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]string{"message": "Device event received and written to InfluxDB"})
+}
+
+// HandleGetAvailability returns the uptime, outages, MTBF and MTTR of the devices of a location over a time range.
+func (c *DataController) HandleGetAvailability(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := models.AvailabilityRequest{
+		LocationID:     query.Get("location_id"),
+		DeviceIDs:      query["device_id"], // Set by the middleware to the accessible devices when omitted
+		TimeRangeStart: query.Get("time_range_start"),
+		TimeRangeStop:  query.Get("time_range_stop"),
+		Timeout:        query.Get("timeout"),
+	}
+	if req.LocationID == "" {
+		apiErr := models.NewAPIError(models.ErrorCodeMissingParameter, "location_id is required", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+
+	availability, err := c.service.GetAvailability(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error computing availability")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, availability)
+}
+
+// ListEventDevices lists the devices of a location with heartbeat or status events in the time range of an
+// availability request.
+func (c *DataController) ListEventDevices(r *http.Request, locationID string) ([]string, error) {
+	query := r.URL.Query()
+	return c.service.EventDevices(r.Context(), locationID, query.Get("time_range_start"), query.Get("time_range_stop"), query.Get("timeout"))
+}
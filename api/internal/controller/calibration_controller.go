@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// HandleListCalibrations returns the calibration profiles of every sensor of a device.
+func (c *DataController) HandleListCalibrations(w http.ResponseWriter, r *http.Request) {
+	deviceID := mux.Vars(r)["deviceID"]
+	respondWithJSON(w, http.StatusOK, c.service.ListCalibrations(deviceID))
+}
+
+// HandleCreateCalibration adds a calibration profile to a sensor.
+func (c *DataController) HandleCreateCalibration(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var profile models.CalibrationProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeBadRequest, "Invalid request payload", err.Error(), http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+
+	created, err := c.service.CreateCalibration(r.Context(), vars["deviceID"], vars["sensorID"], profile)
+	if err != nil {
+		respondWithServiceError(w, err, "Error creating calibration profile")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+// HandleUpdateCalibration replaces a calibration profile of a sensor.
+func (c *DataController) HandleUpdateCalibration(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var profile models.CalibrationProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeBadRequest, "Invalid request payload", err.Error(), http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+
+	updated, err := c.service.UpdateCalibration(r.Context(), vars["deviceID"], vars["sensorID"], vars["profileID"], profile)
+	if err != nil {
+		respondWithServiceError(w, err, "Error updating calibration profile")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// HandleDeleteCalibration removes a calibration profile from a sensor.
+func (c *DataController) HandleDeleteCalibration(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := c.service.DeleteCalibration(r.Context(), vars["deviceID"], vars["sensorID"], vars["profileID"]); err != nil {
+		respondWithServiceError(w, err, "Error deleting calibration profile")
+		return
+	}
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleRecomputeCalibration reapplies the calibration profiles of a sensor to a historical range.
+func (c *DataController) HandleRecomputeCalibration(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var req models.RecomputeCalibrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeBadRequest, "Invalid request payload", err.Error(), http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	// The points are rewritten in the bucket of the location, the device must belong to it
+	if req.LocationID != "" && !authorizeDevices(w, r, req.LocationID, []string{vars["deviceID"]}) {
+		return
+	}
+
+	result, err := c.service.RecomputeCalibration(r.Context(), vars["deviceID"], vars["sensorID"], req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error recomputing calibration")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"net/http"
+	"strconv"
+)
+
+// HandleSensorChangePoints returns the change points of a sensor field over a time range.
+func (c *DataController) HandleSensorChangePoints(w http.ResponseWriter, r *http.Request) {
+	c.handleChangePoints(w, r, models.SourceSensor)
+}
+
+// HandleConsumptionChangePoints returns the change points of a consumption metric over a time range.
+func (c *DataController) HandleConsumptionChangePoints(w http.ResponseWriter, r *http.Request) {
+	c.handleChangePoints(w, r, models.SourceConsumption)
+}
+
+// handleChangePoints parses a change-point detection request of the given source.
+func (c *DataController) handleChangePoints(w http.ResponseWriter, r *http.Request, source string) {
+	query := r.URL.Query()
+	req := models.ChangePointRequest{
+		Source:         source,
+		LocationID:     query.Get("location_id"),
+		DeviceID:       query.Get("device_id"),
+		Field:          query.Get("field"),
+		TimeRangeStart: query.Get("time_range_start"),
+		TimeRangeStop:  query.Get("time_range_stop"),
+		WindowPeriod:   query.Get("window_period"),
+		Timezone:       query.Get("timezone"),
+		Unit:           query.Get("unit"),
+		Cost:           query.Get("cost"),
+	}
+
+	if raw := query.Get("penalty"); raw != "" {
+		penalty, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "penalty must be a number", nil, http.StatusBadRequest)
+			utils.RespondWithError(w, apiErr)
+			return
+		}
+		req.Penalty = &penalty
+	}
+	var err error
+	if req.MinSegment, err = parseIntParam(query.Get("min_segment")); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "min_segment must be an integer", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+
+	// A virtual sensor field may read other devices than the one checked by the middleware
+	if source == models.SourceSensor && !c.authorizeVirtualInputs(w, r, req.LocationID, []string{req.DeviceID}, []string{req.Field}) {
+		return
+	}
+
+	changePoints, err := c.service.DetectChangePoints(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error detecting change points")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, changePoints)
+}
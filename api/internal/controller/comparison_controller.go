@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"net/http"
+)
+
+// HandleCompareSensorData compares a sensor field over a base range with the same range shifted by offsets.
+func (c *DataController) HandleCompareSensorData(w http.ResponseWriter, r *http.Request) {
+	c.handleCompare(w, r, models.SourceSensor)
+}
+
+// HandleCompareConsumption compares a consumption metric over a base range with the same range shifted by offsets.
+func (c *DataController) HandleCompareConsumption(w http.ResponseWriter, r *http.Request) {
+	c.handleCompare(w, r, models.SourceConsumption)
+}
+
+// handleCompare parses a period-over-period comparison of the given source.
+func (c *DataController) handleCompare(w http.ResponseWriter, r *http.Request, source string) {
+	query := r.URL.Query()
+	req := models.ComparisonRequest{
+		Source:         source,
+		LocationID:     query.Get("location_id"),
+		DeviceID:       query.Get("device_id"),
+		Field:          query.Get("field"),
+		TimeRangeStart: query.Get("time_range_start"),
+		TimeRangeStop:  query.Get("time_range_stop"),
+		Offsets:        query["offset"],
+		WindowPeriod:   query.Get("window_period"),
+		Timezone:       query.Get("timezone"),
+		Unit:           query.Get("unit"),
+		Total:          query.Get("total"),
+	}
+
+	// A virtual sensor field may read other devices than the one checked by the middleware
+	if source == models.SourceSensor && !c.authorizeVirtualInputs(w, r, req.LocationID, []string{req.DeviceID}, []string{req.Field}) {
+		return
+	}
+
+	comparison, err := c.service.ComparePeriods(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error comparing periods")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, comparison)
+}
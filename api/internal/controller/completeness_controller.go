@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"net/http"
+)
+
+// HandleGetCompleteness returns the expected and received samples, gaps and completeness of the fields of a device.
+func (c *DataController) HandleGetCompleteness(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := models.CompletenessRequest{
+		LocationID:       query.Get("location_id"),
+		DeviceID:         query.Get("device_id"),
+		SensorType:       query["sensor_type"],
+		TimeRangeStart:   query.Get("time_range_start"),
+		TimeRangeStop:    query.Get("time_range_stop"),
+		ExpectedInterval: query.Get("expected_interval"),
+		MinGap:           query.Get("min_gap"),
+	}
+	if req.LocationID == "" || req.DeviceID == "" {
+		apiErr := models.NewAPIError(models.ErrorCodeMissingParameter, "location_id and device_id are required", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	excludeFlagged, err := parseBoolParam(query.Get("exclude_flagged"))
+	if err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "exclude_flagged must be a boolean", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	req.ExcludeFlagged = excludeFlagged
+
+	report, err := c.service.GetCompleteness(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error computing data completeness")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
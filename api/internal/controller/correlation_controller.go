@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"net/http"
+	"strconv"
+)
+
+// HandleCorrelation returns the correlations between several sensor and consumption series.
+func (c *DataController) HandleCorrelation(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := models.CorrelationRequest{
+		TimeRangeStart: query.Get("time_range_start"),
+		TimeRangeStop:  query.Get("time_range_stop"),
+		WindowPeriod:   query.Get("window_period"),
+		Timezone:       query.Get("timezone"),
+		IncludeScatter: true,
+	}
+	for _, raw := range query["series"] {
+		ref, err := models.ParseSeriesRef(raw)
+		if err != nil {
+			respondWithServiceError(w, err, "Invalid series")
+			return
+		}
+		req.Series = append(req.Series, ref)
+	}
+
+	if raw := query.Get("max_lag"); raw != "" {
+		maxLag, err := strconv.Atoi(raw)
+		if err != nil {
+			apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "max_lag must be an integer", nil, http.StatusBadRequest)
+			utils.RespondWithError(w, apiErr)
+			return
+		}
+		req.MaxLag = &maxLag
+	}
+	if raw := query.Get("include_scatter"); raw != "" {
+		includeScatter, err := strconv.ParseBool(raw)
+		if err != nil {
+			apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "include_scatter must be a boolean", nil, http.StatusBadRequest)
+			utils.RespondWithError(w, apiErr)
+			return
+		}
+		req.IncludeScatter = includeScatter
+	}
+
+	// A virtual sensor field may read other devices than the one of its series, checked by the middleware
+	for _, ref := range req.Series {
+		if ref.Source == models.SourceSensor && !c.authorizeVirtualInputs(w, r, ref.LocationID, []string{ref.DeviceID}, []string{ref.Field}) {
+			return
+		}
+	}
+
+	correlation, err := c.service.Correlate(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error computing correlations")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, correlation)
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// HandleGetDegreeDays returns the heating and cooling degree-days of a location.
+func (c *DataController) HandleGetDegreeDays(w http.ResponseWriter, r *http.Request) {
+	req, ok := parseDegreeDaysRequest(w, r.URL.Query())
+	if !ok || !c.authorizeOutdoorSensor(w, r, req) {
+		return
+	}
+
+	degreeDays, err := c.service.GetDegreeDays(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error computing degree-days")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, degreeDays)
+}
+
+// HandleGetWeatherNormalization returns the weather-normalized energy of the consumption devices of a location.
+func (c *DataController) HandleGetWeatherNormalization(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	degreeDays, ok := parseDegreeDaysRequest(w, query)
+	if !ok || !c.authorizeOutdoorSensor(w, r, degreeDays) {
+		return
+	}
+	req := models.WeatherNormalizationRequest{
+		DegreeDaysRequest: degreeDays,
+		DeviceIDs:         query["device_id"],
+		Period:            query.Get("period"),
+	}
+
+	normalization, err := c.service.GetWeatherNormalization(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error normalizing energy for weather")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, normalization)
+}
+
+// authorizeOutdoorSensor checks the rights of the user, within the location, on the outdoor_device_id sensor replacing
+// the configured one, and on the devices its field reads when it is a virtual sensor. It responds with the error and
+// returns false when access is denied.
+func (c *DataController) authorizeOutdoorSensor(w http.ResponseWriter, r *http.Request, req models.DegreeDaysRequest) bool {
+	if req.OutdoorDeviceID == "" {
+		return true
+	}
+	return authorizeDevices(w, r, req.LocationID, []string{req.OutdoorDeviceID}) &&
+		c.authorizeVirtualInputs(w, r, req.LocationID, []string{req.OutdoorDeviceID}, []string{req.OutdoorField})
+}
+
+// parseDegreeDaysRequest reads the degree-day parameters shared by both endpoints. It responds with the error and
+// returns false when a parameter is malformed.
+func parseDegreeDaysRequest(w http.ResponseWriter, query url.Values) (models.DegreeDaysRequest, bool) {
+	req := models.DegreeDaysRequest{
+		LocationID:      query.Get("location_id"),
+		TimeRangeStart:  query.Get("time_range_start"),
+		TimeRangeStop:   query.Get("time_range_stop"),
+		Timezone:        query.Get("timezone"),
+		OutdoorDeviceID: query.Get("outdoor_device_id"),
+		OutdoorField:    query.Get("outdoor_field"),
+	}
+	for name, target := range map[string]**float64{"heating_base": &req.HeatingBase, "cooling_base": &req.CoolingBase} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, fmt.Sprintf("%s must be a number", name), nil, http.StatusBadRequest)
+			utils.RespondWithError(w, apiErr)
+			return models.DegreeDaysRequest{}, false
+		}
+		*target = &value
+	}
+	return req, true
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"net/http"
+)
+
+// HandleGetDemand returns the peak demand and load profile of the consumption devices of a location.
+func (c *DataController) HandleGetDemand(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := models.DemandRequest{
+		LocationID:     query.Get("location_id"),
+		DeviceIDs:      query["device_id"],
+		TimeRangeStart: query.Get("time_range_start"),
+		TimeRangeStop:  query.Get("time_range_stop"),
+		DemandInterval: query.Get("demand_interval"),
+		BillingPeriod:  query.Get("billing_period"),
+		Profile:        query.Get("profile"),
+		Timezone:       query.Get("timezone"),
+		Unit:           query.Get("unit"),
+	}
+
+	var err error
+	if req.TopN, err = parseIntParam(query.Get("top_n")); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "top_n must be an integer", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	if req.Aggregate, err = parseBoolParam(query.Get("aggregate")); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "aggregate must be a boolean", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+
+	demand, err := c.service.GetDemand(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error analysing demand")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, demand)
+}
@@ -1,10 +1,12 @@
 package controller
 
 import (
+	"CapIot.influxDB/internal/middleware"
 	"CapIot.influxDB/internal/models"  // Use your actual module name
 	"CapIot.influxDB/internal/service" // Use your actual module name
 	"CapIot.influxDB/internal/utils"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-resty/resty/v2"
 	"github.com/gorilla/mux"
@@ -13,6 +15,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 )
 
 type ProvisioningResponse struct {
@@ -42,6 +45,64 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	}
 }
 
+// respondWithServiceError sends the APIError returned by the service as-is (e.g. validation failures),
+// and wraps any other error in an internal server error prefixed with message.
+func respondWithServiceError(w http.ResponseWriter, err error, message string) {
+	var apiErr models.APIError
+	if errors.As(err, &apiErr) {
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	utils.RespondWithError(w, models.NewAPIError(models.ErrorCodeInternalServerError, fmt.Sprintf("%s: %v", message, err), nil, http.StatusInternalServerError))
+}
+
+// parseBoolParam parses an optional boolean query parameter, an empty value meaning false.
+func parseBoolParam(raw string) (bool, error) {
+	if raw == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(raw)
+}
+
+// parseIntParam parses an optional integer query parameter, an empty value meaning 0.
+func parseIntParam(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(raw)
+}
+
+// authorizeDevices checks that the user may access every device of a location (every device alone when locationID is
+// empty), for devices named in a request body rather than in the query checked by the middleware. It responds with
+// the error and returns false when access is denied.
+func authorizeDevices(w http.ResponseWriter, r *http.Request, locationID string, deviceIDs []string) bool {
+	token := r.Header.Get("Authorization")
+	allowed := make([]bool, len(deviceIDs))
+	var err error
+	if locationID != "" {
+		allowed, err = middleware.CheckUserRightsForEach(token, deviceIDs, locationID)
+	} else {
+		for i, deviceID := range deviceIDs {
+			if allowed[i], err = middleware.CheckUserDevice(token, deviceID); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Error checking device rights: %v", err)
+		utils.RespondWithError(w, models.NewAPIError(models.ErrorCodeInternalServerError, "Error checking device rights", nil, http.StatusInternalServerError))
+		return false
+	}
+	for i, deviceID := range deviceIDs {
+		if !allowed[i] {
+			log.Printf("Insufficient device rights for deviceID: %s", deviceID)
+			utils.RespondWithError(w, models.NewAPIError(models.ErrorCodeInsufficientPermissions, fmt.Sprintf("insufficient rights on device '%s'", deviceID), nil, http.StatusForbidden))
+			return false
+		}
+	}
+	return true
+}
+
 // HandleSensorData handles the incoming HTTP request.
 func (c *DataController) HandleSensorData(w http.ResponseWriter, r *http.Request) {
 	log.Println("--- HandleSensorData function is being executed ---")
@@ -67,8 +128,7 @@ func (c *DataController) HandleSensorData(w http.ResponseWriter, r *http.Request
 	for _, data := range dataArray {
 		err = c.service.ProcessAndSaveSensorData(r.Context(), data)
 		if err != nil {
-			apiErr := models.NewAPIError(models.ErrorCodeInternalServerError, fmt.Sprintf("error processing data: %v", err), nil, http.StatusInternalServerError)
-			utils.RespondWithError(w, apiErr)
+			respondWithServiceError(w, err, "error processing data")
 			return
 		}
 	}
@@ -90,19 +150,33 @@ func (c *DataController) HandleQueryData(w http.ResponseWriter, r *http.Request)
 	query := r.URL.Query()
 
 	req.LocationID = query.Get("location_id")
-	req.DeviceID = query.Get("device_id")
+	req.DeviceIDs = query["device_id"] // Set by the middleware to the accessible devices when omitted
 	req.SensorType = query["sensor_type"]
 	req.WindowPeriod = query.Get("window_period")
 	req.TimeRangeStart = query.Get("time_range_start")
 	req.TimeRangeStop = query.Get("time_range_stop")
+	req.Units = query["unit"]
 
-	if req.LocationID == "" {
-		apiErr := models.NewAPIError(models.ErrorCodeMissingParameter, "location_id is required", nil, http.StatusBadRequest)
+	excludeFlagged, err := parseBoolParam(query.Get("exclude_flagged"))
+	if err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "exclude_flagged must be a boolean", nil, http.StatusBadRequest)
 		utils.RespondWithError(w, apiErr)
 		return
 	}
-	if req.DeviceID == "" {
-		apiErr := models.NewAPIError(models.ErrorCodeMissingParameter, "device_id is required", nil, http.StatusBadRequest)
+	req.ExcludeFlagged = excludeFlagged
+
+	req.Timezone = query.Get("timezone")
+	req.Fill = query.Get("fill")
+	req.FillMaxDistance = query.Get("fill_max_distance")
+	req.Downsample = query.Get("downsample")
+	if req.MaxPoints, err = parseIntParam(query.Get("max_points")); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "max_points must be an integer", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+
+	if req.LocationID == "" {
+		apiErr := models.NewAPIError(models.ErrorCodeMissingParameter, "location_id is required", nil, http.StatusBadRequest)
 		utils.RespondWithError(w, apiErr)
 		return
 	}
@@ -112,16 +186,31 @@ func (c *DataController) HandleQueryData(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Virtual sensors may read other devices than the queried ones, checked by the middleware
+	if !c.authorizeVirtualInputs(w, r, req.LocationID, req.DeviceIDs, req.SensorType) {
+		return
+	}
+
 	data, err := c.service.GetData(req)
 	if err != nil {
-		apiErr := models.NewAPIError(models.ErrorCodeInternalServerError, fmt.Sprintf("Error fetching data from InfluxDB: %v", err), nil, http.StatusInternalServerError)
-		utils.RespondWithError(w, apiErr)
+		respondWithServiceError(w, err, "Error fetching data from InfluxDB")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, data)
 }
 
+// ListQueryDevices lists the devices of a location with sensor data in the time range of a sensor data query.
+func (c *DataController) ListQueryDevices(r *http.Request, locationID string) ([]string, error) {
+	query := r.URL.Query()
+	return c.service.ListDevices(r.Context(), locationID, query.Get("time_range_start"), query.Get("time_range_stop"))
+}
+
+// ListConsumptionDevices lists the consumption devices configured for a location.
+func (c *DataController) ListConsumptionDevices(r *http.Request, locationID string) ([]string, error) {
+	return c.service.ListConsumptionDevices(locationID)
+}
+
 // HandleConsumptionData handles the incoming HTTP request for consumption data.
 func (c *DataController) HandleConsumptionData(w http.ResponseWriter, r *http.Request) {
 	log.Println("--- HandleConsumptionData function is being executed ---")
@@ -148,8 +237,7 @@ func (c *DataController) HandleConsumptionData(w http.ResponseWriter, r *http.Re
 
 	err := c.service.SaveConsumptionData(r.Context(), req)
 	if err != nil {
-		apiErr := models.NewAPIError(models.ErrorCodeInternalServerError, "Error processing consumption data", nil, http.StatusInternalServerError)
-		utils.RespondWithError(w, apiErr)
+		respondWithServiceError(w, err, "Error processing consumption data")
 		return
 	}
 
@@ -177,6 +265,9 @@ func (c *DataController) HandleGetConsumptionData(w http.ResponseWriter, r *http
 		return
 	}
 
+	// Optional location, whose timezone applies by default. The middleware checked the device within it.
+	req.LocationID = query.Get("location_id")
+
 	// 2. Metrics (Required)
 	// Note: r.URL.Query()["metric"] handles multiple 'metric' parameters
 	req.Metrics = query["metric"]
@@ -202,24 +293,46 @@ func (c *DataController) HandleGetConsumptionData(w http.ResponseWriter, r *http
 		return
 	}
 
-	// 5. Window Period (CRITICAL: This line was missing)
+	// 5. Window Period (Optional, picked by the query planner when omitted or "auto")
 	req.WindowPeriod = query.Get("window_period")
-	if req.WindowPeriod == "" {
-		apiErr := models.NewAPIError(models.ErrorCodeMissingParameter, "window_period is required (e.g., '1h', '30m')", nil, http.StatusBadRequest)
+
+	// 6. Output units (Optional)
+	req.Units = query["unit"]
+
+	// 7. Quality filter (Optional)
+	excludeFlagged, err := parseBoolParam(query.Get("exclude_flagged"))
+	if err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "exclude_flagged must be a boolean", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	req.ExcludeFlagged = excludeFlagged
+
+	// 8. Calendar timezone, gap fill and downsampling (Optional)
+	req.Timezone = query.Get("timezone")
+	req.Fill = query.Get("fill")
+	req.FillMaxDistance = query.Get("fill_max_distance")
+	req.Downsample = query.Get("downsample")
+	if req.MaxPoints, err = parseIntParam(query.Get("max_points")); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "max_points must be an integer", nil, http.StatusBadRequest)
 		utils.RespondWithError(w, apiErr)
 		return
 	}
 
 	data, err := c.service.GetConsumptionData(r.Context(), req)
 	if err != nil {
-		apiErr := models.NewAPIError(models.ErrorCodeInternalServerError, fmt.Sprintf("Error fetching consumption data: %v", err), nil, http.StatusInternalServerError)
-		utils.RespondWithError(w, apiErr)
+		respondWithServiceError(w, err, "Error fetching consumption data")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, data)
 }
 
+// HandleGetUnits lists the canonical unit of every field known to the API.
+func (c *DataController) HandleGetUnits(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, c.service.FieldUnits())
+}
+
 // HandleProvisioning acts as a proxy to a provisioning endpoint.
 func (c *DataController) HandleProvisioning(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"net/http"
+)
+
+// HandleGetEmissions returns the CO2e emissions of the consumption devices of a location.
+func (c *DataController) HandleGetEmissions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := models.EmissionsRequest{
+		LocationID:     query.Get("location_id"),
+		DeviceIDs:      query["device_id"],
+		TimeRangeStart: query.Get("time_range_start"),
+		TimeRangeStop:  query.Get("time_range_stop"),
+		WindowPeriod:   query.Get("window_period"),
+		Timezone:       query.Get("timezone"),
+		Country:        query.Get("country"),
+		Intensity:      query.Get("intensity"),
+	}
+
+	emissions, err := c.service.GetEmissions(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error estimating emissions")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, emissions)
+}
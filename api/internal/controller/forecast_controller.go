@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// HandleSensorForecast returns the forecast of a sensor field.
+func (c *DataController) HandleSensorForecast(w http.ResponseWriter, r *http.Request) {
+	c.handleForecast(w, r, models.SourceSensor)
+}
+
+// HandleConsumptionForecast returns the forecast of a consumption metric.
+func (c *DataController) HandleConsumptionForecast(w http.ResponseWriter, r *http.Request) {
+	c.handleForecast(w, r, models.SourceConsumption)
+}
+
+// handleForecast parses a forecast request of the given source.
+func (c *DataController) handleForecast(w http.ResponseWriter, r *http.Request, source string) {
+	query := r.URL.Query()
+	req := models.ForecastRequest{
+		Source:       source,
+		LocationID:   query.Get("location_id"),
+		DeviceID:     query.Get("device_id"),
+		Field:        query.Get("field"),
+		History:      query.Get("history"),
+		Horizon:      query.Get("horizon"),
+		WindowPeriod: query.Get("window_period"),
+		Model:        query.Get("model"),
+		Season:       query.Get("season"),
+		Timezone:     query.Get("timezone"),
+		Unit:         query.Get("unit"),
+	}
+
+	if raw := query.Get("confidence"); raw != "" {
+		confidence, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "confidence must be a number", nil, http.StatusBadRequest)
+			utils.RespondWithError(w, apiErr)
+			return
+		}
+		req.Confidence = confidence
+	}
+	for name, target := range map[string]**float64{"alpha": &req.Alpha, "beta": &req.Beta, "gamma": &req.Gamma} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, fmt.Sprintf("%s must be a number", name), nil, http.StatusBadRequest)
+			utils.RespondWithError(w, apiErr)
+			return
+		}
+		*target = &value
+	}
+	var err error
+	if req.IncludeHistory, err = parseBoolParam(query.Get("include_history")); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "include_history must be a boolean", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+
+	// A virtual sensor field may read other devices than the one checked by the middleware
+	if source == models.SourceSensor && !c.authorizeVirtualInputs(w, r, req.LocationID, []string{req.DeviceID}, []string{req.Field}) {
+		return
+	}
+
+	forecast, err := c.service.Forecast(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error computing forecast")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, forecast)
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"net/http"
+)
+
+// HandleGetLatest returns the most recent reading of each field of one or many devices of a location.
+func (c *DataController) HandleGetLatest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := models.LatestRequest{
+		LocationID: query.Get("location_id"),
+		DeviceIDs:  query["device_id"], // Set by the middleware to the accessible devices when omitted
+		SensorType: query["sensor_type"],
+		Units:      query["unit"],
+	}
+
+	latest, err := c.service.GetLatest(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error fetching latest values")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, latest)
+}
+
+// ListRecentDevices lists the devices of a location with recent sensor data.
+func (c *DataController) ListRecentDevices(r *http.Request, locationID string) ([]string, error) {
+	return c.service.RecentDevices(r.Context(), locationID)
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// HandleRunningHours handles the running hours counters published by a device.
+func (c *DataController) HandleRunningHours(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var readings []models.RunningHoursReq
+	if err := json.NewDecoder(r.Body).Decode(&readings); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeBadRequest, fmt.Sprintf("error unmarshalling JSON: %v", err), nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+
+	for _, reading := range readings {
+		if reading.DeviceID == "" {
+			reading.DeviceID = vars["deviceID"]
+		}
+		if reading.DeviceID != vars["deviceID"] {
+			apiErr := models.NewAPIError(models.ErrorCodeForbidden, "device_id does not match the device in the URL", nil, http.StatusForbidden)
+			utils.RespondWithError(w, apiErr)
+			return
+		}
+		if err := c.service.SaveRunningHours(r.Context(), vars["locationID"], reading); err != nil {
+			respondWithServiceError(w, err, "error processing running hours")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]string{"message": "Running hours received and written to InfluxDB"})
+}
+
+// HandleGetMaintenance returns the components of a location due for maintenance within a horizon.
+func (c *DataController) HandleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := models.MaintenanceRequest{
+		LocationID: query.Get("location_id"),
+		DeviceIDs:  query["device_id"], // Set by the middleware to the accessible devices when omitted
+		Horizon:    query.Get("horizon"),
+		Lookback:   query.Get("lookback"),
+	}
+	if req.LocationID == "" {
+		apiErr := models.NewAPIError(models.ErrorCodeMissingParameter, "location_id is required", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	includeAll, err := parseBoolParam(query.Get("include_all"))
+	if err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "include_all must be a boolean", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	req.IncludeAll = includeAll
+
+	forecast, err := c.service.GetMaintenanceForecast(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error computing maintenance forecast")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, forecast)
+}
+
+// ListComponentDevices lists the devices of a location with running hours in the lookback period of a maintenance
+// forecast.
+func (c *DataController) ListComponentDevices(r *http.Request, locationID string) ([]string, error) {
+	return c.service.ComponentDevices(r.Context(), locationID, r.URL.Query().Get("lookback"))
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"net/http"
+)
+
+// HandleGetQualitySummary returns the number of points per quality flag and field for a device over a time range.
+func (c *DataController) HandleGetQualitySummary(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := models.QualityRequest{
+		LocationID:     query.Get("location_id"),
+		DeviceID:       query.Get("device_id"),
+		TimeRangeStart: query.Get("time_range_start"),
+		TimeRangeStop:  query.Get("time_range_stop"),
+	}
+
+	if req.LocationID == "" || req.DeviceID == "" {
+		apiErr := models.NewAPIError(models.ErrorCodeMissingParameter, "location_id and device_id are required", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+
+	summary, err := c.service.GetQualitySummary(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error fetching data quality summary")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, summary)
+}
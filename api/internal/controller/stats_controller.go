@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// HandleSensorStats returns the distribution of sensor fields of a device over a time range.
+func (c *DataController) HandleSensorStats(w http.ResponseWriter, r *http.Request) {
+	c.handleStats(w, r, models.SourceSensor, "sensor_type")
+}
+
+// HandleConsumptionStats returns the distribution of consumption metrics of a device over a time range.
+func (c *DataController) HandleConsumptionStats(w http.ResponseWriter, r *http.Request) {
+	c.handleStats(w, r, models.SourceConsumption, "metric")
+}
+
+// handleStats parses a stats request of the given source, whose fields are listed in the fieldParam parameter.
+func (c *DataController) handleStats(w http.ResponseWriter, r *http.Request, source, fieldParam string) {
+	query := r.URL.Query()
+	req := models.StatsRequest{
+		Source:         source,
+		LocationID:     query.Get("location_id"),
+		DeviceID:       query.Get("device_id"),
+		Fields:         query[fieldParam],
+		TimeRangeStart: query.Get("time_range_start"),
+		TimeRangeStop:  query.Get("time_range_stop"),
+		Units:          query["unit"],
+	}
+
+	var err error
+	if req.Bins, err = parseIntParam(query.Get("bins")); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "bins must be an integer", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	for name, target := range map[string]**float64{"hist_min": &req.HistMin, "hist_max": &req.HistMax} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, fmt.Sprintf("%s must be a number", name), nil, http.StatusBadRequest)
+			utils.RespondWithError(w, apiErr)
+			return
+		}
+		*target = &value
+	}
+	if req.ExcludeFlagged, err = parseBoolParam(query.Get("exclude_flagged")); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeInvalidFormat, "exclude_flagged must be a boolean", nil, http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+
+	stats, err := c.service.GetStats(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, err, "Error computing statistics")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// HandleListVirtualSensors returns the virtual sensors of a location.
+func (c *DataController) HandleListVirtualSensors(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, c.service.ListVirtualSensors(mux.Vars(r)["locationID"]))
+}
+
+// HandleGetVirtualSensor returns one virtual sensor of a location.
+func (c *DataController) HandleGetVirtualSensor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensor, err := c.service.GetVirtualSensor(vars["locationID"], vars["sensorID"])
+	if err != nil {
+		respondWithServiceError(w, err, "Error fetching virtual sensor")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, sensor)
+}
+
+// HandleCreateVirtualSensor creates a virtual sensor for a location.
+func (c *DataController) HandleCreateVirtualSensor(w http.ResponseWriter, r *http.Request) {
+	var sensor models.VirtualSensor
+	if err := json.NewDecoder(r.Body).Decode(&sensor); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeBadRequest, "Invalid request payload", err.Error(), http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	locationID := mux.Vars(r)["locationID"]
+	if !authorizeVirtualSensorDevices(w, r, locationID, sensor) {
+		return
+	}
+
+	created, err := c.service.CreateVirtualSensor(r.Context(), locationID, sensor)
+	if err != nil {
+		respondWithServiceError(w, err, "Error creating virtual sensor")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+// HandleUpdateVirtualSensor replaces a virtual sensor of a location.
+func (c *DataController) HandleUpdateVirtualSensor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var sensor models.VirtualSensor
+	if err := json.NewDecoder(r.Body).Decode(&sensor); err != nil {
+		apiErr := models.NewAPIError(models.ErrorCodeBadRequest, "Invalid request payload", err.Error(), http.StatusBadRequest)
+		utils.RespondWithError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	if !authorizeVirtualSensorDevices(w, r, vars["locationID"], sensor) {
+		return
+	}
+
+	updated, err := c.service.UpdateVirtualSensor(r.Context(), vars["locationID"], vars["sensorID"], sensor)
+	if err != nil {
+		respondWithServiceError(w, err, "Error updating virtual sensor")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// HandleDeleteVirtualSensor deletes a virtual sensor of a location.
+func (c *DataController) HandleDeleteVirtualSensor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := c.service.DeleteVirtualSensor(r.Context(), vars["locationID"], vars["sensorID"]); err != nil {
+		respondWithServiceError(w, err, "Error deleting virtual sensor")
+		return
+	}
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// authorizeVirtualSensorDevices checks the rights of the user on the device of a virtual sensor and on the devices of
+// its inputs. It responds with the error and returns false when access is denied.
+func authorizeVirtualSensorDevices(w http.ResponseWriter, r *http.Request, locationID string, sensor models.VirtualSensor) bool {
+	seen := make(map[string]bool)
+	var devices []string
+	add := func(deviceID string) {
+		if deviceID != "" && !seen[deviceID] {
+			seen[deviceID] = true
+			devices = append(devices, deviceID)
+		}
+	}
+	add(sensor.DeviceID)
+	for _, input := range sensor.Inputs {
+		add(input.DeviceID)
+	}
+	return len(devices) == 0 || authorizeDevices(w, r, locationID, devices)
+}
+
+// authorizeVirtualInputs checks the rights of the user on the devices read by the virtual sensors among sensorTypes
+// besides the queried devices, which the middleware checked. It responds with the error and returns false when access
+// is denied.
+func (c *DataController) authorizeVirtualInputs(w http.ResponseWriter, r *http.Request, locationID string, deviceIDs, sensorTypes []string) bool {
+	devices := c.service.VirtualSensorInputDevices(locationID, sensorTypes, deviceIDs)
+	return len(devices) == 0 || authorizeDevices(w, r, locationID, devices)
+}
@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/utils"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-resty/resty/v2"
 	"github.com/gorilla/mux"
@@ -9,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 )
 
 // Response structure from Mongo API
@@ -39,6 +43,35 @@ func CheckLocationAccess(token string, locationID string) (bool, error) {
 	return result.Allowed, nil
 }
 
+// CheckLocationAccessMiddleware is a middleware that verifies user access to the location in the URL path
+// (or the location_id query parameter) using CheckLocationAccess
+func CheckLocationAccessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locationID := mux.Vars(r)["locationID"]
+		if locationID == "" {
+			locationID = r.URL.Query().Get("location_id")
+		}
+		if locationID == "" {
+			http.Error(w, "Missing locationID in URL path or query", http.StatusBadRequest)
+			log.Printf("Missing locationID in URL path or query")
+			return
+		}
+
+		allowed, err := CheckLocationAccess(r.Header.Get("Authorization"), locationID)
+		if err != nil {
+			http.Error(w, "Error checking location access", http.StatusInternalServerError)
+			log.Printf("Error checking location access: %v", err)
+			return
+		}
+		if !allowed {
+			http.Error(w, "Insufficient location rights", http.StatusForbidden)
+			log.Printf("Insufficient location rights for locationID: %s", locationID)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // CheckDeviceRightsMiddleware is a middleware that verifies user access to a device using CheckDeviceRights
 func CheckDeviceRightsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -91,12 +124,18 @@ func CheckDeviceRightsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// CheckUserDeviceRightsMiddleware is a middleware that verifies user access to the device in the URL path (or the
+// device_id query parameter) using CheckUserDevice. When the location_id query parameter is set, as consumption
+// queries do to use the timezone of the location, the device is checked within that location instead.
 func CheckUserDeviceRightsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenHeader := r.Header.Get("Authorization")
 		log.Printf("CheckDeviceRightsMiddleware invoked for %s %s", r.Method, r.URL.Path)
 
-		deviceID := r.URL.Query().Get("device_id")
+		deviceID := mux.Vars(r)["deviceID"]
+		if deviceID == "" {
+			deviceID = r.URL.Query().Get("device_id")
+		}
 
 		if deviceID == "" {
 			http.Error(w, "Missing deviceID in URL path or query", http.StatusBadRequest)
@@ -104,31 +143,19 @@ func CheckUserDeviceRightsMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// resty request to check device rights
-		client := resty.New()
-		url := fmt.Sprintf("%s/devices/check-user-device/%s", os.Getenv("API_URL"), deviceID)
-		resp, err := client.R().
-			SetHeader("Authorization", tokenHeader).
-			Get(url)
-		log.Println("CheckDeviceRight request URL:", url)
-		log.Printf("CheckDeviceRight response: %s", resp.Body())
+		token := r.Header.Get("Authorization")
+		var allowed bool
+		var err error
+		if locationID := r.URL.Query().Get("location_id"); locationID != "" {
+			allowed, err = checkUserRights(token, deviceID, locationID)
+		} else {
+			allowed, err = CheckUserDevice(token, deviceID)
+		}
 		if err != nil {
 			http.Error(w, "Error checking device rights", http.StatusInternalServerError)
 			log.Printf("Error checking device rights: %v", err)
 			return
 		}
-
-		// Handle both JSON and plain-text responses
-		var allowed bool
-		var result AccessCheckResponse
-		err = json.Unmarshal(resp.Body(), &result)
-		if err == nil {
-			allowed = result.Allowed
-		} else {
-			body := strings.TrimSpace(string(resp.Body()))
-			allowed = strings.Contains(body, "Access granted")
-		}
-
 		if !allowed {
 			http.Error(w, "Insufficient device rights", http.StatusForbidden)
 			log.Printf("Insufficient device rights for deviceID: %s", deviceID)
@@ -138,6 +165,27 @@ func CheckUserDeviceRightsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// CheckUserDevice verifies if the user has access to a device, regardless of its location
+func CheckUserDevice(token, deviceID string) (bool, error) {
+	client := resty.New()
+	url := fmt.Sprintf("%s/devices/check-user-device/%s", os.Getenv("API_URL"), deviceID)
+	resp, err := client.R().
+		SetHeader("Authorization", token).
+		Get(url)
+	log.Println("CheckDeviceRight request URL:", url)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("CheckDeviceRight response: %s", resp.Body())
+
+	// Handle both JSON and plain-text responses
+	var result AccessCheckResponse
+	if err := json.Unmarshal(resp.Body(), &result); err == nil {
+		return result.Allowed, nil
+	}
+	return strings.Contains(strings.TrimSpace(string(resp.Body())), "Access granted"), nil
+}
+
 // CheckLocationAndDeviceAccess is a middleware that verifies user access to both location and device
 func CheckLocationAndDeviceAccess(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -178,30 +226,15 @@ func CheckLocationAndDeviceAccess(next http.Handler) http.Handler {
 
 func CheckUserRights(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenHeader := r.Header.Get("Authorization")
 		deviceID := r.URL.Query().Get("device_id")
 		locationID := r.URL.Query().Get("location_id")
-		log.Println("Checking access for device:", deviceID, "and location:", locationID)
 
-		// Use the logic from CheckDeviceRights
-		client := resty.New()
-		url := fmt.Sprintf("%s/devices/check-user-rights/%s/%s", os.Getenv("API_URL"), deviceID, locationID)
-		resp, err := client.R().
-			SetHeader("Authorization", tokenHeader).
-			Get(url)
-		log.Println("CheckDeviceRight request URL:", url)
-		log.Printf("CheckDeviceRight response: %s", resp.Body())
-
-		var allowed bool
-		var result AccessCheckResponse
-		err = json.Unmarshal(resp.Body(), &result)
-		if err == nil {
-			allowed = result.Allowed
-		} else {
-			body := strings.TrimSpace(string(resp.Body()))
-			allowed = strings.Contains(body, "Access granted")
+		allowed, err := checkUserRights(r.Header.Get("Authorization"), deviceID, locationID)
+		if err != nil {
+			http.Error(w, "Error checking device rights", http.StatusInternalServerError)
+			log.Printf("Error checking device rights: %v", err)
+			return
 		}
-
 		if !allowed {
 			http.Error(w, "Insufficient device rights", http.StatusForbidden)
 			log.Printf("Insufficient device rights for deviceID: %s", deviceID)
@@ -211,3 +244,148 @@ func CheckUserRights(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// checkUserRights verifies if the user has access to a device of a location
+func checkUserRights(token, deviceID, locationID string) (bool, error) {
+	log.Println("Checking access for device:", deviceID, "and location:", locationID)
+
+	client := resty.New()
+	url := fmt.Sprintf("%s/devices/check-user-rights/%s/%s", os.Getenv("API_URL"), deviceID, locationID)
+	resp, err := client.R().
+		SetHeader("Authorization", token).
+		Get(url)
+	log.Println("CheckDeviceRight request URL:", url)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("CheckDeviceRight response: %s", resp.Body())
+
+	// Handle both JSON and plain-text responses
+	var result AccessCheckResponse
+	if err := json.Unmarshal(resp.Body(), &result); err == nil {
+		return result.Allowed, nil
+	}
+	return strings.Contains(strings.TrimSpace(string(resp.Body())), "Access granted"), nil
+}
+
+// maxConcurrentRightsChecks bounds the parallel calls to the rights API when checking several devices.
+const maxConcurrentRightsChecks = 8
+
+// DeviceLister lists the devices of a location a request may cover.
+type DeviceLister func(r *http.Request, locationID string) ([]string, error)
+
+// CheckUserRightsForDevices is a middleware that verifies user access to every device_id query parameter of the
+// location_id location. Without device_id, the devices returned by listDevices are checked and the query is rewritten
+// to the ones the user may access, so the handler only ever sees authorized devices.
+func CheckUserRightsForDevices(listDevices DeviceLister) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			locationID := query.Get("location_id")
+			if locationID == "" {
+				http.Error(w, "Missing location_id in query", http.StatusBadRequest)
+				log.Printf("Missing location_id in query")
+				return
+			}
+
+			deviceIDs := query["device_id"]
+			requested := len(deviceIDs) > 0
+			if !requested {
+				devices, err := listDevices(r, locationID)
+				var apiErr models.APIError
+				if errors.As(err, &apiErr) {
+					utils.RespondWithError(w, apiErr)
+					return
+				}
+				if err != nil {
+					http.Error(w, "Error listing location devices", http.StatusInternalServerError)
+					log.Printf("Error listing devices of location %s: %v", locationID, err)
+					return
+				}
+				deviceIDs = devices
+			}
+
+			allowed, err := CheckUserRightsForEach(r.Header.Get("Authorization"), deviceIDs, locationID)
+			if err != nil {
+				http.Error(w, "Error checking device rights", http.StatusInternalServerError)
+				log.Printf("Error checking device rights: %v", err)
+				return
+			}
+
+			var permitted []string
+			for i, deviceID := range deviceIDs {
+				if allowed[i] {
+					permitted = append(permitted, deviceID)
+				} else if requested {
+					http.Error(w, "Insufficient device rights", http.StatusForbidden)
+					log.Printf("Insufficient device rights for deviceID: %s", deviceID)
+					return
+				}
+			}
+
+			query["device_id"] = permitted
+			r.URL.RawQuery = query.Encode()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CheckUserRightsForEach checks the rights of the user on several devices of a location with bounded concurrency.
+func CheckUserRightsForEach(token string, deviceIDs []string, locationID string) ([]bool, error) {
+	allowed := make([]bool, len(deviceIDs))
+	errs := make([]error, len(deviceIDs))
+	sem := make(chan struct{}, maxConcurrentRightsChecks)
+	var wg sync.WaitGroup
+	for i, deviceID := range deviceIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, deviceID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			allowed[i], errs[i] = checkUserRights(token, deviceID, locationID)
+		}(i, deviceID)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return allowed, nil
+}
+
+// CheckUserRightsForSeries is a middleware that verifies user access to the device of every series query parameter:
+// to the device in its location for sensor series, to the device alone for consumption series.
+func CheckUserRightsForSeries(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		for _, raw := range r.URL.Query()["series"] {
+			ref, err := models.ParseSeriesRef(raw)
+			if err != nil {
+				var apiErr models.APIError
+				errors.As(err, &apiErr)
+				utils.RespondWithError(w, apiErr)
+				return
+			}
+
+			var allowed bool
+			if ref.Source == models.SourceSensor {
+				allowed, err = checkUserRights(token, ref.DeviceID, ref.LocationID)
+			} else {
+				allowed, err = CheckUserDevice(token, ref.DeviceID)
+			}
+			if err != nil {
+				http.Error(w, "Error checking device rights", http.StatusInternalServerError)
+				log.Printf("Error checking device rights: %v", err)
+				return
+			}
+			if !allowed {
+				http.Error(w, "Insufficient device rights", http.StatusForbidden)
+				log.Printf("Insufficient device rights for series: %s", raw)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
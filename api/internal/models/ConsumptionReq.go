@@ -1,9 +1,22 @@
 package models
 
+// Metrics derived by the service from the readings of a consumption point.
+const (
+	MetricApparentPower = "apparent_power" // |V*I|, in VA
+	MetricPowerFactor   = "power_factor"   // P/S, unset when the apparent power is 0
+	MetricEnergy        = "energy"         // Monotonic counter of the consumed active energy, in Wh
+)
+
 type ConsumptionReq struct {
 	DeviceID  string  `json:"device_id"`
 	Current   float64 `json:"current"`
 	Voltage   float64 `json:"voltage"`
 	Power     float64 `json:"power"`
 	Timestamp string  `json:"timestamp"`
+	// Optional unit per reading, e.g. {"power": "kW"}. Missing entries are in the canonical unit.
+	Units map[string]string `json:"units,omitempty"`
+	// QualityFlags are set by the service when a reading looks wrong (see models.QualityFlag*).
+	QualityFlags []string `json:"-"`
+	// Derived are the metrics computed by the service from the readings (see Metric*), stored with them.
+	Derived map[string]float64 `json:"-"`
 }
@@ -3,12 +3,16 @@ package models
 import "time"
 
 type SensorQueryResponse struct {
-	DeviceID string                              `json:"deviceId"`
-	Readings map[string][]map[string]interface{} `json:"readings"` // Grouped by sensor type
+	DeviceID     string                              `json:"deviceId"`
+	Readings     map[string][]map[string]interface{} `json:"readings"` // Grouped by sensor type
+	Units        map[string]string                   `json:"units,omitempty"`
+	WindowPeriod string                              `json:"window_period,omitempty"` // Window used, chosen by the planner for "auto"
 }
 type ConsumptionQueryResponse struct {
-	DeviceID string                 `json:"device_id"`
-	Readings map[string][]DataPoint `json:"readings"`
+	DeviceID     string                 `json:"device_id"`
+	Readings     map[string][]DataPoint `json:"readings"`
+	Units        map[string]string      `json:"units,omitempty"`
+	WindowPeriod string                 `json:"window_period,omitempty"` // Window used, chosen by the planner for "auto"
 }
 type DataPoint struct {
 	Time time.Time `json:"time"`
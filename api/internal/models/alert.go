@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// Alert rule types.
+const (
+	RuleTypeThreshold     = "threshold"      // value outside [Min, Max]
+	RuleTypeDurationAbove = "duration_above" // value above Max for at least Duration
+	RuleTypeRateOfChange  = "rate_of_change" // |Δvalue|/Δt above MaxRate (units per second)
+	RuleTypeMissingData   = "missing_data"   // no point received for Duration
+	RuleTypeAnomaly       = "anomaly"        // |score| against the last Window points at least Threshold
+)
+
+// Data sources an alert rule can watch.
+const (
+	SourceSensor      = "sensor"      // sensor_data in the location bucket
+	SourceConsumption = "consumption" // consumption_data bucket
+)
+
+// Alert states.
+const (
+	AlertStateFiring   = "firing"
+	AlertStateResolved = "resolved"
+)
+
+// AlertRule is a server-side check evaluated against every incoming point.
+// Hysteresis is the margin the value must move back past the limit before a firing alert resolves.
+type AlertRule struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Source     string   `json:"source"` // "sensor" or "consumption"
+	LocationID string   `json:"location_id"`
+	DeviceID   string   `json:"device_id,omitempty"` // Empty matches every device of the location (sensor rules only)
+	Field      string   `json:"field"`
+	Min        *float64 `json:"min,omitempty"`
+	Max        *float64 `json:"max,omitempty"`
+	MaxRate    float64  `json:"max_rate,omitempty"`
+	Duration   string   `json:"duration,omitempty"`  // e.g. "5m", for duration_above and missing_data
+	Method     string   `json:"method,omitempty"`    // Anomaly rules: "zscore" or "mad"
+	Window     int      `json:"window,omitempty"`    // Anomaly rules: trailing points of the baseline
+	Threshold  float64  `json:"threshold,omitempty"` // Anomaly rules: absolute score
+	Hysteresis float64  `json:"hysteresis,omitempty"`
+	Severity   string   `json:"severity,omitempty"` // e.g. "info", "warning", "critical"
+	Enabled    bool     `json:"enabled"`
+}
+
+// AlertEvent is a state transition of a rule for one device, stored in the "alerts" measurement.
+type AlertEvent struct {
+	Time       time.Time `json:"time"`
+	RuleID     string    `json:"rule_id"`
+	RuleName   string    `json:"rule_name"`
+	RuleType   string    `json:"rule_type"`
+	LocationID string    `json:"location_id"`
+	DeviceID   string    `json:"device_id"`
+	Field      string    `json:"field"`
+	State      string    `json:"state"`
+	Severity   string    `json:"severity"`
+	Value      *float64  `json:"value"`
+	Message    string    `json:"message"`
+}
+
+// MetricPoint is a single field value received by the API, as seen by the rules engine.
+type MetricPoint struct {
+	Source     string
+	LocationID string
+	DeviceID   string
+	Field      string
+	Value      float64
+	Time       time.Time
+}
+
+// AlertHistoryRequest filters the stored alert events.
+type AlertHistoryRequest struct {
+	LocationID     string `json:"location_id"`
+	DeviceID       string `json:"device_id"`
+	RuleID         string `json:"rule_id"`
+	State          string `json:"state"`
+	TimeRangeStart string `json:"time_range_start"`
+	TimeRangeStop  string `json:"time_range_stop"`
+}
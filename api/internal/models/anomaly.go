@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// Anomaly detection methods.
+const (
+	AnomalyMethodZScore   = "zscore"   // (value - mean) / stddev of the trailing window
+	AnomalyMethodMAD      = "mad"      // 0.6745 * (value - median) / median absolute deviation of the trailing window
+	AnomalyMethodSeasonal = "seasonal" // robust score against the same hour (and weekday) in the baseline history
+)
+
+// Seasonal baseline slots.
+const (
+	SeasonalityHourOfDay = "hour_of_day"
+	SeasonalityDayOfWeek = "day_of_week" // Hour of the day of each weekday
+)
+
+// AnomalyRequest asks for the anomalous intervals of the aggregated series of a field over a time range.
+type AnomalyRequest struct {
+	Source         string   `json:"source"`      // "sensor" or "consumption"
+	LocationID     string   `json:"location_id"` // Sensor source only
+	DeviceID       string   `json:"device_id"`
+	Field          string   `json:"field"`
+	TimeRangeStart string   `json:"time_range_start"`
+	TimeRangeStop  string   `json:"time_range_stop"`
+	WindowPeriod   string   `json:"window_period"`
+	Timezone       string   `json:"timezone"`
+	Unit           string   `json:"unit"`
+	Method         string   `json:"method"`         // "zscore" (default), "mad" or "seasonal"
+	Threshold      *float64 `json:"threshold"`      // Absolute score from which a window is anomalous
+	RollingWindow  int      `json:"rolling_window"` // Trailing windows of the rolling methods
+	Seasonality    string   `json:"seasonality"`    // Seasonal method: "hour_of_day" (default) or "day_of_week"
+	Baseline       string   `json:"baseline"`       // Seasonal method: history before the range, e.g. "4w"
+	IncludeScores  bool     `json:"include_scores"`
+}
+
+// AnomalyScore is the score of one window against its baseline. Score is null when the window has no value or its
+// baseline is not known.
+type AnomalyScore struct {
+	Time      time.Time `json:"time"`
+	Value     *float64  `json:"value"`
+	Expected  *float64  `json:"expected"`
+	Score     *float64  `json:"score"`
+	Anomalous bool      `json:"anomalous"`
+}
+
+// AnomalyInterval groups consecutive anomalous windows deviating in the same direction.
+type AnomalyInterval struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Direction string    `json:"direction"` // "above" or "below" the expected value
+	Windows   int       `json:"windows"`
+	PeakTime  time.Time `json:"peak_time"`
+	PeakValue float64   `json:"peak_value"`
+	PeakScore float64   `json:"peak_score"`
+	Expected  float64   `json:"expected"` // Expected value at the peak
+}
+
+// AnomalyResponse lists the anomalous intervals of a field, oldest first.
+type AnomalyResponse struct {
+	DeviceID     string            `json:"device_id"`
+	Field        string            `json:"field"`
+	Unit         string            `json:"unit,omitempty"`
+	Method       string            `json:"method"`
+	Threshold    float64           `json:"threshold"`
+	WindowPeriod string            `json:"window_period"`
+	Seasonality  string            `json:"seasonality,omitempty"`
+	Anomalies    []AnomalyInterval `json:"anomalies"`
+	Scores       []AnomalyScore    `json:"scores,omitempty"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// Device event types.
+const (
+	DeviceEventHeartbeat = "heartbeat" // Periodic liveness signal, e.g. every 5s
+	DeviceEventStatus    = "status"    // Status transition, e.g. "online", "running_plan" or "offline"
+)
+
+// DeviceStatusOffline is the status a device publishes when it disconnects gracefully.
+const DeviceStatusOffline = "offline"
+
+// DeviceEvent is a heartbeat or status transition, as published by the devices on devices/heartbeat/{deviceID} and
+// devices/status/{deviceID}.
+type DeviceEvent struct {
+	DeviceID  string    `json:"device_id"`
+	Type      string    `json:"type"` // Set from the endpoint
+	Status    string    `json:"status"`
+	Timestamp string    `json:"timestamp"`
+	Time      time.Time `json:"-"` // Parsed timestamp, set when reading back from InfluxDB
+	// Gap is the time since the previous event of the device, when known.
+	Gap *time.Duration `json:"-"`
+}
+
+// AvailabilityRequest asks for the availability of the devices of a location over a time range.
+type AvailabilityRequest struct {
+	LocationID     string   `json:"location_id"`
+	DeviceIDs      []string `json:"device_id"` // The location devices when empty
+	TimeRangeStart string   `json:"time_range_start"`
+	TimeRangeStop  string   `json:"time_range_stop"`
+	Timeout        string   `json:"timeout"` // Silence after which a device is offline, e.g. "30s"
+}
+
+// Outage is a period during which a device was offline.
+type Outage struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+// Availability summarises the online time of a device, or of a whole location, over a time range.
+// MTBF is the uptime divided by the number of outages and MTTR the downtime divided by it; both are null without
+// outage.
+type Availability struct {
+	UptimePercent   float64  `json:"uptime_percent"`
+	UptimeSeconds   float64  `json:"uptime_seconds"`
+	DowntimeSeconds float64  `json:"downtime_seconds"`
+	OutageCount     int      `json:"outage_count"`
+	MTBFSeconds     *float64 `json:"mtbf_seconds"`
+	MTTRSeconds     *float64 `json:"mttr_seconds"`
+}
+
+// DeviceAvailability is the availability of one device with its outages.
+type DeviceAvailability struct {
+	DeviceID string `json:"device_id"`
+	Availability
+	Outages []Outage `json:"outages"`
+}
+
+// AvailabilityResponse is the availability of a location and of each of its devices.
+type AvailabilityResponse struct {
+	LocationID string               `json:"location_id"`
+	Start      time.Time            `json:"start"`
+	Stop       time.Time            `json:"stop"`
+	Timeout    string               `json:"timeout"`
+	Location   Availability         `json:"location"`
+	Devices    []DeviceAvailability `json:"devices"`
+}
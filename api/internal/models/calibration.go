@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// CalibrationProfile corrects the raw values of one sensor from EffectiveFrom onwards.
+// When Polynomial is set (coefficients in ascending order, c0 + c1*x + c2*x² ...) it replaces Offset/Gain,
+// otherwise the calibrated value is raw*Gain + Offset.
+type CalibrationProfile struct {
+	ID            string    `json:"id"`
+	DeviceID      string    `json:"device_id"`
+	SensorID      string    `json:"sensor_id"`
+	Offset        float64   `json:"offset"`
+	Gain          *float64  `json:"gain,omitempty"` // Defaults to 1
+	Polynomial    []float64 `json:"polynomial,omitempty"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	Comment       string    `json:"comment,omitempty"`
+}
+
+// RecomputeCalibrationRequest asks to reapply the calibration profiles of a sensor to stored data.
+type RecomputeCalibrationRequest struct {
+	LocationID     string `json:"location_id"`
+	Field          string `json:"field"`
+	TimeRangeStart string `json:"time_range_start"`
+	TimeRangeStop  string `json:"time_range_stop"`
+}
+
+// RecomputeCalibrationResponse reports how many points were rewritten.
+type RecomputeCalibrationResponse struct {
+	SensorID        string `json:"sensor_id"`
+	PointsRewritten int    `json:"points_rewritten"`
+}
+
+// RawSensorPoint is a stored sensor value together with its uncalibrated value.
+type RawSensorPoint struct {
+	Time     time.Time
+	Value    float64
+	RawValue float64
+	// Tags are the tags the point was stored with, quality flags included; they are part of its series key.
+	Tags map[string]string
+}
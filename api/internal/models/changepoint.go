@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Change-point cost functions.
+const (
+	ChangePointCostMean    = "mean"    // Shifts of the level, the variance being estimated once for the whole series
+	ChangePointCostMeanVar = "meanvar" // Shifts of the level and/or of the variance
+)
+
+// ChangePointRequest asks for the change points of the aggregated series of a field over a time range.
+type ChangePointRequest struct {
+	Source         string   `json:"source"`      // "sensor" or "consumption"
+	LocationID     string   `json:"location_id"` // Sensor source only
+	DeviceID       string   `json:"device_id"`
+	Field          string   `json:"field"`
+	TimeRangeStart string   `json:"time_range_start"`
+	TimeRangeStop  string   `json:"time_range_stop"`
+	WindowPeriod   string   `json:"window_period"`
+	Timezone       string   `json:"timezone"`
+	Unit           string   `json:"unit"`
+	Cost           string   `json:"cost"`        // "meanvar" (default) or "mean"
+	Penalty        *float64 `json:"penalty"`     // Cost of a change point, BIC by default
+	MinSegment     int      `json:"min_segment"` // Fewest windows with a value between two change points
+}
+
+// Segment describes the windows between two change points.
+type Segment struct {
+	Start    time.Time `json:"start"` // Time of the first window of the segment
+	End      time.Time `json:"end"`   // Time of the last window of the segment
+	Windows  int       `json:"windows"`
+	Mean     float64   `json:"mean"`
+	Variance float64   `json:"variance"` // Population variance
+}
+
+// ChangePoint is a change of behavior of the series, between the segment before and the segment after it.
+type ChangePoint struct {
+	Time      time.Time `json:"time"` // Time of the first window after the change
+	Before    Segment   `json:"before"`
+	After     Segment   `json:"after"`
+	MeanShift float64   `json:"mean_shift"` // After mean minus before mean
+}
+
+// ChangePointResponse lists the change points of a field, oldest first, and the segments they delimit.
+type ChangePointResponse struct {
+	DeviceID     string        `json:"device_id"`
+	Field        string        `json:"field"`
+	Unit         string        `json:"unit,omitempty"`
+	WindowPeriod string        `json:"window_period"`
+	Cost         string        `json:"cost"`
+	Penalty      float64       `json:"penalty"`
+	ChangePoints []ChangePoint `json:"change_points"`
+	Segments     []Segment     `json:"segments"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// ComparisonRequest compares the aggregated series of a field over a base range with the same range shifted back by
+// one or more offsets.
+type ComparisonRequest struct {
+	Source         string   `json:"source"`      // "sensor" or "consumption"
+	LocationID     string   `json:"location_id"` // Sensor source only
+	DeviceID       string   `json:"device_id"`
+	Field          string   `json:"field"` // Sensor field or consumption metric
+	TimeRangeStart string   `json:"time_range_start"`
+	TimeRangeStop  string   `json:"time_range_stop"`
+	Offsets        []string `json:"offset"` // e.g. "1w", "1mo", "1y" or "168h"
+	WindowPeriod   string   `json:"window_period"`
+	Timezone       string   `json:"timezone"`
+	Unit           string   `json:"unit"`
+	Total          string   `json:"total"` // Period total compared: "mean" (default) or "sum"
+}
+
+// ComparisonPoint is a window of a compared period, placed on the time axis relative to the start of its period.
+// Deltas compare the base period with this period at the same relative offset.
+type ComparisonPoint struct {
+	OffsetSeconds float64   `json:"offset_seconds"`
+	Time          time.Time `json:"time"`
+	Value         *float64  `json:"value"`
+	Delta         *float64  `json:"delta,omitempty"`
+	DeltaPercent  *float64  `json:"delta_percent,omitempty"`
+}
+
+// ComparisonPeriod is the series of one period. The deltas are those of the base period against this one, unset for
+// the base period itself.
+type ComparisonPeriod struct {
+	Offset            string            `json:"offset,omitempty"`
+	Start             time.Time         `json:"start"`
+	Stop              time.Time         `json:"stop"`
+	Total             *float64          `json:"total"`
+	TotalDelta        *float64          `json:"total_delta,omitempty"`
+	TotalDeltaPercent *float64          `json:"total_delta_percent,omitempty"`
+	Points            []ComparisonPoint `json:"points"`
+}
+
+// ComparisonResponse overlays the base period and the offset periods.
+type ComparisonResponse struct {
+	Field        string             `json:"field"`
+	Unit         string             `json:"unit,omitempty"`
+	WindowPeriod string             `json:"window_period"`
+	Total        string             `json:"total"`
+	Base         ComparisonPeriod   `json:"base"`
+	Comparisons  []ComparisonPeriod `json:"comparisons"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// CompletenessRequest asks for the completeness of the sensor data of a device over a time range.
+type CompletenessRequest struct {
+	LocationID       string   `json:"location_id"`
+	DeviceID         string   `json:"device_id"`
+	SensorType       []string `json:"sensor_type"` // Optional, every field of the device when empty
+	TimeRangeStart   string   `json:"time_range_start"`
+	TimeRangeStop    string   `json:"time_range_stop"`
+	ExpectedInterval string   `json:"expected_interval"` // Sampling period of the device, e.g. "5s"
+	MinGap           string   `json:"min_gap"`           // Shortest reported gap, three expected intervals by default
+	ExcludeFlagged   bool     `json:"exclude_flagged"`   // Count points carrying quality flags as missing
+}
+
+// Gap is a period without any sample.
+type Gap struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+// FieldSamples is the raw sample statistics of a field over a time range.
+type FieldSamples struct {
+	Count int64
+	First time.Time
+	Last  time.Time
+	Gaps  []Gap // Gaps between consecutive samples, the edges of the range are not included
+}
+
+// FieldCompleteness reports the expected and received samples of a field and its gaps.
+type FieldCompleteness struct {
+	Field               string  `json:"field"`
+	ExpectedSamples     int64   `json:"expected_samples"`
+	ReceivedSamples     int64   `json:"received_samples"`
+	CompletenessPercent float64 `json:"completeness_percent"` // Capped at 100
+	MissingSeconds      float64 `json:"missing_seconds"`      // Total duration of the reported gaps
+	Gaps                []Gap   `json:"gaps"`
+}
+
+// CompletenessResponse is the completeness report of a device.
+type CompletenessResponse struct {
+	LocationID          string              `json:"location_id"`
+	DeviceID            string              `json:"device_id"`
+	Start               time.Time           `json:"start"`
+	Stop                time.Time           `json:"stop"`
+	ExpectedInterval    string              `json:"expected_interval"`
+	MinGap              string              `json:"min_gap"`
+	CompletenessPercent float64             `json:"completeness_percent"` // Over every field
+	Fields              []FieldCompleteness `json:"fields"`
+}
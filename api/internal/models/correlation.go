@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SeriesRef identifies the series of one field of a device: "sensor:<location_id>:<device_id>:<field>" or
+// "consumption:<device_id>:<field>".
+type SeriesRef struct {
+	Source     string `json:"source"`
+	LocationID string `json:"location_id,omitempty"`
+	DeviceID   string `json:"device_id"`
+	Field      string `json:"field"`
+}
+
+// ParseSeriesRef parses the textual form of a series reference.
+func ParseSeriesRef(raw string) (SeriesRef, error) {
+	parts := strings.Split(raw, ":")
+	var ref SeriesRef
+	switch {
+	case len(parts) == 4 && parts[0] == SourceSensor:
+		ref = SeriesRef{Source: SourceSensor, LocationID: parts[1], DeviceID: parts[2], Field: parts[3]}
+	case len(parts) == 3 && parts[0] == SourceConsumption:
+		ref = SeriesRef{Source: SourceConsumption, DeviceID: parts[1], Field: parts[2]}
+	}
+	if ref.Source == "" || ref.DeviceID == "" || ref.Field == "" || (ref.Source == SourceSensor && ref.LocationID == "") {
+		return SeriesRef{}, NewAPIError(ErrorCodeInvalidFormat,
+			fmt.Sprintf("invalid series '%s', expected 'sensor:<location_id>:<device_id>:<field>' or 'consumption:<device_id>:<field>'", raw), nil, http.StatusBadRequest)
+	}
+	return ref, nil
+}
+
+// String returns the textual form of the reference.
+func (r SeriesRef) String() string {
+	if r.Source == SourceSensor {
+		return strings.Join([]string{r.Source, r.LocationID, r.DeviceID, r.Field}, ":")
+	}
+	return strings.Join([]string{r.Source, r.DeviceID, r.Field}, ":")
+}
+
+// CorrelationRequest asks for the correlations between the aggregated series of several fields, possibly from
+// different buckets, aligned on a common window.
+type CorrelationRequest struct {
+	Series         []SeriesRef `json:"series"`
+	TimeRangeStart string      `json:"time_range_start"`
+	TimeRangeStop  string      `json:"time_range_stop"`
+	WindowPeriod   string      `json:"window_period"`
+	Timezone       string      `json:"timezone"`
+	MaxLag         *int        `json:"max_lag"` // Largest shift of the cross-correlation, in windows
+	IncludeScatter bool        `json:"include_scatter"`
+}
+
+// CorrelationSeries describes a correlated series.
+type CorrelationSeries struct {
+	SeriesRef
+	ID     string `json:"id"` // Textual form of the reference, used by the pairs
+	Unit   string `json:"unit,omitempty"`
+	Values int    `json:"values"` // Non-empty windows
+}
+
+// LagCorrelation is the Pearson correlation of X with Y shifted by Lag windows: a positive lag compares X with the
+// later values of Y, i.e. Y following X.
+type LagCorrelation struct {
+	Lag     int      `json:"lag"`
+	Pairs   int      `json:"pairs"`
+	Pearson *float64 `json:"pearson"`
+}
+
+// ScatterPoint is a window where both series of a pair have a value.
+type ScatterPoint struct {
+	Time time.Time `json:"time"`
+	X    float64   `json:"x"`
+	Y    float64   `json:"y"`
+}
+
+// CorrelationPair holds the correlations of two series. Coefficients are null with fewer than three pairs of values
+// or when a series is constant.
+type CorrelationPair struct {
+	X                string           `json:"x"`
+	Y                string           `json:"y"`
+	Pairs            int              `json:"pairs"` // Windows where both series have a value
+	Pearson          *float64         `json:"pearson"`
+	Spearman         *float64         `json:"spearman"`
+	CrossCorrelation []LagCorrelation `json:"cross_correlation"`
+	BestLag          *LagCorrelation  `json:"best_lag"` // Lag with the strongest absolute correlation
+	Scatter          []ScatterPoint   `json:"scatter,omitempty"`
+}
+
+// CorrelationResponse lists the correlations of every pair of requested series.
+type CorrelationResponse struct {
+	WindowPeriod string              `json:"window_period"`
+	Series       []CorrelationSeries `json:"series"`
+	Pairs        []CorrelationPair   `json:"pairs"`
+}
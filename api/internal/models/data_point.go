@@ -10,4 +10,11 @@ type SensorData struct {
 	Field     string    `json:"field"`
 	Value     float64   `json:"value"`
 	Timestamp string    `json:"timestamp"`
+	Unit      string    `json:"unit,omitempty"` // Optional, defaults to the canonical unit of the field
+	// RawValue is the value before calibration, set by the service when a calibration profile applies.
+	RawValue *float64 `json:"-"`
+	// QualityFlags are set by the service when the value looks wrong (see models.QualityFlag*).
+	QualityFlags []string `json:"-"`
+	// Tags are the stored tags of a point rewritten by the service, kept so that it overwrites itself.
+	Tags map[string]string `json:"-"`
 }
@@ -0,0 +1,94 @@
+package models
+
+import "time"
+
+// DegreeDaysRequest asks for the heating and cooling degree-days of a location, computed from the daily mean of its
+// outdoor temperature sensor.
+type DegreeDaysRequest struct {
+	LocationID      string   `json:"location_id"`
+	TimeRangeStart  string   `json:"time_range_start"`
+	TimeRangeStop   string   `json:"time_range_stop"`
+	Timezone        string   `json:"timezone"`
+	OutdoorDeviceID string   `json:"outdoor_device_id"` // The configured outdoor sensor of the location when empty
+	OutdoorField    string   `json:"outdoor_field"`
+	HeatingBase     *float64 `json:"heating_base"` // °C, the configured base when nil
+	CoolingBase     *float64 `json:"cooling_base"`
+}
+
+// DegreeDay is the mean outdoor temperature of a local day and its degree-days.
+type DegreeDay struct {
+	Day             time.Time `json:"day"` // Local midnight
+	MeanTemperature float64   `json:"mean_temperature"`
+	HDD             float64   `json:"hdd"`
+	CDD             float64   `json:"cdd"`
+}
+
+// DegreeDaysResponse holds the degree-days of every day with outdoor temperature data and their totals.
+type DegreeDaysResponse struct {
+	LocationID      string      `json:"location_id"`
+	OutdoorDeviceID string      `json:"outdoor_device_id"`
+	OutdoorField    string      `json:"outdoor_field"`
+	Timezone        string      `json:"timezone"`
+	HeatingBase     float64     `json:"heating_base"`
+	CoolingBase     float64     `json:"cooling_base"`
+	HDD             float64     `json:"hdd"`
+	CDD             float64     `json:"cdd"`
+	Days            []DegreeDay `json:"days"`
+}
+
+// WeatherNormalizationRequest asks for the energy of consumption devices normalized by degree-days.
+type WeatherNormalizationRequest struct {
+	DegreeDaysRequest
+	DeviceIDs []string `json:"device_id"` // The location devices when empty
+	Period    string   `json:"period"`    // e.g. "1mo", the whole range when empty
+}
+
+// DegreeDayBaseline is the linear regression of the daily energy on the daily degree-days:
+// energy = Intercept + HeatingSlope * HDD + CoolingSlope * CDD. A slope is nil when the range has no such
+// degree-days.
+type DegreeDayBaseline struct {
+	Intercept    float64  `json:"intercept"`
+	HeatingSlope *float64 `json:"heating_slope"`
+	CoolingSlope *float64 `json:"cooling_slope"`
+	RSquared     *float64 `json:"r_squared"`
+	Days         int      `json:"days"`
+}
+
+// NormalizedDay is the energy of a local day with its degree-days and the energy expected by the baseline.
+type NormalizedDay struct {
+	Day            time.Time `json:"day"`
+	Energy         float64   `json:"energy"`
+	HDD            float64   `json:"hdd"`
+	CDD            float64   `json:"cdd"`
+	ExpectedEnergy *float64  `json:"expected_energy"`
+}
+
+// NormalizedPeriod sums the days of a period with both energy and temperature data.
+type NormalizedPeriod struct {
+	Start              time.Time `json:"start"`
+	Stop               time.Time `json:"stop"`
+	Days               int       `json:"days"`
+	Energy             float64   `json:"energy"`
+	HDD                float64   `json:"hdd"`
+	CDD                float64   `json:"cdd"`
+	EnergyPerDegreeDay *float64  `json:"energy_per_degree_day"` // nil without degree-days
+	ExpectedEnergy     *float64  `json:"expected_energy"`
+	Deviation          *float64  `json:"deviation"`         // Energy - ExpectedEnergy
+	DeviationPercent   *float64  `json:"deviation_percent"` // Relative to ExpectedEnergy
+}
+
+// WeatherNormalizationResponse holds the energy of the devices per day and per period, normalized by degree-days,
+// and the regression baseline of the range. Baseline is nil when there are too few days to fit it.
+type WeatherNormalizationResponse struct {
+	LocationID      string             `json:"location_id"`
+	DeviceIDs       []string           `json:"device_ids"`
+	OutdoorDeviceID string             `json:"outdoor_device_id"`
+	OutdoorField    string             `json:"outdoor_field"`
+	Timezone        string             `json:"timezone"`
+	EnergyUnit      string             `json:"energy_unit"`
+	HeatingBase     float64            `json:"heating_base"`
+	CoolingBase     float64            `json:"cooling_base"`
+	Baseline        *DegreeDayBaseline `json:"baseline"`
+	Periods         []NormalizedPeriod `json:"periods"`
+	Days            []NormalizedDay    `json:"days"`
+}
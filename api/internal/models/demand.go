@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// Load profile shapes.
+const (
+	LoadProfileDaily  = "daily"  // Average demand per time of day
+	LoadProfileWeekly = "weekly" // Average demand per weekday and time of day
+)
+
+// DemandRequest asks for the peak demand and load profile of the power drawn by consumption devices. Demand is the
+// mean power over each demand interval.
+type DemandRequest struct {
+	LocationID     string   `json:"location_id"`
+	DeviceIDs      []string `json:"device_id"` // The location devices when empty
+	TimeRangeStart string   `json:"time_range_start"`
+	TimeRangeStop  string   `json:"time_range_stop"`
+	DemandInterval string   `json:"demand_interval"` // e.g. "15m", dividing a day
+	BillingPeriod  string   `json:"billing_period"`  // e.g. "1mo", the whole range when empty
+	TopN           int      `json:"top_n"`           // Peaks listed per billing period
+	Profile        string   `json:"profile"`         // "daily" (default) or "weekly"
+	Aggregate      bool     `json:"aggregate"`       // Sum the demand of the devices instead of analysing each one
+	Timezone       string   `json:"timezone"`
+	Unit           string   `json:"unit"` // Power unit
+}
+
+// DemandPeak is a demand interval among the highest of its billing period.
+type DemandPeak struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Demand float64   `json:"demand"`
+}
+
+// DemandPeriod summarizes the demand over a billing period. The statistics are null when no interval has data.
+type DemandPeriod struct {
+	Start         time.Time    `json:"start"`
+	Stop          time.Time    `json:"stop"`
+	Intervals     int          `json:"intervals"` // Demand intervals with data
+	PeakDemand    *float64     `json:"peak_demand"`
+	AverageDemand *float64     `json:"average_demand"`
+	BaseLoad      *float64     `json:"base_load"`   // 5th percentile of the demand
+	LoadFactor    *float64     `json:"load_factor"` // Average over peak demand
+	Peaks         []DemandPeak `json:"peaks"`
+}
+
+// LoadProfileSlot is the demand of a time of day (and weekday) averaged over the range.
+type LoadProfileSlot struct {
+	Weekday   string  `json:"weekday,omitempty"` // Weekly profiles only
+	TimeOfDay string  `json:"time_of_day"`       // Start of the demand interval, e.g. "08:15"
+	Mean      float64 `json:"mean"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	Samples   int     `json:"samples"`
+}
+
+// DeviceDemand is the demand analysis of a device, or of the location when the devices are aggregated.
+type DeviceDemand struct {
+	DeviceID string            `json:"device_id,omitempty"`
+	Periods  []DemandPeriod    `json:"periods"`
+	Profile  []LoadProfileSlot `json:"profile"`
+}
+
+// DemandResponse holds the demand analysis of each device, or a single aggregated one.
+type DemandResponse struct {
+	LocationID     string         `json:"location_id"`
+	DeviceIDs      []string       `json:"device_ids"`
+	Aggregated     bool           `json:"aggregated"`
+	Unit           string         `json:"unit"`
+	DemandInterval string         `json:"demand_interval"`
+	Profile        string         `json:"profile"`
+	Timezone       string         `json:"timezone"`
+	Results        []DeviceDemand `json:"results"`
+}
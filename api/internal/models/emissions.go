@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Carbon intensity sources.
+const (
+	IntensityStatic = "static" // Configured factor of the country
+	IntensitySeries = "series" // Time-varying intensity stored in InfluxDB, the static factor filling its gaps
+)
+
+// EmissionsRequest asks for the CO2e emissions of the energy used by consumption devices.
+type EmissionsRequest struct {
+	LocationID     string   `json:"location_id"`
+	DeviceIDs      []string `json:"device_id"` // The location devices when empty
+	TimeRangeStart string   `json:"time_range_start"`
+	TimeRangeStop  string   `json:"time_range_stop"`
+	WindowPeriod   string   `json:"window_period"`
+	Timezone       string   `json:"timezone"`
+	Country        string   `json:"country"`   // Grid zone, the location's country when empty
+	Intensity      string   `json:"intensity"` // "static" (default) or "series"
+}
+
+// EmissionsWindow is the energy used in a window and its emissions. Intensity and Emissions are nil when no carbon
+// intensity is known for the window.
+type EmissionsWindow struct {
+	Time      time.Time `json:"time"`
+	Energy    float64   `json:"energy"`
+	Intensity *float64  `json:"intensity"`
+	Emissions *float64  `json:"emissions"`
+}
+
+// DeviceEmissions holds the emissions of one device. UncoveredEnergy is the energy of the windows without carbon
+// intensity, left out of Emissions.
+type DeviceEmissions struct {
+	DeviceID        string            `json:"device_id"`
+	Energy          float64           `json:"energy"`
+	Emissions       float64           `json:"emissions"`
+	UncoveredEnergy float64           `json:"uncovered_energy"`
+	Windows         []EmissionsWindow `json:"windows"`
+}
+
+// EmissionsResponse holds the emissions of every device and their total for the location.
+type EmissionsResponse struct {
+	LocationID      string            `json:"location_id"`
+	Country         string            `json:"country"`
+	IntensitySource string            `json:"intensity_source"`
+	WindowPeriod    string            `json:"window_period"`
+	Timezone        string            `json:"timezone"`
+	EnergyUnit      string            `json:"energy_unit"`
+	IntensityUnit   string            `json:"intensity_unit"`
+	EmissionsUnit   string            `json:"emissions_unit"`
+	Energy          float64           `json:"energy"`
+	Emissions       float64           `json:"emissions"`
+	UncoveredEnergy float64           `json:"uncovered_energy"`
+	Devices         []DeviceEmissions `json:"devices"`
+}
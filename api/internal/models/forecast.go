@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Forecast models.
+const (
+	ForecastModelHoltWinters   = "holt_winters"   // Additive triple exponential smoothing
+	ForecastModelSeasonalNaive = "seasonal_naive" // Value of the same window one season earlier
+)
+
+// ForecastHorizonEndOfDay is the horizon forecasting until the next midnight in the timezone of the request.
+const ForecastHorizonEndOfDay = "end_of_day"
+
+// ForecastRequest asks for the forecast of the aggregated series of a field from its recent history.
+type ForecastRequest struct {
+	Source         string   `json:"source"`      // "sensor" or "consumption"
+	LocationID     string   `json:"location_id"` // Sensor source only
+	DeviceID       string   `json:"device_id"`
+	Field          string   `json:"field"`
+	History        string   `json:"history"` // History fitted, ending now, e.g. "7d"
+	Horizon        string   `json:"horizon"` // e.g. "6h", "1d" or "end_of_day"
+	WindowPeriod   string   `json:"window_period"`
+	Model          string   `json:"model"`      // "holt_winters" (default) or "seasonal_naive"
+	Season         string   `json:"season"`     // Season length, e.g. "1d" or "1w"
+	Confidence     float64  `json:"confidence"` // Level of the prediction interval, e.g. 0.95
+	Alpha          *float64 `json:"alpha"`      // Holt-Winters smoothing factors, fitted when unset
+	Beta           *float64 `json:"beta"`
+	Gamma          *float64 `json:"gamma"`
+	Timezone       string   `json:"timezone"`
+	Unit           string   `json:"unit"`
+	IncludeHistory bool     `json:"include_history"`
+}
+
+// ForecastPoint is the predicted value of a window with its prediction interval.
+type ForecastPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	Lower float64   `json:"lower"`
+	Upper float64   `json:"upper"`
+}
+
+// ForecastResponse is the forecast of a field with the parameters of the fitted model.
+type ForecastResponse struct {
+	DeviceID     string          `json:"device_id"`
+	Field        string          `json:"field"`
+	Unit         string          `json:"unit,omitempty"`
+	Model        string          `json:"model"`
+	WindowPeriod string          `json:"window_period"`
+	Season       string          `json:"season"`
+	SeasonLength int             `json:"season_length"` // Windows per season
+	Alpha        *float64        `json:"alpha,omitempty"`
+	Beta         *float64        `json:"beta,omitempty"`
+	Gamma        *float64        `json:"gamma,omitempty"`
+	RMSE         float64         `json:"rmse"` // Root mean squared one-step error over the history
+	Confidence   float64         `json:"confidence"`
+	History      []DataPoint     `json:"history,omitempty"`
+	Forecast     []ForecastPoint `json:"forecast"`
+}
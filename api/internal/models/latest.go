@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// LatestValue is the most recent reading of a field.
+type LatestValue struct {
+	Value        float64   `json:"value"`
+	Time         time.Time `json:"time"`
+	QualityFlags []string  `json:"quality_flags,omitempty"`
+}
+
+// LatestRequest asks for the most recent reading of the fields of one or many devices of a location.
+type LatestRequest struct {
+	LocationID string   `json:"location_id"`
+	DeviceIDs  []string `json:"device_id"`
+	SensorType []string `json:"sensor_type"` // Optional, every field when empty
+	Units      []string `json:"unit"`        // Output units, matched to the fields by dimension
+}
+
+// DeviceLatest is the most recent reading of each field of a device.
+type DeviceLatest struct {
+	DeviceID string                 `json:"device_id"`
+	Fields   map[string]LatestValue `json:"fields"`
+	Units    map[string]string      `json:"units,omitempty"`
+}
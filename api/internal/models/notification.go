@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Webhook payload formats.
+const (
+	WebhookFormatJSON  = "json"  // {"webhook_id": ..., "events": [...]}
+	WebhookFormatSlack = "slack" // Slack incoming webhook {"text": ...}
+	WebhookFormatTeams = "teams" // Microsoft Teams MessageCard
+)
+
+// Webhook delivers the alert events of a location to an HTTP endpoint.
+// Throttle and GroupWindow apply to each rule separately: a rule notifies at most once per Throttle while firing,
+// and its events raised within GroupWindow are sent together.
+type Webhook struct {
+	ID          string   `json:"id"`
+	LocationID  string   `json:"location_id"`
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Format      string   `json:"format"`             // "json", "slack" or "teams"
+	Secret      string   `json:"secret,omitempty"`   // HMAC-SHA256 key, never returned by the API
+	RuleIDs     []string `json:"rule_ids,omitempty"` // Empty matches every rule of the location
+	Throttle    string   `json:"throttle,omitempty"` // e.g. "15m"
+	GroupWindow string   `json:"group_window,omitempty"`
+	Enabled     bool     `json:"enabled"`
+}
+
+// WebhookPayload is the body sent to "json" webhooks.
+type WebhookPayload struct {
+	WebhookID string       `json:"webhook_id"`
+	Test      bool         `json:"test,omitempty"`
+	Events    []AlertEvent `json:"events"`
+}
+
+// DeadLetter is a notification that could not be delivered after every retry.
+type DeadLetter struct {
+	ID         string       `json:"id"`
+	WebhookID  string       `json:"webhook_id"`
+	LocationID string       `json:"location_id"`
+	Events     []AlertEvent `json:"events"`
+	Attempts   int          `json:"attempts"`
+	LastError  string       `json:"last_error"`
+	FailedAt   time.Time    `json:"failed_at"`
+}
+
+// DeliveryResult reports the outcome of a notification delivery.
+type DeliveryResult struct {
+	WebhookID  string `json:"webhook_id"`
+	Delivered  bool   `json:"delivered"`
+	Attempts   int    `json:"attempts"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Queued is set when the delivery goes on in the background.
+	Queued bool `json:"queued,omitempty"`
+}
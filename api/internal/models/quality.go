@@ -0,0 +1,40 @@
+package models
+
+// Quality flags attached to incoming points. Flagged points carry them, comma-separated, in the "quality" tag;
+// clean points have no such tag.
+const (
+	QualityFlagFlatline     = "flatline"     // the last N values of the series are identical
+	QualityFlagSpike        = "spike"        // the rate of change since the previous value exceeds the field's limit
+	QualityFlagOutOfRange   = "out_of_range" // the value is outside the physically possible range of the field
+	QualityFlagInvalid      = "invalid"      // the value is NaN or infinite and was not stored
+	QualityFlagInconsistent = "inconsistent" // the readings of the point contradict each other, e.g. P above V*I
+)
+
+// ValueRange is an inclusive [Min, Max] range.
+type ValueRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// QualityRequest asks for the quality summary of a device over a time range.
+type QualityRequest struct {
+	LocationID     string `json:"location_id"`
+	DeviceID       string `json:"device_id"`
+	TimeRangeStart string `json:"time_range_start"`
+	TimeRangeStop  string `json:"time_range_stop"`
+}
+
+// FieldQuality summarizes the quality of one field.
+type FieldQuality struct {
+	TotalPoints   int64            `json:"total_points"`
+	FlaggedPoints int64            `json:"flagged_points"`
+	FlaggedRatio  float64          `json:"flagged_ratio"`
+	Flags         map[string]int64 `json:"flags"` // Count of points per flag
+}
+
+// QualitySummary summarizes the quality flags of a device's sensor and consumption data.
+type QualitySummary struct {
+	DeviceID   string                  `json:"device_id"`
+	LocationID string                  `json:"location_id"`
+	Fields     map[string]FieldQuality `json:"fields"`
+}
@@ -1,19 +1,36 @@
 package models
 
 type QueryRequest struct {
-	LocationID     string   `json:"location_id"`
-	DeviceID       string   `json:"device_id"`
-	SensorType     []string `json:"sensor_type"`
-	TimeRangeStart string   `json:"time_range_start"`
-	TimeRangeStop  string   `json:"time_range_stop"`
-	WindowPeriod   string   `json:"window_period"`
+	LocationID      string   `json:"location_id"`
+	DeviceIDs       []string `json:"device_id"` // Queried together, grouped by device in the response
+	SensorType      []string `json:"sensor_type"`
+	TimeRangeStart  string   `json:"time_range_start"`
+	TimeRangeStop   string   `json:"time_range_stop"`
+	WindowPeriod    string   `json:"window_period"`
+	Units           []string `json:"unit"` // Output units, matched to the fields by dimension
+	ExcludeFlagged  bool     `json:"exclude_flagged"`
+	Downsample      string   `json:"downsample"` // "lttb" reduces each series to MaxPoints points
+	MaxPoints       int      `json:"max_points"`
+	Fill            string   `json:"fill"`              // Empty windows: "null" (default), "previous", "linear", "zero" or "none"
+	FillMaxDistance string   `json:"fill_max_distance"` // Longest filled gap, e.g. "10m", unlimited when empty
+	Timezone        string   `json:"timezone"`          // IANA name, calendar windows (1d, 1w, 1mo, 1y) align to its midnight
+	SkipEmpty       bool     `json:"-"`                 // Omit empty windows instead of returning nulls
 }
 
 // ConsumptionQueryRequest defines the structure for querying consumption data.
 type ConsumptionQueryRequest struct {
-	DeviceID       string   `json:"device_id"`
-	Metrics        []string `json:"metrics"`          // e.g., ["current","voltage"]
-	TimeRangeStart string   `json:"time_range_start"` // ISO8601 timestamp
-	TimeRangeStop  string   `json:"time_range_stop"`  // ISO8601 timestamp
-	WindowPeriod   string   `json:"window_period"`    // e.g., "1h", "30m"
+	DeviceID        string   `json:"device_id"`
+	LocationID      string   `json:"location_id"`      // Optional, its timezone (LOCATION_TIMEZONES) applies by default
+	Metrics         []string `json:"metrics"`          // e.g., ["current","voltage"]
+	TimeRangeStart  string   `json:"time_range_start"` // ISO8601 timestamp
+	TimeRangeStop   string   `json:"time_range_stop"`  // ISO8601 timestamp
+	WindowPeriod    string   `json:"window_period"`    // e.g., "1h", "30m"
+	Units           []string `json:"unit"`             // Output units, e.g. ["kW"]
+	ExcludeFlagged  bool     `json:"exclude_flagged"`  // Skip points carrying quality flags
+	Downsample      string   `json:"downsample"`       // "lttb" reduces each series to MaxPoints points
+	MaxPoints       int      `json:"max_points"`
+	Fill            string   `json:"fill"`              // Empty windows: "null" (default), "previous", "linear", "zero" or "none"
+	FillMaxDistance string   `json:"fill_max_distance"` // Longest filled gap, e.g. "10m", unlimited when empty
+	Timezone        string   `json:"timezone"`          // IANA name, calendar windows (1d, 1w, 1mo, 1y) align to its midnight
+	SkipEmpty       bool     `json:"-"`                 // Omit empty windows instead of returning nulls
 }
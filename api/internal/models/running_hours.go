@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// RunningHoursReq is the running hours counter of one device component, as published by the devices.
+type RunningHoursReq struct {
+	DeviceID        string   `json:"device_id"`
+	ComponentID     string   `json:"component_id"`
+	RunningHours    float64  `json:"running_hours"`
+	MaxRunningHours *float64 `json:"max_running_hours,omitempty"` // Maintenance interval, stored when provided
+	Timestamp       string   `json:"timestamp"`
+}
+
+// ComponentUsage is the running hours history of a component over the lookback period.
+type ComponentUsage struct {
+	DeviceID        string
+	ComponentID     string
+	FirstTime       time.Time
+	LastTime        time.Time
+	LastHours       float64
+	Increase        float64 // Running hours accumulated over the period, ignoring counter resets
+	MaxRunningHours *float64
+}
+
+// MaintenanceRequest asks for the maintenance forecast of a location.
+type MaintenanceRequest struct {
+	LocationID string   `json:"location_id"`
+	DeviceIDs  []string `json:"device_id"` // The location devices when empty
+	Horizon    string   `json:"horizon"`   // e.g. "720h", components due later are not listed unless IncludeAll
+	Lookback   string   `json:"lookback"`  // Period used to estimate the usage rate, e.g. "168h"
+	IncludeAll bool     `json:"include_all"`
+}
+
+// MaintenanceForecast projects when a component reaches its maximum running hours.
+type MaintenanceForecast struct {
+	DeviceID        string     `json:"device_id"`
+	ComponentID     string     `json:"component_id"`
+	RunningHours    float64    `json:"running_hours"`
+	MaxRunningHours float64    `json:"max_running_hours"`
+	RemainingHours  float64    `json:"remaining_hours"`
+	UsageRate       float64    `json:"usage_rate"` // Running hours per hour of wall-clock time
+	LastUpdate      time.Time  `json:"last_update"`
+	ProjectedDueAt  *time.Time `json:"projected_due_at"` // Null when the component is not running
+	Overdue         bool       `json:"overdue"`
+	DueWithin       bool       `json:"due_within_horizon"`
+}
+
+// MaintenanceResponse lists the maintenance forecasts of a location, soonest first.
+type MaintenanceResponse struct {
+	LocationID string                `json:"location_id"`
+	Horizon    string                `json:"horizon"`
+	Components []MaintenanceForecast `json:"components"`
+}
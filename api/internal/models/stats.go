@@ -0,0 +1,46 @@
+package models
+
+// StatsRequest asks for the distribution of sensor fields or consumption metrics of a device over a time range.
+type StatsRequest struct {
+	Source         string   `json:"source"`      // "sensor" or "consumption"
+	LocationID     string   `json:"location_id"` // Sensor source only
+	DeviceID       string   `json:"device_id"`
+	Fields         []string `json:"fields"`
+	TimeRangeStart string   `json:"time_range_start"`
+	TimeRangeStop  string   `json:"time_range_stop"`
+	Bins           int      `json:"bins"`     // Histogram bins, 10 by default
+	HistMin        *float64 `json:"hist_min"` // Histogram range, the observed range by default
+	HistMax        *float64 `json:"hist_max"`
+	Units          []string `json:"unit"`
+	ExcludeFlagged bool     `json:"exclude_flagged"`
+}
+
+// HistogramBin counts the values in [Lower, Upper), the last bin also includes Upper.
+type HistogramBin struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int     `json:"count"`
+}
+
+// FieldStats describes the distribution of a field. The statistics are null when there is no value.
+type FieldStats struct {
+	Field     string         `json:"field"`
+	Unit      string         `json:"unit,omitempty"`
+	Count     int            `json:"count"`
+	Min       *float64       `json:"min"`
+	Max       *float64       `json:"max"`
+	Mean      *float64       `json:"mean"`
+	Median    *float64       `json:"median"`
+	StdDev    *float64       `json:"stddev"` // Population standard deviation
+	P5        *float64       `json:"p5"`
+	P95       *float64       `json:"p95"`
+	P99       *float64       `json:"p99"`
+	Histogram []HistogramBin `json:"histogram"`
+	Outside   int            `json:"outside_histogram,omitempty"` // Values outside HistMin/HistMax
+}
+
+// StatsResponse is the distribution of each requested field of a device.
+type StatsResponse struct {
+	DeviceID string       `json:"device_id"`
+	Fields   []FieldStats `json:"fields"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// LoadTimezone loads an IANA timezone that Flux can use. "Local", the timezone of the server, is accepted by Go but
+// unknown to Flux, so it is rejected.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, fmt.Errorf("unknown time zone %s", name)
+	}
+	return time.LoadLocation(name)
+}
@@ -0,0 +1,17 @@
+package models
+
+// UnitDefinition describes a unit relative to the canonical unit of its dimension.
+// A value expressed in this unit is converted to canonical with: canonical = value*Scale + Offset.
+type UnitDefinition struct {
+	Symbol    string  `json:"symbol"`
+	Dimension string  `json:"dimension"` // e.g. "temperature", "power"
+	Scale     float64 `json:"scale"`
+	Offset    float64 `json:"offset"`
+}
+
+// FieldUnit binds a stored field (sensor type or consumption metric) to its canonical unit.
+type FieldUnit struct {
+	Field         string `json:"field"`
+	Dimension     string `json:"dimension"`
+	CanonicalUnit string `json:"canonical_unit"`
+}
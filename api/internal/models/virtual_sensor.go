@@ -0,0 +1,21 @@
+package models
+
+// VirtualSensor is a computed sensor_type of a location, evaluated at query time from the aggregated windows of its
+// inputs, e.g. a dew point from temperature and humidity.
+type VirtualSensor struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"` // sensor_type it is queried as
+	LocationID  string         `json:"location_id"`
+	DeviceID    string         `json:"device_id,omitempty"` // Empty makes it available on every device of the location
+	Expression  string         `json:"expression"`          // e.g. "supply - return"
+	Inputs      []VirtualInput `json:"inputs"`
+	Unit        string         `json:"unit,omitempty"` // Unit of the result, convertible when it is a known unit
+	Description string         `json:"description,omitempty"`
+}
+
+// VirtualInput binds a variable of a virtual sensor expression to a stored field of a device of the location.
+type VirtualInput struct {
+	Name     string `json:"name"`
+	DeviceID string `json:"device_id,omitempty"` // Empty means the queried device
+	Field    string `json:"field"`
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"CapIot.influxDB/internal/models"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+)
+
+// AlertsBucket stores the alert events of every location in the "alerts" measurement.
+const AlertsBucket = "alerts"
+
+// WriteAlertEvent stores an alert state transition.
+func (r *InfluxDBRepository) WriteAlertEvent(ctx context.Context, event models.AlertEvent) error {
+	if err := r.ensureBucket(ctx, AlertsBucket); err != nil {
+		return err
+	}
+
+	tags := map[string]string{
+		"location_id": event.LocationID,
+		"device_id":   event.DeviceID,
+		"rule_id":     event.RuleID,
+		"field":       event.Field,
+		"state":       event.State,
+	}
+	fields := map[string]interface{}{
+		"rule_name": event.RuleName,
+		"rule_type": event.RuleType,
+		"severity":  event.Severity,
+		"message":   event.Message,
+	}
+	if event.Value != nil && isFinite(*event.Value) {
+		fields["value"] = *event.Value
+	}
+
+	writeAPI := r.client.WriteAPIBlocking(r.org, AlertsBucket)
+	if err := writeAPI.WritePoint(ctx, influxdb2.NewPoint("alerts", tags, fields, event.Time)); err != nil {
+		return fmt.Errorf("error writing alert event to InfluxDB: %w", err)
+	}
+	log.Printf("Alert %s: rule %s, device %s, field %s", event.State, event.RuleID, event.DeviceID, event.Field)
+	return nil
+}
+
+// QueryAlerts returns the alert events of a location matching the request filters, most recent first.
+func (r *InfluxDBRepository) QueryAlerts(ctx context.Context, req models.AlertHistoryRequest, start, stop time.Time) ([]models.AlertEvent, error) {
+	events := []models.AlertEvent{}
+
+	exists, err := r.BucketExists(ctx, AlertsBucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return events, nil
+	}
+
+	filters := []string{fmt.Sprintf(`r["location_id"] == "%s"`, req.LocationID)}
+	if req.DeviceID != "" {
+		filters = append(filters, fmt.Sprintf(`r["device_id"] == "%s"`, req.DeviceID))
+	}
+	if req.RuleID != "" {
+		filters = append(filters, fmt.Sprintf(`r["rule_id"] == "%s"`, req.RuleID))
+	}
+	if req.State != "" {
+		filters = append(filters, fmt.Sprintf(`r["state"] == "%s"`, req.State))
+	}
+
+	fluxQuery := fmt.Sprintf(`
+       from(bucket: "%s")
+       |> range(start: %s, stop: %s)
+       |> filter(fn: (r) => r["_measurement"] == "alerts")
+       |> filter(fn: (r) => %s)
+       |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")
+       |> group()
+       |> sort(columns: ["_time"], desc: true)
+    `, AlertsBucket, start.Format(time.RFC3339), stop.Format(time.RFC3339), strings.Join(filters, " and "))
+	log.Printf("Executing InfluxDB alerts query: %s", fluxQuery)
+
+	result, err := r.client.QueryAPI(r.org).Query(ctx, fluxQuery)
+	if err != nil {
+		log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, fluxQuery)
+		return nil, fmt.Errorf("error querying InfluxDB: %w", err)
+	}
+	for result.Next() {
+		record := result.Record()
+		event := models.AlertEvent{Time: record.Time()}
+		event.LocationID, _ = record.ValueByKey("location_id").(string)
+		event.DeviceID, _ = record.ValueByKey("device_id").(string)
+		event.RuleID, _ = record.ValueByKey("rule_id").(string)
+		event.Field, _ = record.ValueByKey("field").(string)
+		event.State, _ = record.ValueByKey("state").(string)
+		event.RuleName, _ = record.ValueByKey("rule_name").(string)
+		event.RuleType, _ = record.ValueByKey("rule_type").(string)
+		event.Severity, _ = record.ValueByKey("severity").(string)
+		event.Message, _ = record.ValueByKey("message").(string)
+		if v, ok := toFloat(record.ValueByKey("value")); ok {
+			event.Value = &v
+		}
+		events = append(events, event)
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("query processing error: %w", result.Err())
+	}
+	return events, nil
+}
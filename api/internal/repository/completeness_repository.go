@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"CapIot.influxDB/internal/models"
+)
+
+// QuerySampleStats returns, for each sensor field of a device, the number of samples between start and stop, the
+// first and last sample times and the gaps longer than minGap between consecutive samples. Fields are grouped as in
+// Query, so the samples of every sensor of a field count together.
+func (r *InfluxDBRepository) QuerySampleStats(ctx context.Context, req models.CompletenessRequest, start, stop time.Time, minGap time.Duration) (map[string]*models.FieldSamples, error) {
+	exists, err := r.BucketExists(ctx, req.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return map[string]*models.FieldSamples{}, nil
+	}
+
+	fieldFilter := `r["_field"] !~ /_raw$|_invalid$/`
+	if len(req.SensorType) > 0 {
+		fieldFilter = createMetricFilterClause(req.SensorType)
+	}
+	base := fmt.Sprintf(`
+       from(bucket: "%s")
+       |> range(start: %s, stop: %s)
+       |> filter(fn: (r) => r["_measurement"] == "sensor_data")
+       |> filter(fn: (r) => r["device_id"] == "%s")
+       |> filter(fn: (r) => %s)%s
+       |> group(columns: ["device_id", "_field"]) // merge the per-sensor series of a field`,
+		req.LocationID, start.Format(time.RFC3339), stop.Format(time.RFC3339), req.DeviceID, fieldFilter, qualityFilterClause(req.ExcludeFlagged))
+
+	stats := make(map[string]*models.FieldSamples)
+	get := func(field string) *models.FieldSamples {
+		s, ok := stats[field]
+		if !ok {
+			s = &models.FieldSamples{Gaps: []models.Gap{}}
+			stats[field] = s
+		}
+		return s
+	}
+
+	queries := []struct {
+		flux  string
+		apply func(s *models.FieldSamples, record recordValues)
+	}{
+		{base + "\n       |> count()", func(s *models.FieldSamples, rec recordValues) {
+			if n, ok := toFloat(rec.value); ok {
+				s.Count = int64(n)
+			}
+		}},
+		{base + "\n       |> first()", func(s *models.FieldSamples, rec recordValues) { s.First = rec.time }},
+		{base + "\n       |> last()", func(s *models.FieldSamples, rec recordValues) { s.Last = rec.time }},
+		{base + fmt.Sprintf(`
+       |> sort(columns: ["_time"])
+       |> elapsed(unit: 1ms)
+       |> filter(fn: (r) => r["elapsed"] > %d)`, minGap.Milliseconds()), func(s *models.FieldSamples, rec recordValues) {
+			elapsed, ok := toFloat(rec.elapsed)
+			if !ok {
+				return
+			}
+			gapStart := rec.time.Add(-time.Duration(elapsed) * time.Millisecond)
+			s.Gaps = append(s.Gaps, models.Gap{Start: gapStart, End: rec.time, DurationSeconds: rec.time.Sub(gapStart).Seconds()})
+		}},
+	}
+
+	queryAPI := r.client.QueryAPI(r.org)
+	for _, q := range queries {
+		log.Printf("Executing InfluxDB completeness query: %s", q.flux)
+		result, err := queryAPI.Query(ctx, q.flux)
+		if err != nil {
+			log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, q.flux)
+			return nil, fmt.Errorf("error querying InfluxDB: %w", err)
+		}
+		for result.Next() {
+			record := result.Record()
+			q.apply(get(record.Field()), recordValues{
+				time:    record.Time(),
+				value:   record.Value(),
+				elapsed: record.ValueByKey("elapsed"),
+			})
+		}
+		if result.Err() != nil {
+			return nil, fmt.Errorf("query processing error: %w", result.Err())
+		}
+	}
+	return stats, nil
+}
+
+// recordValues holds the columns of a Flux record used by QuerySampleStats.
+type recordValues struct {
+	time    time.Time
+	value   interface{}
+	elapsed interface{}
+}
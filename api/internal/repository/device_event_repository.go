@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"CapIot.influxDB/internal/models"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+)
+
+// WriteDeviceEvent writes a heartbeat or status event to the "device_events" measurement of the location bucket.
+func (r *InfluxDBRepository) WriteDeviceEvent(ctx context.Context, bucket string, event models.DeviceEvent) error {
+	ts := time.Now()
+	if event.Timestamp != "" {
+		parsed, err := time.Parse(time.RFC3339, event.Timestamp)
+		if err != nil {
+			log.Printf("Error parsing timestamp '%s', using current time: %v\n", event.Timestamp, err)
+		} else {
+			ts = parsed
+		}
+	}
+
+	p := influxdb2.NewPoint(
+		"device_events",
+		map[string]string{"device_id": event.DeviceID, "type": event.Type},
+		map[string]interface{}{"status": event.Status},
+		ts,
+	)
+	writeAPI := r.client.WriteAPIBlocking(r.org, bucket)
+	if err := writeAPI.WritePoint(ctx, p); err != nil {
+		return fmt.Errorf("error writing device event to InfluxDB: %w", err)
+	}
+	return nil
+}
+
+// QueryDeviceEvents returns the heartbeat and status events of some devices of a location bucket between start and stop that bound the online periods of the devices, in chronological order: the first and last event of
+// each device, the events following a silence longer than timeout, the offline statuses and the events following
+// them. The silences are detected by InfluxDB, so the events in between are never loaded. Gap is set to the time since
+// the previous event of the device on every event but the first one.
+func (r *InfluxDBRepository) QueryDeviceEvents(ctx context.Context, bucket string, deviceIDs []string, start, stop time.Time, timeout time.Duration) ([]models.DeviceEvent, error) {
+	exists, err := r.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || len(deviceIDs) == 0 {
+		return []models.DeviceEvent{}, nil
+	}
+
+	deviceFilter := fmt.Sprintf(`
+       |> filter(fn: (r) => %s)`, createTagFilterClause("device_id", deviceIDs))
+	fluxQuery := fmt.Sprintf(`
+       import "strings"
+
+       events = from(bucket: "%s")
+       |> range(start: %s, stop: %s)
+       |> filter(fn: (r) => r["_measurement"] == "device_events" and r["_field"] == "status")%s
+       |> group(columns: ["device_id"])
+       |> sort(columns: ["_time"])
+       |> map(fn: (r) => ({r with offline: if strings.toLower(v: r._value) == "%s" then 1 else 0}))
+       |> map(fn: (r) => ({r with gap: int(v: r._time), change: r.offline}))
+       |> difference(columns: ["gap", "change"], keepFirst: true)
+
+       boundaries = events
+       |> filter(fn: (r) => not exists r.gap or r.gap > %d or r.offline == 1 or r.change == -1)
+
+       union(tables: [boundaries, events |> last()])
+       |> keep(columns: ["_time", "_value", "device_id", "type", "gap"])`,
+		bucket, start.Format(time.RFC3339), stop.Format(time.RFC3339), deviceFilter, models.DeviceStatusOffline, timeout.Nanoseconds())
+
+	log.Printf("Executing InfluxDB device events query: %s", fluxQuery)
+	result, err := r.client.QueryAPI(r.org).Query(ctx, fluxQuery)
+	if err != nil {
+		log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, fluxQuery)
+		return nil, fmt.Errorf("error querying InfluxDB: %w", err)
+	}
+
+	events := []models.DeviceEvent{}
+	for result.Next() {
+		record := result.Record()
+		event := models.DeviceEvent{Time: record.Time()}
+		event.DeviceID, _ = record.ValueByKey("device_id").(string)
+		event.Type, _ = record.ValueByKey("type").(string)
+		event.Status, _ = record.Value().(string)
+		if gap, ok := record.ValueByKey("gap").(int64); ok {
+			d := time.Duration(gap)
+			event.Gap = &d
+		}
+		events = append(events, event)
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("query processing error: %w", result.Err())
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	// The last event of a device is returned twice when it is also a boundary
+	deduplicated := events[:0]
+	for i, e := range events {
+		if i > 0 {
+			prev := &deduplicated[len(deduplicated)-1]
+			if prev.DeviceID == e.DeviceID && prev.Type == e.Type && prev.Time.Equal(e.Time) {
+				if prev.Gap == nil {
+					prev.Gap = e.Gap
+				}
+				continue
+			}
+		}
+		deduplicated = append(deduplicated, e)
+	}
+	return deduplicated, nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// CarbonIntensityMeasurement holds the time-varying grid carbon intensity, in gCO2e/kWh in the "intensity" field,
+// tagged by grid zone.
+const CarbonIntensityMeasurement = "carbon_intensity"
+
+// QueryLastEnergy returns the last energy counter value stored for a consumption device and its time. found is false
+// when the device never stored one.
+func (r *InfluxDBRepository) QueryLastEnergy(ctx context.Context, deviceID string) (energy float64, at time.Time, found bool, err error) {
+	exists, err := r.BucketExists(ctx, "consumption_data")
+	if err != nil || !exists {
+		return 0, time.Time{}, false, err
+	}
+
+	fluxQuery := fmt.Sprintf(`
+       from(bucket: "consumption_data")
+       |> range(start: 0)
+       |> filter(fn: (r) => r["_measurement"] == "consumption_data" and r["device_id"] == "%s" and r["_field"] == "energy")
+       |> last()`, deviceID)
+	log.Printf("Executing InfluxDB last energy query: %s", fluxQuery)
+	result, err := r.client.QueryAPI(r.org).Query(ctx, fluxQuery)
+	if err != nil {
+		log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, fluxQuery)
+		return 0, time.Time{}, false, fmt.Errorf("error querying InfluxDB: %w", err)
+	}
+	// Flagged and clean points are separate series, each with its own last value
+	for result.Next() {
+		record := result.Record()
+		if value, ok := toFloat(record.Value()); ok && record.Time().After(at) {
+			energy, at, found = value, record.Time(), true
+		}
+	}
+	if result.Err() != nil {
+		return 0, time.Time{}, false, fmt.Errorf("query processing error: %w", result.Err())
+	}
+	return energy, at, found, nil
+}
+
+// QueryEnergyWindows returns the energy counter of a consumption device at the end of each window with data between
+// start and stop, and its value before start (0 when none). The counter never decreases, so its maximum is its last
+// value whatever the order of the flagged and clean series.
+func (r *InfluxDBRepository) QueryEnergyWindows(ctx context.Context, deviceID, window, timezone string, start, stop time.Time) (float64, []models.DataPoint, error) {
+	exists, err := r.BucketExists(ctx, "consumption_data")
+	if err != nil || !exists {
+		return 0, []models.DataPoint{}, err
+	}
+	filter := fmt.Sprintf(`r["_measurement"] == "consumption_data" and r["device_id"] == "%s" and r["_field"] == "energy"`, deviceID)
+
+	baselineQuery := fmt.Sprintf(`
+       from(bucket: "consumption_data")
+       |> range(start: 0, stop: %s)
+       |> filter(fn: (r) => %s)
+       |> group()
+       |> max()`, start.Format(time.RFC3339), filter)
+	baselines, err := r.queryDataPoints(ctx, baselineQuery)
+	if err != nil {
+		return 0, nil, err
+	}
+	var baseline float64
+	if len(baselines) > 0 {
+		baseline = *baselines[0].Value
+	}
+
+	windowQuery := timezoneImport(timezone) + fmt.Sprintf(`
+       from(bucket: "consumption_data")
+       |> range(start: %s, stop: %s)
+       |> filter(fn: (r) => %s)
+       |> group(columns: ["device_id"])
+       |> aggregateWindow(every: %s, fn: max, createEmpty: false%s)`,
+		start.Format(time.RFC3339), stop.Format(time.RFC3339), filter, window, windowOptions(window, timezone))
+	windows, err := r.queryDataPoints(ctx, windowQuery)
+	if err != nil {
+		return 0, nil, err
+	}
+	return baseline, windows, nil
+}
+
+// QueryCarbonIntensity returns the mean carbon intensity of a grid zone in each window with data between start and
+// stop.
+func (r *InfluxDBRepository) QueryCarbonIntensity(ctx context.Context, bucket, zone, window, timezone string, start, stop time.Time) ([]models.DataPoint, error) {
+	exists, err := r.BucketExists(ctx, bucket)
+	if err != nil || !exists {
+		return []models.DataPoint{}, err
+	}
+	fluxQuery := timezoneImport(timezone) + fmt.Sprintf(`
+       from(bucket: "%s")
+       |> range(start: %s, stop: %s)
+       |> filter(fn: (r) => r["_measurement"] == "%s" and r["zone"] == "%s" and r["_field"] == "intensity")
+       |> group()
+       |> aggregateWindow(every: %s, fn: mean, createEmpty: false%s)`,
+		bucket, start.Format(time.RFC3339), stop.Format(time.RFC3339), CarbonIntensityMeasurement, zone, window, windowOptions(window, timezone))
+	return r.queryDataPoints(ctx, fluxQuery)
+}
+
+// queryDataPoints runs a query returning a single series and collects its non-null values.
+func (r *InfluxDBRepository) queryDataPoints(ctx context.Context, fluxQuery string) ([]models.DataPoint, error) {
+	log.Printf("Executing InfluxDB query: %s", fluxQuery)
+	result, err := r.client.QueryAPI(r.org).Query(ctx, fluxQuery)
+	if err != nil {
+		log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, fluxQuery)
+		return nil, fmt.Errorf("error querying InfluxDB: %w", err)
+	}
+	points := []models.DataPoint{}
+	for result.Next() {
+		if value, ok := toFloat(result.Record().Value()); ok {
+			points = append(points, models.DataPoint{Time: result.Record().Time(), Value: &value})
+		}
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("query processing error: %w", result.Err())
+	}
+	return points, nil
+}
@@ -25,6 +25,26 @@ type Repository interface {
 	WriteConsumptionData(ctx context.Context, req models.ConsumptionReq) error
 	// Signature mise à jour pour utiliser models.ConsumptionQueryRequest
 	QueryConsumptionData(ctx context.Context, req models.ConsumptionQueryRequest) ([]models.ConsumptionQueryResponse, error)
+	WriteSensorDataBatch(ctx context.Context, bucket string, data []models.SensorData) error
+	QueryRawSensorData(ctx context.Context, bucket, deviceID, sensorID, field string, start, stop time.Time) ([]models.RawSensorPoint, error)
+	SaveDocument(ctx context.Context, kind, id string, document []byte) error
+	DeleteDocument(ctx context.Context, kind, id string) error
+	LoadDocuments(ctx context.Context, kind string) (map[string][]byte, error)
+	QueryQualitySummary(ctx context.Context, bucket, measurement, deviceID string, start, stop time.Time) (map[string]models.FieldQuality, error)
+	WriteAlertEvent(ctx context.Context, event models.AlertEvent) error
+	QueryAlerts(ctx context.Context, req models.AlertHistoryRequest, start, stop time.Time) ([]models.AlertEvent, error)
+	WriteRunningHours(ctx context.Context, bucket string, req models.RunningHoursReq) error
+	QueryComponentUsage(ctx context.Context, bucket string, deviceIDs []string, start, stop time.Time) ([]models.ComponentUsage, error)
+	WriteDeviceEvent(ctx context.Context, bucket string, event models.DeviceEvent) error
+	QueryDeviceEvents(ctx context.Context, bucket string, deviceIDs []string, start, stop time.Time, timeout time.Duration) ([]models.DeviceEvent, error)
+	ListDevices(ctx context.Context, bucket, measurement string, start, stop time.Time) ([]string, error)
+	ListBuckets(ctx context.Context) ([]string, error)
+	QueryLatestValues(ctx context.Context, bucket string, deviceIDs []string, lookback time.Duration) (map[string]map[string]models.LatestValue, error)
+	StreamFieldValues(ctx context.Context, bucket, measurement, deviceID string, fields []string, start, stop time.Time, excludeFlagged bool, fn func(field string, value float64) error) error
+	QuerySampleStats(ctx context.Context, req models.CompletenessRequest, start, stop time.Time, minGap time.Duration) (map[string]*models.FieldSamples, error)
+	QueryLastEnergy(ctx context.Context, deviceID string) (float64, time.Time, bool, error)
+	QueryEnergyWindows(ctx context.Context, deviceID, window, timezone string, start, stop time.Time) (float64, []models.DataPoint, error)
+	QueryCarbonIntensity(ctx context.Context, bucket, zone, window, timezone string, start, stop time.Time) ([]models.DataPoint, error)
 }
 
 // InfluxDBRepository is a repository for writing data to InfluxDB.
@@ -51,46 +71,70 @@ func (r *InfluxDBRepository) WriteSensorData(ctx context.Context, data models.Se
 	}
 	writeAPI := r.client.WriteAPIBlocking(r.org, bucket)
 
+	err := writeAPI.WritePoint(ctx, newSensorPoint(data))
+	if err != nil {
+		return fmt.Errorf("error writing to InfluxDB: %w", err)
+	}
+	log.Printf("Data point written to InfluxDB, bucket: %s, device_id: %s, field: %s, value: %f\n", bucket, data.DeviceID, data.Field, data.Value)
+	return nil
+}
+
+// WriteSensorDataBatch writes several sensor data points to the given bucket in a single request.
+func (r *InfluxDBRepository) WriteSensorDataBatch(ctx context.Context, bucket string, data []models.SensorData) error {
+	if len(data) == 0 {
+		return nil
+	}
+	writeAPI := r.client.WriteAPIBlocking(r.org, bucket)
+
+	points := make([]*write.Point, len(data))
+	for i, d := range data {
+		points[i] = newSensorPoint(d)
+	}
+	if err := writeAPI.WritePoint(ctx, points...); err != nil {
+		return fmt.Errorf("error writing to InfluxDB: %w", err)
+	}
+	log.Printf("%d data points written to InfluxDB, bucket: %s\n", len(points), bucket)
+	return nil
+}
+
+// newSensorPoint builds the sensor_data point of a reading. The raw value, when present, is stored in the
+// "<field>_raw" field next to the calibrated value.
+func newSensorPoint(data models.SensorData) *write.Point {
 	// Use a single point with multiple fields for all sensor data.
 	fields := make(map[string]interface{})
 
-	// Add the sensor value to the fields map based on the Field type
-	fields[data.Field] = data.Value
+	// Add the sensor value to the fields map based on the Field type.
+	// InfluxDB cannot store NaN/Inf, such values are only recorded as "<field>_invalid".
+	if isFinite(data.Value) {
+		fields[data.Field] = data.Value
+	} else {
+		fields[data.Field+"_invalid"] = true
+	}
+	if data.RawValue != nil && isFinite(*data.RawValue) {
+		fields[data.Field+"_raw"] = *data.RawValue
+	}
+
+	tags := make(map[string]string, len(data.Tags)+3)
+	for key, value := range data.Tags {
+		tags[key] = value
+	}
+	tags["device_id"] = data.DeviceID
+	if data.SensorID != "" {
+		tags["sensor_id"] = data.SensorID
+	}
+	if len(data.QualityFlags) > 0 {
+		tags["quality"] = strings.Join(data.QualityFlags, ",")
+	}
 
-	var p *write.Point
 	if data.Timestamp != "" { // Check if the Timestamp string is not empty
 		stm32Time, err := time.Parse(time.RFC3339, data.Timestamp)
 		if err != nil {
 			log.Printf("Error parsing timestamp '%s', using current time: %v\n", data.Timestamp, err)
-			p = influxdb2.NewPoint(
-				"sensor_data", // Measurement name.
-				map[string]string{"device_id": data.DeviceID}, // tags
-				fields,
-				time.Now(), //  Use server time
-			)
-		} else {
-			p = influxdb2.NewPoint(
-				"sensor_data", // Measurement name.
-				map[string]string{"device_id": data.DeviceID}, // tags
-				fields,
-				stm32Time, // Use the timestamp from the STM32.
-			)
+			return influxdb2.NewPoint("sensor_data", tags, fields, time.Now()) //  Use server time
 		}
-	} else {
-		p = influxdb2.NewPoint(
-			"sensor_data", // Measurement name.
-			map[string]string{"device_id": data.DeviceID}, // tags
-			fields,
-			time.Now(),
-		)
-	}
-
-	err := writeAPI.WritePoint(ctx, p)
-	if err != nil {
-		return fmt.Errorf("error writing to InfluxDB: %w", err)
+		return influxdb2.NewPoint("sensor_data", tags, fields, stm32Time) // Use the timestamp from the STM32.
 	}
-	log.Printf("Data point written to InfluxDB, bucket: %s, device_id: %s, field: %s, value: %f\n", bucket, data.DeviceID, data.Field, data.Value)
-	return nil
+	return influxdb2.NewPoint("sensor_data", tags, fields, time.Now())
 }
 
 // BucketExists checks if a bucket exists in InfluxDB.
@@ -132,6 +176,20 @@ func (r *InfluxDBRepository) CreateBucket(ctx context.Context, name string) erro
 	return nil
 }
 
+// ensureBucket creates the bucket if it does not exist yet.
+func (r *InfluxDBRepository) ensureBucket(ctx context.Context, name string) error {
+	exists, err := r.BucketExists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := r.CreateBucket(ctx, name); err != nil {
+			return fmt.Errorf("error creating bucket '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
 // Query executes a query against InfluxDB and returns the results as a slice of models.SensorQueryResponse.
 func (r *InfluxDBRepository) Query(req models.QueryRequest) ([]models.SensorQueryResponse, error) {
 	ctx := context.Background()
@@ -169,11 +227,13 @@ func (r *InfluxDBRepository) Query(req models.QueryRequest) ([]models.SensorQuer
        from(bucket: "%s")
        %s
        |> filter(fn: (r) => r["_measurement"] == "sensor_data")
-       |> filter(fn: (r) => r["device_id"] == "%s")
        |> filter(fn: (r) => %s)
-       |> aggregateWindow(every: %s, fn: mean, createEmpty: true)
+       |> filter(fn: (r) => %s)%s
+       |> group(columns: ["device_id", "_field"]) // merge the per-sensor series of a field
+       |> aggregateWindow(every: %s, fn: mean, createEmpty: %t%s)
        |> yield(name: "mean")
-    `, bucketName, rangeClause, req.DeviceID, fieldFilterClause, req.WindowPeriod)
+    `, bucketName, rangeClause, createTagFilterClause("device_id", req.DeviceIDs), fieldFilterClause, qualityFilterClause(req.ExcludeFlagged), req.WindowPeriod, !req.SkipEmpty, windowOptions(req.WindowPeriod, req.Timezone))
+	fluxQuery = timezoneImport(req.Timezone) + fluxQuery
 	log.Printf("Executing InfluxDB query: %s", fluxQuery)
 	// Execute the query
 	result, err := queryAPI.Query(ctx, fluxQuery)
@@ -241,9 +301,13 @@ func (r *InfluxDBRepository) Query(req models.QueryRequest) ([]models.SensorQuer
 		groupedData[deviceID][locationIDStr][field] = append(groupedData[deviceID][locationIDStr][field], reading)
 	}
 
-	// Format the grouped data into the SensorQueryResponse model
-	var response []models.SensorQueryResponse
-	for deviceID, locationMap := range groupedData {
+	// Format the grouped data into the SensorQueryResponse model, one entry per device in the requested order
+	response := []models.SensorQueryResponse{}
+	for _, deviceID := range req.DeviceIDs {
+		locationMap, ok := groupedData[deviceID]
+		if !ok {
+			continue
+		}
 		for _, fieldMap := range locationMap { // We iterate over locations within a device
 			response = append(response, models.SensorQueryResponse{
 				DeviceID: deviceID,
@@ -255,16 +319,68 @@ func (r *InfluxDBRepository) Query(req models.QueryRequest) ([]models.SensorQuer
 	return response, nil
 }
 
+// ListDevices returns the devices that wrote to a measurement of a location bucket between start and stop.
+func (r *InfluxDBRepository) ListDevices(ctx context.Context, bucket, measurement string, start, stop time.Time) ([]string, error) {
+	exists, err := r.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("error checking bucket existence: %w", err)
+	}
+	if !exists {
+		return []string{}, nil
+	}
+
+	fluxQuery := fmt.Sprintf(`
+       import "influxdata/influxdb/schema"
+       schema.tagValues(
+           bucket: "%s",
+           tag: "device_id",
+           predicate: (r) => r["_measurement"] == "%s",
+           start: %s,
+           stop: %s,
+       )`, bucket, measurement, start.Format(time.RFC3339), stop.Format(time.RFC3339))
+	log.Printf("Executing InfluxDB device list query: %s", fluxQuery)
+	result, err := r.client.QueryAPI(r.org).Query(ctx, fluxQuery)
+	if err != nil {
+		log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, fluxQuery)
+		return nil, fmt.Errorf("error querying InfluxDB: %w", err)
+	}
+
+	devices := []string{}
+	for result.Next() {
+		if deviceID, ok := result.Record().Value().(string); ok && deviceID != "" {
+			devices = append(devices, deviceID)
+		}
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("query processing error: %w", result.Err())
+	}
+	return devices, nil
+}
+
 // WriteConsumptionData writes the consumption data to InfluxDB.
 func (r *InfluxDBRepository) WriteConsumptionData(ctx context.Context, req models.ConsumptionReq) error {
 	// defer r.client.Close() // Remove this line
 	bucket := "consumption_data"
 	writeAPI := r.client.WriteAPIBlocking(r.org, bucket)
 
-	fields := map[string]interface{}{
-		"current": req.Current,
-		"voltage": req.Voltage,
-		"power":   req.Power,
+	fields := make(map[string]interface{})
+	for metric, value := range map[string]float64{"current": req.Current, "voltage": req.Voltage, "power": req.Power} {
+		if isFinite(value) {
+			fields[metric] = value
+		} else {
+			fields[metric+"_invalid"] = true
+		}
+	}
+
+	for metric, value := range req.Derived {
+		if isFinite(value) {
+			fields[metric] = value
+		}
+	}
+
+	tags := map[string]string{"device_id": req.DeviceID}
+	if len(req.QualityFlags) > 0 {
+		tags["quality"] = strings.Join(req.QualityFlags, ",")
 	}
 
 	var p *write.Point
@@ -273,23 +389,23 @@ func (r *InfluxDBRepository) WriteConsumptionData(ctx context.Context, req model
 		if err != nil {
 			log.Printf("Error parsing timestamp '%s', using current time: %v\n", req.Timestamp, err)
 			p = influxdb2.NewPoint(
-				"consumption_data",                           // Measurement name.
-				map[string]string{"device_id": req.DeviceID}, // tags
+				"consumption_data", // Measurement name.
+				tags,
 				fields,
 				time.Now(), //  Use server time
 			)
 		} else {
 			p = influxdb2.NewPoint(
-				"consumption_data",                           // Measurement name.
-				map[string]string{"device_id": req.DeviceID}, // tags
+				"consumption_data", // Measurement name.
+				tags,
 				fields,
 				stm32Time, // Use the timestamp from the STM32.
 			)
 		}
 	} else {
 		p = influxdb2.NewPoint(
-			"consumption_data",                           // Measurement name.
-			map[string]string{"device_id": req.DeviceID}, // tags
+			"consumption_data", // Measurement name.
+			tags,
 			fields,
 			time.Now(),
 		)
@@ -312,44 +428,7 @@ func (r *InfluxDBRepository) QueryConsumptionData(ctx context.Context, req model
 		return nil, fmt.Errorf("time range start, stop, and window period must be provided")
 	}
 
-	// --- API Side Validation Logic (matching frontend) ---
-	// 1. Parse times
-	start, err := time.Parse(time.RFC3339, req.TimeRangeStart)
-	if err != nil {
-		return nil, fmt.Errorf("invalid time_range_start format: %w", err)
-	}
-	stop, err := time.Parse(time.RFC3339, req.TimeRangeStop)
-	if err != nil {
-		return nil, fmt.Errorf("invalid time_range_stop format: %w", err)
-	}
-
-	if start.After(stop) || start.Equal(stop) {
-		return nil, fmt.Errorf("time range start must be strictly before time range stop")
-	}
-
-	// 2. Parse window period (e.g., "1m", "5s")
-	window, err := time.ParseDuration(req.WindowPeriod)
-	if err != nil {
-		return nil, fmt.Errorf("invalid window_period format: %w", err)
-	}
-
-	if window <= 0 {
-		return nil, fmt.Errorf("window period must be positive")
-	}
-
-	// 3. Calculate total points
-	duration := stop.Sub(start)
-
-	// Calculate total points and round up (Ceil)
-	// We use float64 division to prevent overflow from large duration/window values
-	totalPoints := math.Ceil(float64(duration) / float64(window))
-
-	if totalPoints > float64(MAX_API_QUERY_POINTS) {
-		log.Printf("Query rejected: Total points requested (%.0f) exceeds limit (%d)", totalPoints, MAX_API_QUERY_POINTS)
-		return nil, fmt.Errorf("query too broad: requested points %.0f exceeds maximum API limit %d. Please adjust time range or window period", totalPoints, MAX_API_QUERY_POINTS)
-	}
-	log.Printf("Query validation passed. Total estimated points: %.0f (Max: %d)", totalPoints, MAX_API_QUERY_POINTS)
-	// --- End Validation Logic ---
+	// The point budget is enforced by the service query planner, which also resolves "auto" windows.
 
 	// Build Flux query
 	fluxQuery := fmt.Sprintf(`
@@ -357,10 +436,12 @@ func (r *InfluxDBRepository) QueryConsumptionData(ctx context.Context, req model
        |> range(start: %s, stop: %s)
        |> filter(fn: (r) => r["_measurement"] == "consumption_data")
        |> filter(fn: (r) => r["device_id"] == "%s")
-       |> filter(fn: (r) => %s)
-       |> aggregateWindow(every: %s, fn: mean, createEmpty: true) // createEmpty: true ensures nulls for missing periods
+       |> filter(fn: (r) => %s)%s
+       |> group(columns: ["device_id", "_field"]) // merge flagged and clean series of a metric
+       |> aggregateWindow(every: %s, fn: mean, createEmpty: %t%s) // createEmpty: true ensures nulls for missing periods
        |> yield(name: "mean")
-    `, "consumption_data", req.TimeRangeStart, req.TimeRangeStop, req.DeviceID, createMetricFilterClause(req.Metrics), req.WindowPeriod)
+    `, "consumption_data", req.TimeRangeStart, req.TimeRangeStop, req.DeviceID, createMetricFilterClause(req.Metrics), qualityFilterClause(req.ExcludeFlagged), req.WindowPeriod, !req.SkipEmpty, windowOptions(req.WindowPeriod, req.Timezone))
+	fluxQuery = timezoneImport(req.Timezone) + fluxQuery
 	log.Printf("Executing InfluxDB consumption query: %s", fluxQuery)
 
 	// Execute query
@@ -422,6 +503,166 @@ func (r *InfluxDBRepository) QueryConsumptionData(ctx context.Context, req model
 	return []models.ConsumptionQueryResponse{response}, nil
 }
 
+// QueryRawSensorData returns the stored values of one sensor field with their uncalibrated value.
+// Points written before calibration existed have no "<field>_raw" field; their value is the raw value.
+func (r *InfluxDBRepository) QueryRawSensorData(ctx context.Context, bucket, deviceID, sensorID, field string, start, stop time.Time) ([]models.RawSensorPoint, error) {
+	fluxQuery := fmt.Sprintf(`
+       from(bucket: "%s")
+       |> range(start: %s, stop: %s)
+       |> filter(fn: (r) => r["_measurement"] == "sensor_data")
+       |> filter(fn: (r) => r["device_id"] == "%s" and r["sensor_id"] == "%s")
+       |> filter(fn: (r) => r["_field"] == "%s" or r["_field"] == "%s_raw")
+       |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")
+    `, bucket, start.Format(time.RFC3339), stop.Format(time.RFC3339), deviceID, sensorID, field, field)
+	log.Printf("Executing InfluxDB raw sensor query: %s", fluxQuery)
+
+	result, err := r.client.QueryAPI(r.org).Query(ctx, fluxQuery)
+	if err != nil {
+		log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, fluxQuery)
+		return nil, fmt.Errorf("error querying InfluxDB: %w", err)
+	}
+
+	var points []models.RawSensorPoint
+	for result.Next() {
+		record := result.Record()
+		value, ok := toFloat(record.ValueByKey(field))
+		if !ok {
+			continue
+		}
+		raw, ok := toFloat(record.ValueByKey(field + "_raw"))
+		if !ok {
+			raw = value
+		}
+		point := models.RawSensorPoint{Time: record.Time(), Value: value, RawValue: raw, Tags: make(map[string]string)}
+		// The remaining string columns are the tags of the series
+		for key, v := range record.Values() {
+			tag, ok := v.(string)
+			if !ok || tag == "" || strings.HasPrefix(key, "_") || key == "result" || key == "table" {
+				continue
+			}
+			point.Tags[key] = tag
+		}
+		points = append(points, point)
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("query processing error: %w", result.Err())
+	}
+	return points, nil
+}
+
+// QueryQualitySummary counts the points of a device per field and per quality flag over a time range.
+func (r *InfluxDBRepository) QueryQualitySummary(ctx context.Context, bucket, measurement, deviceID string, start, stop time.Time) (map[string]models.FieldQuality, error) {
+	summary := make(map[string]models.FieldQuality)
+
+	exists, err := r.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return summary, nil
+	}
+
+	fluxQuery := fmt.Sprintf(`
+       from(bucket: "%s")
+       |> range(start: %s, stop: %s)
+       |> filter(fn: (r) => r["_measurement"] == "%s")
+       |> filter(fn: (r) => r["device_id"] == "%s")
+       |> filter(fn: (r) => r["_field"] !~ /_raw$/)
+       |> group(columns: ["_field", "quality"])
+       |> count()
+    `, bucket, start.Format(time.RFC3339), stop.Format(time.RFC3339), measurement, deviceID)
+	log.Printf("Executing InfluxDB quality query: %s", fluxQuery)
+
+	result, err := r.client.QueryAPI(r.org).Query(ctx, fluxQuery)
+	if err != nil {
+		log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, fluxQuery)
+		return nil, fmt.Errorf("error querying InfluxDB: %w", err)
+	}
+	for result.Next() {
+		record := result.Record()
+		field := strings.TrimSuffix(record.Field(), "_invalid")
+		count, ok := record.Value().(int64)
+		if !ok {
+			continue
+		}
+
+		fq := summary[field]
+		if fq.Flags == nil {
+			fq.Flags = make(map[string]int64)
+		}
+		fq.TotalPoints += count
+		if quality, _ := record.ValueByKey("quality").(string); quality != "" {
+			fq.FlaggedPoints += count
+			for _, flag := range strings.Split(quality, ",") {
+				fq.Flags[flag] += count
+			}
+		}
+		summary[field] = fq
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("query processing error: %w", result.Err())
+	}
+	return summary, nil
+}
+
+// qualityFilterClause returns a Flux filter dropping flagged points when exclude is set.
+func qualityFilterClause(exclude bool) string {
+	if !exclude {
+		return ""
+	}
+	return `
+       |> filter(fn: (r) => not exists r["quality"])`
+}
+
+// isFinite reports whether v can be stored in InfluxDB.
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// toFloat converts a numeric Flux value to float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// timezoneImport returns the Flux import needed by windowOptions for a non-UTC timezone.
+func timezoneImport(timezone string) string {
+	if timezone == "" || timezone == "UTC" {
+		return ""
+	}
+	return `import "timezone"
+`
+}
+
+// windowOptions returns the extra aggregateWindow arguments aligning windows to the calendar of a timezone. Weekly
+// windows start on Monday rather than on the Thursday of the Unix epoch.
+func windowOptions(window, timezone string) string {
+	var options string
+	if timezone != "" && timezone != "UTC" {
+		options += fmt.Sprintf(`, location: timezone.location(name: "%s")`, timezone)
+	}
+	if strings.HasSuffix(window, "w") {
+		options += ", offset: 4d"
+	}
+	return options
+}
+
+// createTagFilterClause creates a filter string matching any of the values of a tag.
+func createTagFilterClause(tag string, values []string) string {
+	filters := make([]string, len(values))
+	for i, value := range values {
+		filters[i] = fmt.Sprintf(`r["%s"] == "%s"`, tag, value)
+	}
+	return strings.Join(filters, " or ")
+}
+
 // createMetricFilterClause creates a combined filter string for multiple metrics.
 func createMetricFilterClause(metrics []string) string {
 	fieldFilters := make([]string, len(metrics))
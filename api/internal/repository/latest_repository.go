@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"CapIot.influxDB/internal/models"
+)
+
+// ListBuckets returns the names of the buckets of the organization, system buckets excluded.
+func (r *InfluxDBRepository) ListBuckets(ctx context.Context) ([]string, error) {
+	buckets, err := r.client.BucketsAPI().FindBucketsByOrgName(ctx, r.org)
+	if err != nil {
+		return nil, fmt.Errorf("error listing buckets: %w", err)
+	}
+	names := []string{}
+	if buckets == nil {
+		return names, nil
+	}
+	for _, b := range *buckets {
+		if !strings.HasPrefix(b.Name, "_") {
+			names = append(names, b.Name)
+		}
+	}
+	return names, nil
+}
+
+// QueryLatestValues returns the most recent value of every sensor field of the given devices of a location bucket
+// (every device when deviceIDs is empty) within the lookback period, keyed by device then field.
+func (r *InfluxDBRepository) QueryLatestValues(ctx context.Context, bucket string, deviceIDs []string, lookback time.Duration) (map[string]map[string]models.LatestValue, error) {
+	latest := make(map[string]map[string]models.LatestValue)
+	exists, err := r.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return latest, nil
+	}
+
+	deviceFilter := ""
+	if len(deviceIDs) > 0 {
+		deviceFilter = fmt.Sprintf(`
+       |> filter(fn: (r) => %s)`, createTagFilterClause("device_id", deviceIDs))
+	}
+	fluxQuery := fmt.Sprintf(`
+       from(bucket: "%s")
+       |> range(start: -%s)
+       |> filter(fn: (r) => r["_measurement"] == "sensor_data" and r["_field"] !~ /_raw$|_invalid$/)%s
+       |> last()
+       |> group(columns: ["device_id", "_field"]) // keep the latest of the per-sensor and flagged series of a field
+       |> sort(columns: ["_time"])
+       |> last()`, bucket, lookback.String(), deviceFilter)
+
+	log.Printf("Executing InfluxDB latest values query: %s", fluxQuery)
+	result, err := r.client.QueryAPI(r.org).Query(ctx, fluxQuery)
+	if err != nil {
+		log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, fluxQuery)
+		return nil, fmt.Errorf("error querying InfluxDB: %w", err)
+	}
+	for result.Next() {
+		record := result.Record()
+		value, ok := toFloat(record.Value())
+		if !ok {
+			continue
+		}
+		deviceID, _ := record.ValueByKey("device_id").(string)
+		lv := models.LatestValue{Value: value, Time: record.Time()}
+		if flags, ok := record.ValueByKey("quality").(string); ok && flags != "" {
+			lv.QualityFlags = strings.Split(flags, ",")
+		}
+		if latest[deviceID] == nil {
+			latest[deviceID] = make(map[string]models.LatestValue)
+		}
+		latest[deviceID][record.Field()] = lv
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("query processing error: %w", result.Err())
+	}
+	return latest, nil
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"CapIot.influxDB/internal/models"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+)
+
+// WriteRunningHours writes a component running hours counter to the "running_hours" measurement of the
+// location bucket.
+func (r *InfluxDBRepository) WriteRunningHours(ctx context.Context, bucket string, req models.RunningHoursReq) error {
+	fields := map[string]interface{}{"running_hours": req.RunningHours}
+	if req.MaxRunningHours != nil {
+		fields["max_running_hours"] = *req.MaxRunningHours
+	}
+
+	ts := time.Now()
+	if req.Timestamp != "" {
+		parsed, err := time.Parse(time.RFC3339, req.Timestamp)
+		if err != nil {
+			log.Printf("Error parsing timestamp '%s', using current time: %v\n", req.Timestamp, err)
+		} else {
+			ts = parsed
+		}
+	}
+
+	p := influxdb2.NewPoint(
+		"running_hours",
+		map[string]string{"device_id": req.DeviceID, "component_id": req.ComponentID},
+		fields,
+		ts,
+	)
+	writeAPI := r.client.WriteAPIBlocking(r.org, bucket)
+	if err := writeAPI.WritePoint(ctx, p); err != nil {
+		return fmt.Errorf("error writing running hours to InfluxDB: %w", err)
+	}
+	log.Printf("Running hours written to InfluxDB, bucket: %s, device_id: %s, component_id: %s, hours: %f\n", bucket, req.DeviceID, req.ComponentID, req.RunningHours)
+	return nil
+}
+
+// QueryComponentUsage returns the running hours history of every component of some devices of a location bucket
+// between start and stop. The maximum running hours is the latest one ever stored.
+func (r *InfluxDBRepository) QueryComponentUsage(ctx context.Context, bucket string, deviceIDs []string, start, stop time.Time) ([]models.ComponentUsage, error) {
+	exists, err := r.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || len(deviceIDs) == 0 {
+		return []models.ComponentUsage{}, nil
+	}
+
+	deviceFilter := fmt.Sprintf(`
+       |> filter(fn: (r) => %s)`, createTagFilterClause("device_id", deviceIDs))
+	base := func(rangeStart, field string) string {
+		return fmt.Sprintf(`
+       from(bucket: "%s")
+       |> range(start: %s, stop: %s)
+       |> filter(fn: (r) => r["_measurement"] == "running_hours" and r["_field"] == "%s")%s`,
+			bucket, rangeStart, stop.Format(time.RFC3339), field, deviceFilter)
+	}
+	from := start.Format(time.RFC3339)
+
+	usage := make(map[string]*models.ComponentUsage)
+	get := func(deviceID, componentID string) *models.ComponentUsage {
+		key := deviceID + "|" + componentID
+		u, ok := usage[key]
+		if !ok {
+			u = &models.ComponentUsage{DeviceID: deviceID, ComponentID: componentID}
+			usage[key] = u
+		}
+		return u
+	}
+
+	queries := []struct {
+		flux  string
+		apply func(u *models.ComponentUsage, t time.Time, v float64)
+	}{
+		{base(from, "running_hours") + "\n       |> first()", func(u *models.ComponentUsage, t time.Time, v float64) { u.FirstTime = t }},
+		{base(from, "running_hours") + "\n       |> last()", func(u *models.ComponentUsage, t time.Time, v float64) { u.LastTime, u.LastHours = t, v }},
+		{base(from, "running_hours") + "\n       |> difference(nonNegative: true)\n       |> sum()", func(u *models.ComponentUsage, t time.Time, v float64) { u.Increase = v }},
+		{base("0", "max_running_hours") + "\n       |> last()", func(u *models.ComponentUsage, t time.Time, v float64) { u.MaxRunningHours = &v }},
+	}
+
+	queryAPI := r.client.QueryAPI(r.org)
+	for _, q := range queries {
+		log.Printf("Executing InfluxDB running hours query: %s", q.flux)
+		result, err := queryAPI.Query(ctx, q.flux)
+		if err != nil {
+			log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, q.flux)
+			return nil, fmt.Errorf("error querying InfluxDB: %w", err)
+		}
+		for result.Next() {
+			record := result.Record()
+			value, ok := toFloat(record.Value())
+			if !ok {
+				continue
+			}
+			device, _ := record.ValueByKey("device_id").(string)
+			component, _ := record.ValueByKey("component_id").(string)
+			q.apply(get(device, component), record.Time(), value)
+		}
+		if result.Err() != nil {
+			return nil, fmt.Errorf("query processing error: %w", result.Err())
+		}
+	}
+
+	components := make([]models.ComponentUsage, 0, len(usage))
+	for _, u := range usage {
+		if u.LastTime.IsZero() {
+			continue // No running hours in the lookback period
+		}
+		components = append(components, *u)
+	}
+	return components, nil
+}
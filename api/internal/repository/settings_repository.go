@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+)
+
+// SettingsBucket holds the API's own configuration documents (calibration profiles, rules, ...).
+// Each document is a JSON string stored in the "document" field of the "settings" measurement,
+// tagged by kind and id. Only the latest point of each document is used; an empty document marks a deletion.
+const SettingsBucket = "api_settings"
+
+// SaveDocument stores the JSON document of the given kind and id, replacing any previous version.
+func (r *InfluxDBRepository) SaveDocument(ctx context.Context, kind, id string, document []byte) error {
+	if err := r.ensureBucket(ctx, SettingsBucket); err != nil {
+		return err
+	}
+
+	writeAPI := r.client.WriteAPIBlocking(r.org, SettingsBucket)
+	p := influxdb2.NewPoint(
+		"settings",
+		map[string]string{"kind": kind, "id": id},
+		map[string]interface{}{"document": string(document)},
+		time.Now(),
+	)
+	if err := writeAPI.WritePoint(ctx, p); err != nil {
+		return fmt.Errorf("error writing %s document '%s' to InfluxDB: %w", kind, id, err)
+	}
+	return nil
+}
+
+// DeleteDocument marks the document of the given kind and id as deleted.
+func (r *InfluxDBRepository) DeleteDocument(ctx context.Context, kind, id string) error {
+	return r.SaveDocument(ctx, kind, id, nil)
+}
+
+// LoadDocuments returns the latest version of every non-deleted document of the given kind, keyed by id.
+func (r *InfluxDBRepository) LoadDocuments(ctx context.Context, kind string) (map[string][]byte, error) {
+	documents := make(map[string][]byte)
+
+	exists, err := r.BucketExists(ctx, SettingsBucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return documents, nil
+	}
+
+	fluxQuery := fmt.Sprintf(`
+       from(bucket: "%s")
+       |> range(start: 0)
+       |> filter(fn: (r) => r["_measurement"] == "settings")
+       |> filter(fn: (r) => r["kind"] == "%s")
+       |> filter(fn: (r) => r["_field"] == "document")
+       |> last()
+    `, SettingsBucket, kind)
+
+	result, err := r.client.QueryAPI(r.org).Query(ctx, fluxQuery)
+	if err != nil {
+		log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, fluxQuery)
+		return nil, fmt.Errorf("error loading %s documents: %w", kind, err)
+	}
+	for result.Next() {
+		record := result.Record()
+		id, _ := record.ValueByKey("id").(string)
+		document, _ := record.Value().(string)
+		if id == "" || document == "" {
+			continue // deleted
+		}
+		documents[id] = []byte(document)
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("query processing error: %w", result.Err())
+	}
+	return documents, nil
+}
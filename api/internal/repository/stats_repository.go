@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// StreamFieldValues streams the raw values of the given fields of a device, stored in a bucket and measurement,
+// between start and stop. fn is called for every numeric value; an error returned by fn stops the stream.
+func (r *InfluxDBRepository) StreamFieldValues(ctx context.Context, bucket, measurement, deviceID string, fields []string, start, stop time.Time, excludeFlagged bool, fn func(field string, value float64) error) error {
+	exists, err := r.BucketExists(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	fluxQuery := fmt.Sprintf(`
+       from(bucket: "%s")
+       |> range(start: %s, stop: %s)
+       |> filter(fn: (r) => r["_measurement"] == "%s")
+       |> filter(fn: (r) => r["device_id"] == "%s")
+       |> filter(fn: (r) => %s)%s
+       |> keep(columns: ["_time", "_value", "_field"])`,
+		bucket, start.Format(time.RFC3339), stop.Format(time.RFC3339), measurement, deviceID, createMetricFilterClause(fields), qualityFilterClause(excludeFlagged))
+
+	log.Printf("Executing InfluxDB stats query: %s", fluxQuery)
+	result, err := r.client.QueryAPI(r.org).Query(ctx, fluxQuery)
+	if err != nil {
+		log.Printf("Error querying InfluxDB: %v\nQuery: %s", err, fluxQuery)
+		return fmt.Errorf("error querying InfluxDB: %w", err)
+	}
+	defer result.Close()
+
+	for result.Next() {
+		record := result.Record()
+		value, ok := toFloat(record.Value())
+		if !ok {
+			continue
+		}
+		if err := fn(record.Field(), value); err != nil {
+			return err
+		}
+	}
+	if result.Err() != nil {
+		return fmt.Errorf("query processing error: %w", result.Err())
+	}
+	return nil
+}
@@ -9,10 +9,62 @@ import (
 )
 
 // RegisterRoutes registers all application routes
-func RegisterRoutes(router *mux.Router, controller *controller.DataController) {
+func RegisterRoutes(router *mux.Router, controller *controller.DataController, alertController *controller.AlertController) {
 	// Sensor data - GET and POST are handled separately to apply different middleware.
 	router.Handle("/influxdb/sensordata",
-		middleware.CheckUserRights(http.HandlerFunc(controller.HandleQueryData))).Methods(http.MethodGet)
+		middleware.CheckUserRightsForDevices(controller.ListQueryDevices)(http.HandlerFunc(controller.HandleQueryData))).Methods(http.MethodGet)
+
+	// Period-over-period comparison
+	router.Handle("/influxdb/sensordata/compare",
+		middleware.CheckUserRights(http.HandlerFunc(controller.HandleCompareSensorData))).Methods(http.MethodGet)
+	router.Handle("/influxdb/metrics/compare",
+		middleware.CheckUserDeviceRightsMiddleware(http.HandlerFunc(controller.HandleCompareConsumption))).Methods(http.MethodGet)
+
+	// Descriptive statistics and histograms
+	router.Handle("/influxdb/sensordata/stats",
+		middleware.CheckUserRights(http.HandlerFunc(controller.HandleSensorStats))).Methods(http.MethodGet)
+	router.Handle("/influxdb/metrics/stats",
+		middleware.CheckUserDeviceRightsMiddleware(http.HandlerFunc(controller.HandleConsumptionStats))).Methods(http.MethodGet)
+
+	// Anomaly detection
+	router.Handle("/influxdb/sensordata/anomalies",
+		middleware.CheckUserRights(http.HandlerFunc(controller.HandleSensorAnomalies))).Methods(http.MethodGet)
+	router.Handle("/influxdb/metrics/anomalies",
+		middleware.CheckUserDeviceRightsMiddleware(http.HandlerFunc(controller.HandleConsumptionAnomalies))).Methods(http.MethodGet)
+
+	// Change-point detection
+	router.Handle("/influxdb/sensordata/changepoints",
+		middleware.CheckUserRights(http.HandlerFunc(controller.HandleSensorChangePoints))).Methods(http.MethodGet)
+	router.Handle("/influxdb/metrics/changepoints",
+		middleware.CheckUserDeviceRightsMiddleware(http.HandlerFunc(controller.HandleConsumptionChangePoints))).Methods(http.MethodGet)
+
+	// Short-term forecasts
+	router.Handle("/influxdb/sensordata/forecast",
+		middleware.CheckUserRights(http.HandlerFunc(controller.HandleSensorForecast))).Methods(http.MethodGet)
+	router.Handle("/influxdb/metrics/forecast",
+		middleware.CheckUserDeviceRightsMiddleware(http.HandlerFunc(controller.HandleConsumptionForecast))).Methods(http.MethodGet)
+
+	// Cross-series correlation, the rights are checked for the device of every series
+	router.Handle("/influxdb/correlation",
+		middleware.CheckUserRightsForSeries(http.HandlerFunc(controller.HandleCorrelation))).Methods(http.MethodGet)
+
+	// Peak demand and load profiles of the consumption devices of a location
+	router.Handle("/influxdb/metrics/demand",
+		middleware.CheckUserRightsForDevices(controller.ListConsumptionDevices)(http.HandlerFunc(controller.HandleGetDemand))).Methods(http.MethodGet)
+
+	// CO2e emissions of the energy used by the consumption devices of a location
+	router.Handle("/influxdb/metrics/emissions",
+		middleware.CheckUserRightsForDevices(controller.ListConsumptionDevices)(http.HandlerFunc(controller.HandleGetEmissions))).Methods(http.MethodGet)
+
+	// Heating and cooling degree-days, and the weather-normalized energy of the consumption devices of a location
+	router.Handle("/influxdb/degree-days",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(controller.HandleGetDegreeDays))).Methods(http.MethodGet)
+	router.Handle("/influxdb/metrics/weather-normalization",
+		middleware.CheckUserRightsForDevices(controller.ListConsumptionDevices)(http.HandlerFunc(controller.HandleGetWeatherNormalization))).Methods(http.MethodGet)
+
+	// Latest value of each field, served from the in-memory cache
+	router.Handle("/influxdb/latest",
+		middleware.CheckUserRightsForDevices(controller.ListRecentDevices)(http.HandlerFunc(controller.HandleGetLatest))).Methods(http.MethodGet)
 
 	router.Handle("/influxdb/sensordata/{deviceID}/{locationID}",
 		middleware.CheckLocationAndDeviceAccess(http.HandlerFunc(controller.HandleSensorData))).Methods(http.MethodPost)
@@ -24,6 +76,87 @@ func RegisterRoutes(router *mux.Router, controller *controller.DataController) {
 	router.Handle("/influxdb/metrics/{deviceID}",
 		middleware.CheckDeviceRightsMiddleware(http.HandlerFunc(controller.HandleConsumptionData))).Methods(http.MethodPost)
 
+	// Component running hours and maintenance forecast
+	router.Handle("/influxdb/running-hours/{deviceID}/{locationID}",
+		middleware.CheckLocationAndDeviceAccess(http.HandlerFunc(controller.HandleRunningHours))).Methods(http.MethodPost)
+	router.Handle("/influxdb/maintenance",
+		middleware.CheckUserRightsForDevices(controller.ListComponentDevices)(http.HandlerFunc(controller.HandleGetMaintenance))).Methods(http.MethodGet)
+
+	// Device heartbeats, status transitions and availability
+	router.Handle("/influxdb/heartbeat/{deviceID}/{locationID}",
+		middleware.CheckLocationAndDeviceAccess(http.HandlerFunc(controller.HandleHeartbeat))).Methods(http.MethodPost)
+	router.Handle("/influxdb/status/{deviceID}/{locationID}",
+		middleware.CheckLocationAndDeviceAccess(http.HandlerFunc(controller.HandleDeviceStatus))).Methods(http.MethodPost)
+	router.Handle("/influxdb/availability",
+		middleware.CheckUserRightsForDevices(controller.ListEventDevices)(http.HandlerFunc(controller.HandleGetAvailability))).Methods(http.MethodGet)
+
+	// Data quality summary per device
+	router.Handle("/influxdb/quality",
+		middleware.CheckUserRights(http.HandlerFunc(controller.HandleGetQualitySummary))).Methods(http.MethodGet)
+
+	// Data completeness and gaps per device
+	router.Handle("/influxdb/completeness",
+		middleware.CheckUserRights(http.HandlerFunc(controller.HandleGetCompleteness))).Methods(http.MethodGet)
+
+	// Sensor calibration profiles
+	router.Handle("/influxdb/calibrations/{deviceID}",
+		middleware.CheckUserDeviceRightsMiddleware(http.HandlerFunc(controller.HandleListCalibrations))).Methods(http.MethodGet)
+	router.Handle("/influxdb/calibrations/{deviceID}/{sensorID}",
+		middleware.CheckUserDeviceRightsMiddleware(http.HandlerFunc(controller.HandleCreateCalibration))).Methods(http.MethodPost)
+	router.Handle("/influxdb/calibrations/{deviceID}/{sensorID}/recompute",
+		middleware.CheckUserDeviceRightsMiddleware(http.HandlerFunc(controller.HandleRecomputeCalibration))).Methods(http.MethodPost)
+	router.Handle("/influxdb/calibrations/{deviceID}/{sensorID}/{profileID}",
+		middleware.CheckUserDeviceRightsMiddleware(http.HandlerFunc(controller.HandleUpdateCalibration))).Methods(http.MethodPut)
+	router.Handle("/influxdb/calibrations/{deviceID}/{sensorID}/{profileID}",
+		middleware.CheckUserDeviceRightsMiddleware(http.HandlerFunc(controller.HandleDeleteCalibration))).Methods(http.MethodDelete)
+
+	// Virtual sensors per location, queried through /influxdb/sensordata
+	router.Handle("/influxdb/virtual-sensors/{locationID}",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(controller.HandleListVirtualSensors))).Methods(http.MethodGet)
+	router.Handle("/influxdb/virtual-sensors/{locationID}",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(controller.HandleCreateVirtualSensor))).Methods(http.MethodPost)
+	router.Handle("/influxdb/virtual-sensors/{locationID}/{sensorID}",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(controller.HandleGetVirtualSensor))).Methods(http.MethodGet)
+	router.Handle("/influxdb/virtual-sensors/{locationID}/{sensorID}",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(controller.HandleUpdateVirtualSensor))).Methods(http.MethodPut)
+	router.Handle("/influxdb/virtual-sensors/{locationID}/{sensorID}",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(controller.HandleDeleteVirtualSensor))).Methods(http.MethodDelete)
+
+	// Alert rules and alert history per location
+	router.Handle("/influxdb/alerts/{locationID}/rules",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleListRules))).Methods(http.MethodGet)
+	router.Handle("/influxdb/alerts/{locationID}/rules",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleCreateRule))).Methods(http.MethodPost)
+	router.Handle("/influxdb/alerts/{locationID}/rules/{ruleID}",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleGetRule))).Methods(http.MethodGet)
+	router.Handle("/influxdb/alerts/{locationID}/rules/{ruleID}",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleUpdateRule))).Methods(http.MethodPut)
+	router.Handle("/influxdb/alerts/{locationID}/rules/{ruleID}",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleDeleteRule))).Methods(http.MethodDelete)
+	router.Handle("/influxdb/alerts/{locationID}/history",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleAlertHistory))).Methods(http.MethodGet)
+
+	// Alert notification webhooks and undelivered notifications per location
+	router.Handle("/influxdb/alerts/{locationID}/webhooks",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleListWebhooks))).Methods(http.MethodGet)
+	router.Handle("/influxdb/alerts/{locationID}/webhooks",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleCreateWebhook))).Methods(http.MethodPost)
+	router.Handle("/influxdb/alerts/{locationID}/webhooks/{webhookID}",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleUpdateWebhook))).Methods(http.MethodPut)
+	router.Handle("/influxdb/alerts/{locationID}/webhooks/{webhookID}",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleDeleteWebhook))).Methods(http.MethodDelete)
+	router.Handle("/influxdb/alerts/{locationID}/webhooks/{webhookID}/test",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleTestWebhook))).Methods(http.MethodPost)
+	router.Handle("/influxdb/alerts/{locationID}/dead-letters",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleListDeadLetters))).Methods(http.MethodGet)
+	router.Handle("/influxdb/alerts/{locationID}/dead-letters/{letterID}/retry",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleRetryDeadLetter))).Methods(http.MethodPost)
+	router.Handle("/influxdb/alerts/{locationID}/dead-letters/{letterID}",
+		middleware.CheckLocationAccessMiddleware(http.HandlerFunc(alertController.HandleDeleteDeadLetter))).Methods(http.MethodDelete)
+
+	// Canonical units of the stored fields
+	router.HandleFunc("/influxdb/units", controller.HandleGetUnits).Methods(http.MethodGet)
+
 	// Device provisioning endpoint
 	router.HandleFunc("/influxdb/provisioning/{deviceID}", controller.HandleProvisioning).Methods(http.MethodGet)
 
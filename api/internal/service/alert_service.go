@@ -0,0 +1,514 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/repository"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertRuleDocumentKind is the settings document kind holding one alert rule.
+const alertRuleDocumentKind = "alert_rule"
+
+// alertWriteTimeout bounds the time spent persisting an alert event, independently of the request that caused it.
+const alertWriteTimeout = 10 * time.Second
+
+// alertQueueSize bounds the alert events waiting to be recorded. Events are dropped when it is full rather than
+// slowing down ingestion.
+const alertQueueSize = 1024
+
+// AlertService evaluates the alert rules against every incoming point and records state transitions
+// in the "alerts" measurement.
+type AlertService struct {
+	repo repository.Repository
+
+	mu          sync.Mutex
+	rules       map[string]models.AlertRule
+	states      map[string]*ruleState // keyed by "ruleID|deviceID"
+	subscribers []func(models.AlertEvent)
+	// queue holds the events to record, in order, off the ingestion path
+	queue chan models.AlertEvent
+}
+
+// ruleState is the evaluation state of a rule for one device.
+type ruleState struct {
+	firing     bool
+	aboveSince time.Time
+	lastValue  float64
+	lastTime   time.Time
+	hasLast    bool
+	history    []float64 // Last values of anomaly rules, oldest first
+}
+
+// NewAlertService creates a new AlertService with no rules; call LoadRules to load the stored ones.
+func NewAlertService(repo repository.Repository) *AlertService {
+	return &AlertService{
+		repo:   repo,
+		rules:  make(map[string]models.AlertRule),
+		states: make(map[string]*ruleState),
+		queue:  make(chan models.AlertEvent, alertQueueSize),
+	}
+}
+
+// Subscribe registers fn to be called with every recorded alert event. fn must not block.
+func (s *AlertService) Subscribe(fn func(models.AlertEvent)) {
+	s.mu.Lock()
+	s.subscribers = append(s.subscribers, fn)
+	s.mu.Unlock()
+}
+
+// LoadRules loads the alert rules stored in InfluxDB into memory.
+func (s *AlertService) LoadRules(ctx context.Context) error {
+	rules := make(map[string]models.AlertRule)
+	if err := loadDocuments(ctx, s.repo, alertRuleDocumentKind, rules); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.states = make(map[string]*ruleState)
+	s.mu.Unlock()
+	log.Printf("Loaded %d alert rules", len(rules))
+	return nil
+}
+
+// ListRules returns the alert rules of a location.
+func (s *AlertService) ListRules(locationID string) []models.AlertRule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := []models.AlertRule{}
+	for _, rule := range s.rules {
+		if rule.LocationID == locationID {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// GetRule returns an alert rule of a location.
+func (s *AlertService) GetRule(locationID, ruleID string) (models.AlertRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule, ok := s.rules[ruleID]
+	if !ok || rule.LocationID != locationID {
+		return models.AlertRule{}, ruleNotFound(ruleID)
+	}
+	return rule, nil
+}
+
+// CreateRule validates and stores a new alert rule for a location.
+func (s *AlertService) CreateRule(ctx context.Context, locationID string, rule models.AlertRule) (models.AlertRule, error) {
+	rule.ID = newID()
+	rule.LocationID = locationID
+	if err := validateRule(&rule); err != nil {
+		return models.AlertRule{}, err
+	}
+	if err := s.saveRule(ctx, rule); err != nil {
+		return models.AlertRule{}, err
+	}
+	return rule, nil
+}
+
+// UpdateRule replaces an alert rule of a location and resets its evaluation state.
+func (s *AlertService) UpdateRule(ctx context.Context, locationID, ruleID string, rule models.AlertRule) (models.AlertRule, error) {
+	if _, err := s.GetRule(locationID, ruleID); err != nil {
+		return models.AlertRule{}, err
+	}
+	rule.ID = ruleID
+	rule.LocationID = locationID
+	if err := validateRule(&rule); err != nil {
+		return models.AlertRule{}, err
+	}
+	if err := s.saveRule(ctx, rule); err != nil {
+		return models.AlertRule{}, err
+	}
+	return rule, nil
+}
+
+// DeleteRule removes an alert rule of a location.
+func (s *AlertService) DeleteRule(ctx context.Context, locationID, ruleID string) error {
+	if _, err := s.GetRule(locationID, ruleID); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteDocument(ctx, alertRuleDocumentKind, ruleID); err != nil {
+		return fmt.Errorf("error deleting alert rule: %w", err)
+	}
+
+	s.mu.Lock()
+	delete(s.rules, ruleID)
+	s.resetStateLocked(ruleID)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *AlertService) saveRule(ctx context.Context, rule models.AlertRule) error {
+	if err := saveDocument(ctx, s.repo, alertRuleDocumentKind, rule.ID, rule); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.rules[rule.ID] = rule
+	s.resetStateLocked(rule.ID)
+	s.mu.Unlock()
+	return nil
+}
+
+// resetStateLocked forgets the evaluation state of a rule. s.mu must be held.
+func (s *AlertService) resetStateLocked(ruleID string) {
+	prefix := ruleID + "|"
+	for key := range s.states {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.states, key)
+		}
+	}
+}
+
+// GetAlertHistory returns the stored alert events of a location.
+func (s *AlertService) GetAlertHistory(ctx context.Context, req models.AlertHistoryRequest) ([]models.AlertEvent, error) {
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return nil, err
+	}
+	if req.State != "" && req.State != models.AlertStateFiring && req.State != models.AlertStateResolved {
+		return nil, models.NewAPIError(models.ErrorCodeValidationFailed, "state must be 'firing' or 'resolved'", nil, http.StatusBadRequest)
+	}
+	events, err := s.repo.QueryAlerts(ctx, req, start, stop)
+	if err != nil {
+		return nil, fmt.Errorf("error querying alert history: %w", err)
+	}
+	return events, nil
+}
+
+// Evaluate runs every matching rule against a new point and records the resulting alert events.
+func (s *AlertService) Evaluate(point models.MetricPoint) {
+	if math.IsNaN(point.Value) || math.IsInf(point.Value, 0) {
+		return
+	}
+
+	var events []models.AlertEvent
+	s.mu.Lock()
+	for _, rule := range s.rules {
+		if !ruleMatches(rule, point) {
+			continue
+		}
+		key := rule.ID + "|" + point.DeviceID
+		state, ok := s.states[key]
+		if !ok {
+			state = &ruleState{}
+			s.states[key] = state
+		}
+		if event := evaluateRule(rule, state, point); event != nil {
+			events = append(events, *event)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, event := range events {
+		s.emit(event)
+	}
+}
+
+// Start records the queued alert events and checks the missing_data rules periodically until ctx is cancelled.
+func (s *AlertService) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-s.queue:
+				s.record(event)
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				for _, event := range s.checkMissingData(now) {
+					s.emit(event)
+				}
+			}
+		}
+	}()
+}
+
+// checkMissingData fires the missing_data rules of every device that has been silent for longer than the rule's
+// duration. Devices named by a rule are expected from the first check even if they never sent data.
+func (s *AlertService) checkMissingData(now time.Time) []models.AlertEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []models.AlertEvent
+	for _, rule := range s.rules {
+		if !rule.Enabled || rule.Type != models.RuleTypeMissingData {
+			continue
+		}
+		duration, _ := time.ParseDuration(rule.Duration)
+
+		if rule.DeviceID != "" {
+			key := rule.ID + "|" + rule.DeviceID
+			if _, ok := s.states[key]; !ok {
+				s.states[key] = &ruleState{lastTime: now, hasLast: true}
+			}
+		}
+
+		prefix := rule.ID + "|"
+		for key, state := range s.states {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			if state.firing || !state.hasLast || now.Sub(state.lastTime) < duration {
+				continue
+			}
+			state.firing = true
+			deviceID := strings.TrimPrefix(key, prefix)
+			events = append(events, newAlertEvent(rule, deviceID, models.AlertStateFiring, nil, now,
+				fmt.Sprintf("No %s data received from device %s since %s", rule.Source, deviceID, state.lastTime.Format(time.RFC3339))))
+		}
+	}
+	return events
+}
+
+// emit queues an alert event to be recorded by the goroutine started by Start, so that a slow InfluxDB never holds
+// up the caller.
+func (s *AlertService) emit(event models.AlertEvent) {
+	select {
+	case s.queue <- event:
+	default:
+		log.Printf("Alert event queue full, dropping %s event of rule %s for device %s", event.State, event.RuleID, event.DeviceID)
+	}
+}
+
+// record persists an alert event and hands it to the subscribers.
+func (s *AlertService) record(event models.AlertEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertWriteTimeout)
+	defer cancel()
+	if err := s.repo.WriteAlertEvent(ctx, event); err != nil {
+		log.Printf("Error recording alert event for rule %s: %v", event.RuleID, err)
+	}
+
+	s.mu.Lock()
+	subscribers := append([]func(models.AlertEvent){}, s.subscribers...)
+	s.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(event)
+	}
+}
+
+// ruleMatches reports whether a rule watches the given point.
+func ruleMatches(rule models.AlertRule, point models.MetricPoint) bool {
+	if !rule.Enabled || rule.Source != point.Source {
+		return false
+	}
+	if rule.Field != "" && rule.Field != point.Field {
+		return false
+	}
+	if rule.DeviceID != "" && rule.DeviceID != point.DeviceID {
+		return false
+	}
+	// Consumption data carries no location, consumption rules are scoped by device instead.
+	return point.Source == models.SourceConsumption || rule.LocationID == point.LocationID
+}
+
+// evaluateRule updates the state of a rule for the point's device and returns the resulting event, if any.
+func evaluateRule(rule models.AlertRule, state *ruleState, point models.MetricPoint) *models.AlertEvent {
+	value := point.Value
+	var event *models.AlertEvent
+
+	fire := func(message string) {
+		state.firing = true
+		e := newAlertEvent(rule, point.DeviceID, models.AlertStateFiring, &value, point.Time, message)
+		event = &e
+	}
+	resolve := func(message string) {
+		state.firing = false
+		e := newAlertEvent(rule, point.DeviceID, models.AlertStateResolved, &value, point.Time, message)
+		event = &e
+	}
+
+	switch rule.Type {
+	case models.RuleTypeThreshold:
+		breached := (rule.Max != nil && value > *rule.Max) || (rule.Min != nil && value < *rule.Min)
+		cleared := (rule.Max == nil || value <= *rule.Max-rule.Hysteresis) && (rule.Min == nil || value >= *rule.Min+rule.Hysteresis)
+		if !state.firing && breached {
+			fire(fmt.Sprintf("%s is %.2f, outside the acceptable range %s", point.Field, value, describeRange(rule)))
+		} else if state.firing && cleared {
+			resolve(fmt.Sprintf("%s is back to %.2f, within %s", point.Field, value, describeRange(rule)))
+		}
+
+	case models.RuleTypeDurationAbove:
+		duration, _ := time.ParseDuration(rule.Duration)
+		if value > *rule.Max {
+			if state.aboveSince.IsZero() {
+				state.aboveSince = point.Time
+			}
+			if !state.firing && point.Time.Sub(state.aboveSince) >= duration {
+				fire(fmt.Sprintf("%s has been above %.2f for %s (now %.2f)", point.Field, *rule.Max, point.Time.Sub(state.aboveSince).Round(time.Second), value))
+			}
+		} else {
+			state.aboveSince = time.Time{}
+			if state.firing && value <= *rule.Max-rule.Hysteresis {
+				resolve(fmt.Sprintf("%s is back to %.2f, below %.2f", point.Field, value, *rule.Max))
+			}
+		}
+
+	case models.RuleTypeRateOfChange:
+		if state.hasLast {
+			if elapsed := point.Time.Sub(state.lastTime).Seconds(); elapsed > 0 {
+				rate := math.Abs(value-state.lastValue) / elapsed
+				if !state.firing && rate > rule.MaxRate {
+					fire(fmt.Sprintf("%s changes by %.3f/s, above the limit of %.3f/s", point.Field, rate, rule.MaxRate))
+				} else if state.firing && rate <= rule.MaxRate-rule.Hysteresis {
+					resolve(fmt.Sprintf("%s changes by %.3f/s, back under %.3f/s", point.Field, rate, rule.MaxRate))
+				}
+			}
+		}
+
+	case models.RuleTypeAnomaly:
+		// Values are scored once the baseline holds a full window
+		if len(state.history) == rule.Window {
+			if baseline, ok := newAnomalyBaseline(rule.Method, state.history); ok {
+				score := baseline.score(value)
+				if !state.firing && math.Abs(score) >= rule.Threshold {
+					fire(fmt.Sprintf("%s is %.2f, anomalous against the expected %.2f (%s score %.2f)", point.Field, value, baseline.center, rule.Method, score))
+				} else if state.firing && math.Abs(score) < rule.Threshold-rule.Hysteresis {
+					resolve(fmt.Sprintf("%s is back to %.2f, expected %.2f (%s score %.2f)", point.Field, value, baseline.center, rule.Method, score))
+				}
+			}
+		}
+		if len(state.history) == rule.Window {
+			state.history = append(state.history[:0], state.history[1:]...)
+		}
+		state.history = append(state.history, value)
+
+	case models.RuleTypeMissingData:
+		if state.firing {
+			resolve(fmt.Sprintf("%s data received again from device %s", rule.Source, point.DeviceID))
+		}
+	}
+
+	state.lastValue = value
+	state.lastTime = point.Time
+	state.hasLast = true
+	return event
+}
+
+func newAlertEvent(rule models.AlertRule, deviceID, state string, value *float64, at time.Time, message string) models.AlertEvent {
+	return models.AlertEvent{
+		Time:       at,
+		RuleID:     rule.ID,
+		RuleName:   rule.Name,
+		RuleType:   rule.Type,
+		LocationID: rule.LocationID,
+		DeviceID:   deviceID,
+		Field:      rule.Field,
+		State:      state,
+		Severity:   rule.Severity,
+		Value:      value,
+		Message:    message,
+	}
+}
+
+func describeRange(rule models.AlertRule) string {
+	min, max := "-inf", "+inf"
+	if rule.Min != nil {
+		min = fmt.Sprintf("%.2f", *rule.Min)
+	}
+	if rule.Max != nil {
+		max = fmt.Sprintf("%.2f", *rule.Max)
+	}
+	return fmt.Sprintf("[%s, %s]", min, max)
+}
+
+// validateRule checks a rule and fills its defaults.
+func validateRule(rule *models.AlertRule) error {
+	invalid := func(message string) error {
+		return models.NewAPIError(models.ErrorCodeValidationFailed, message, nil, http.StatusBadRequest)
+	}
+
+	if rule.Name == "" {
+		return invalid("name is required")
+	}
+	if rule.Source != models.SourceSensor && rule.Source != models.SourceConsumption {
+		return invalid("source must be 'sensor' or 'consumption'")
+	}
+	if rule.Source == models.SourceConsumption && rule.DeviceID == "" {
+		return invalid("device_id is required for consumption rules")
+	}
+	if rule.Field == "" && rule.Type != models.RuleTypeMissingData {
+		return invalid("field is required")
+	}
+	if rule.Hysteresis < 0 {
+		return invalid("hysteresis must not be negative")
+	}
+	if rule.Severity == "" {
+		rule.Severity = "warning"
+	}
+
+	switch rule.Type {
+	case models.RuleTypeThreshold:
+		if rule.Min == nil && rule.Max == nil {
+			return invalid("threshold rules need min and/or max")
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return invalid("min must not be greater than max")
+		}
+	case models.RuleTypeDurationAbove:
+		if rule.Max == nil {
+			return invalid("duration_above rules need max")
+		}
+		if d, err := time.ParseDuration(rule.Duration); err != nil || d <= 0 {
+			return invalid("duration_above rules need a positive duration, e.g. '5m'")
+		}
+	case models.RuleTypeRateOfChange:
+		if rule.MaxRate <= 0 {
+			return invalid("rate_of_change rules need a positive max_rate")
+		}
+	case models.RuleTypeMissingData:
+		if d, err := time.ParseDuration(rule.Duration); err != nil || d <= 0 {
+			return invalid("missing_data rules need a positive duration, e.g. '10m'")
+		}
+	case models.RuleTypeAnomaly:
+		switch rule.Method {
+		case "":
+			rule.Method = models.AnomalyMethodZScore
+		case models.AnomalyMethodZScore, models.AnomalyMethodMAD:
+		default:
+			return invalid("anomaly rules support the 'zscore' and 'mad' methods")
+		}
+		if rule.Window == 0 {
+			rule.Window = defaultRollingWindow
+		}
+		if rule.Window < minRollingWindow || rule.Window > maxRollingWindow {
+			return invalid(fmt.Sprintf("anomaly rules need a window between %d and %d points", minRollingWindow, maxRollingWindow))
+		}
+		if rule.Threshold == 0 {
+			rule.Threshold = defaultAnomalyThreshold(rule.Method)
+		}
+		if rule.Threshold < 0 || rule.Hysteresis >= rule.Threshold {
+			return invalid("anomaly rules need a positive threshold, greater than the hysteresis")
+		}
+	default:
+		return invalid(fmt.Sprintf("unknown rule type '%s'", rule.Type))
+	}
+	return nil
+}
+
+func ruleNotFound(ruleID string) error {
+	return models.NewAPIError(models.ErrorCodeResourceNotFound, fmt.Sprintf("alert rule '%s' not found", ruleID), nil, http.StatusNotFound)
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Defaults and limits of the anomaly detection.
+const (
+	defaultRollingWindow   = 30
+	minRollingWindow       = 5
+	maxRollingWindow       = 1000
+	defaultZScoreThreshold = 3.0
+	defaultMADThreshold    = 3.5
+	defaultAnomalyBaseline = "4w"
+	// maxAnomalyHistory bounds the history queried before the range.
+	maxAnomalyHistory = 10 * 365 * 24 * time.Hour
+	// minSeasonalSamples is the number of baseline values a seasonal slot needs before its windows are scored.
+	minSeasonalSamples = 3
+)
+
+// Robust scale factors: 1/0.6745 turns a median absolute deviation into a standard deviation for normal data, and
+// sqrt(pi/2) does the same for a mean absolute deviation, used when more than half of the values are equal.
+const (
+	madToStdDev    = 1.4826
+	meanADToStdDev = 1.253314
+)
+
+// Directions of an anomalous interval.
+const (
+	anomalyAbove = "above"
+	anomalyBelow = "below"
+)
+
+// DetectAnomalies scores each window of the aggregated series of a field against a baseline built from its history
+// and returns the intervals whose absolute score reaches the threshold. The rolling methods compare each window with
+// the trailing windows before it, the seasonal method with the windows of the same hour (and weekday) over the
+// baseline period preceding the range.
+func (s *DataService) DetectAnomalies(ctx context.Context, req models.AnomalyRequest) (models.AnomalyResponse, error) {
+	if req.DeviceID == "" || req.Field == "" {
+		return models.AnomalyResponse{}, models.NewAPIError(models.ErrorCodeMissingParameter, "device_id and field are required", nil, http.StatusBadRequest)
+	}
+	invalid := func(message string) error {
+		return models.NewAPIError(models.ErrorCodeValidationFailed, message, nil, http.StatusBadRequest)
+	}
+	switch req.Method {
+	case "":
+		req.Method = models.AnomalyMethodZScore
+	case models.AnomalyMethodZScore, models.AnomalyMethodMAD, models.AnomalyMethodSeasonal:
+	default:
+		return models.AnomalyResponse{}, invalid("method must be 'zscore', 'mad' or 'seasonal'")
+	}
+	threshold := defaultAnomalyThreshold(req.Method)
+	if req.Threshold != nil {
+		if *req.Threshold <= 0 {
+			return models.AnomalyResponse{}, invalid("threshold must be positive")
+		}
+		threshold = *req.Threshold
+	}
+	if req.RollingWindow == 0 {
+		req.RollingWindow = defaultRollingWindow
+	}
+	if req.RollingWindow < minRollingWindow || req.RollingWindow > maxRollingWindow {
+		return models.AnomalyResponse{}, invalid(fmt.Sprintf("rolling_window must be between %d and %d", minRollingWindow, maxRollingWindow))
+	}
+
+	var baselinePeriod time.Duration
+	if req.Method == models.AnomalyMethodSeasonal {
+		switch req.Seasonality {
+		case "":
+			req.Seasonality = models.SeasonalityHourOfDay
+		case models.SeasonalityHourOfDay, models.SeasonalityDayOfWeek:
+		default:
+			return models.AnomalyResponse{}, invalid("seasonality must be 'hour_of_day' or 'day_of_week'")
+		}
+		if req.Baseline == "" {
+			req.Baseline = defaultAnomalyBaseline
+		}
+		var ok bool
+		if baselinePeriod, ok = parseWindow(req.Baseline); !ok || baselinePeriod > maxAnomalyHistory {
+			return models.AnomalyResponse{}, models.NewAPIError(models.ErrorCodeInvalidFormat,
+				"baseline must be a positive duration (e.g. '672h') or a calendar period ('4w', '3mo') of at most 10 years", nil, http.StatusBadRequest)
+		}
+	} else {
+		req.Seasonality = ""
+	}
+
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return models.AnomalyResponse{}, err
+	}
+
+	// The history before the range must fit in the point budget too. The rolling history depends on the window and
+	// a longer history may call for a larger window, so the planning is repeated until the window is stable.
+	history := func(window string) (time.Duration, error) {
+		if req.Method == models.AnomalyMethodSeasonal {
+			return baselinePeriod, nil
+		}
+		d, _ := parseWindow(window)
+		if float64(d)*float64(req.RollingWindow) > float64(maxAnomalyHistory) {
+			return 0, invalid("the rolling window spans more than 10 years, please use a smaller window_period or rolling_window")
+		}
+		return time.Duration(req.RollingWindow) * d, nil
+	}
+	window, err := planWindow(req.TimeRangeStart, req.TimeRangeStop, req.WindowPeriod, 1)
+	if err != nil {
+		return models.AnomalyResponse{}, err
+	}
+	var from time.Time
+	for {
+		lookback, err := history(window)
+		if err != nil {
+			return models.AnomalyResponse{}, err
+		}
+		from = start.Add(-lookback)
+		planned, err := planWindow(from.Format(time.RFC3339), req.TimeRangeStop, req.WindowPeriod, 1)
+		if err != nil {
+			return models.AnomalyResponse{}, err
+		}
+		if planned == window {
+			break
+		}
+		window = planned
+	}
+
+	points, unit, err := s.fieldSeries(ctx, seriesSelector{
+		Source:     req.Source,
+		LocationID: req.LocationID,
+		DeviceID:   req.DeviceID,
+		Field:      req.Field,
+		Window:     window,
+		Timezone:   req.Timezone,
+		Unit:       req.Unit,
+	}, from, stop)
+	if err != nil {
+		return models.AnomalyResponse{}, err
+	}
+
+	var scores []models.AnomalyScore
+	if req.Method == models.AnomalyMethodSeasonal {
+		_, loc, err := s.timezones.Resolve(req.Timezone, req.LocationID)
+		if err != nil {
+			return models.AnomalyResponse{}, err
+		}
+		scores = scoreSeasonal(points, start, seasonalSlot(req.Seasonality, loc))
+	} else {
+		scores = scoreRolling(points, start, req.Method, req.RollingWindow)
+	}
+	for i := range scores {
+		scores[i].Anomalous = scores[i].Score != nil && math.Abs(*scores[i].Score) >= threshold
+	}
+
+	resp := models.AnomalyResponse{
+		DeviceID:     req.DeviceID,
+		Field:        req.Field,
+		Unit:         unit,
+		Method:       req.Method,
+		Threshold:    threshold,
+		WindowPeriod: window,
+		Seasonality:  req.Seasonality,
+		Anomalies:    anomalyIntervals(scores),
+	}
+	if req.IncludeScores {
+		resp.Scores = scores
+	}
+	return resp, nil
+}
+
+// defaultAnomalyThreshold is the threshold of a method when none is given.
+func defaultAnomalyThreshold(method string) float64 {
+	if method == models.AnomalyMethodZScore {
+		return defaultZScoreThreshold
+	}
+	return defaultMADThreshold
+}
+
+// anomalyBaseline is the center and scale of the values a window is compared with.
+type anomalyBaseline struct {
+	center float64
+	scale  float64
+}
+
+// newAnomalyBaseline computes the baseline of values: mean and standard deviation for the z-score, median and
+// scaled median absolute deviation otherwise. ok is false when the values have no spread.
+func newAnomalyBaseline(method string, values []float64) (anomalyBaseline, bool) {
+	if len(values) == 0 {
+		return anomalyBaseline{}, false
+	}
+	if method == models.AnomalyMethodZScore {
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		mean := sum / float64(len(values))
+		var squares float64
+		for _, v := range values {
+			squares += (v - mean) * (v - mean)
+		}
+		stddev := math.Sqrt(squares / float64(len(values)))
+		return anomalyBaseline{center: mean, scale: stddev}, stddev > 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	median := percentile(sorted, 50)
+	deviations := make([]float64, len(sorted))
+	var sumDeviations float64
+	for i, v := range sorted {
+		deviations[i] = math.Abs(v - median)
+		sumDeviations += deviations[i]
+	}
+	sort.Float64s(deviations)
+	scale := madToStdDev * percentile(deviations, 50)
+	if scale == 0 {
+		scale = meanADToStdDev * sumDeviations / float64(len(deviations))
+	}
+	return anomalyBaseline{center: median, scale: scale}, scale > 0
+}
+
+// score is the signed deviation of value from the baseline, in scale units.
+func (b anomalyBaseline) score(value float64) float64 {
+	return (value - b.center) / b.scale
+}
+
+// scoreRolling scores the windows from start on against the last n non-empty windows before each of them. A window
+// is scored once at least half of its trailing windows have a value.
+func scoreRolling(points []models.DataPoint, start time.Time, method string, n int) []models.AnomalyScore {
+	scores := make([]models.AnomalyScore, 0, len(points))
+	trailing := make([]float64, 0, n)
+	for _, p := range points {
+		inRange := p.Time.After(start)
+		if inRange {
+			score := models.AnomalyScore{Time: p.Time, Value: p.Value}
+			if p.Value != nil && 2*len(trailing) >= n {
+				if baseline, ok := newAnomalyBaseline(method, trailing); ok {
+					expected, value := baseline.center, baseline.score(*p.Value)
+					score.Expected, score.Score = &expected, &value
+				}
+			}
+			scores = append(scores, score)
+		}
+		if p.Value != nil {
+			if len(trailing) == n {
+				trailing = append(trailing[:0], trailing[1:]...)
+			}
+			trailing = append(trailing, *p.Value)
+		}
+	}
+	return scores
+}
+
+// seasonalSlot returns the function placing a time in its seasonal slot: the hour of the day, or the hour of the
+// week, in loc.
+func seasonalSlot(seasonality string, loc *time.Location) func(time.Time) int {
+	if seasonality == models.SeasonalityDayOfWeek {
+		return func(t time.Time) int {
+			t = t.In(loc)
+			return int(t.Weekday())*24 + t.Hour()
+		}
+	}
+	return func(t time.Time) int { return t.In(loc).Hour() }
+}
+
+// scoreSeasonal scores the windows from start on against the robust baseline of the windows of the same slot before
+// start.
+func scoreSeasonal(points []models.DataPoint, start time.Time, slot func(time.Time) int) []models.AnomalyScore {
+	history := make(map[int][]float64)
+	for _, p := range points {
+		if !p.Time.After(start) && p.Value != nil {
+			history[slot(p.Time)] = append(history[slot(p.Time)], *p.Value)
+		}
+	}
+	baselines := make(map[int]anomalyBaseline, len(history))
+	for key, values := range history {
+		if len(values) < minSeasonalSamples {
+			continue
+		}
+		if baseline, ok := newAnomalyBaseline(models.AnomalyMethodMAD, values); ok {
+			baselines[key] = baseline
+		}
+	}
+
+	scores := make([]models.AnomalyScore, 0, len(points))
+	for _, p := range points {
+		if !p.Time.After(start) {
+			continue
+		}
+		score := models.AnomalyScore{Time: p.Time, Value: p.Value}
+		if baseline, ok := baselines[slot(p.Time)]; ok && p.Value != nil {
+			expected, value := baseline.center, baseline.score(*p.Value)
+			score.Expected, score.Score = &expected, &value
+		}
+		scores = append(scores, score)
+	}
+	return scores
+}
+
+// anomalyIntervals groups consecutive anomalous windows deviating in the same direction.
+func anomalyIntervals(scores []models.AnomalyScore) []models.AnomalyInterval {
+	intervals := []models.AnomalyInterval{}
+	var current *models.AnomalyInterval
+	for _, score := range scores {
+		if !score.Anomalous {
+			current = nil
+			continue
+		}
+		direction := anomalyAbove
+		if *score.Score < 0 {
+			direction = anomalyBelow
+		}
+		if current == nil || current.Direction != direction {
+			intervals = append(intervals, models.AnomalyInterval{Start: score.Time, Direction: direction})
+			current = &intervals[len(intervals)-1]
+		}
+		current.End = score.Time
+		current.Windows++
+		if math.Abs(*score.Score) > math.Abs(current.PeakScore) {
+			current.PeakTime, current.PeakValue, current.PeakScore, current.Expected = score.Time, *score.Value, *score.Score, *score.Expected
+		}
+	}
+	return intervals
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/repository"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SaveDeviceEvent stores a heartbeat or status event of a device in the location bucket.
+func (s *DataService) SaveDeviceEvent(ctx context.Context, locationID string, event models.DeviceEvent) error {
+	if event.DeviceID == "" {
+		return models.NewAPIError(models.ErrorCodeMissingParameter, "device_id is required", nil, http.StatusBadRequest)
+	}
+	if event.Type == models.DeviceEventStatus && event.Status == "" {
+		return models.NewAPIError(models.ErrorCodeMissingParameter, "status is required", nil, http.StatusBadRequest)
+	}
+
+	if err := s.ensureLocationBucket(ctx, locationID); err != nil {
+		return err
+	}
+	return s.repo.WriteDeviceEvent(ctx, locationID, event)
+}
+
+// GetAvailability derives the online intervals of the requested devices of a location from their heartbeat and status
+// events and reports their uptime, outages, MTBF and MTTR over the time range.
+func (s *DataService) GetAvailability(ctx context.Context, req models.AvailabilityRequest) (models.AvailabilityResponse, error) {
+	start, stop, timeout, err := s.availabilityRange(req.TimeRangeStart, req.TimeRangeStop, req.Timeout)
+	if err != nil {
+		return models.AvailabilityResponse{}, err
+	}
+
+	// A device may go on and off once per timeout, which bounds the events read per device
+	if periods := float64(stop.Sub(start)+timeout) / float64(timeout); periods > repository.MAX_API_QUERY_POINTS {
+		return models.AvailabilityResponse{}, models.NewAPIError(models.ErrorCodeValidationFailed,
+			fmt.Sprintf("query too broad: %.0f heartbeat timeouts exceed the limit of %d. Please reduce the time range or use a longer timeout", periods, repository.MAX_API_QUERY_POINTS), nil, http.StatusBadRequest)
+	}
+
+	// Events up to one timeout before the range tell whether the devices were online when it starts
+	events, err := s.repo.QueryDeviceEvents(ctx, req.LocationID, req.DeviceIDs, start.Add(-timeout), stop, timeout)
+	if err != nil {
+		return models.AvailabilityResponse{}, fmt.Errorf("error querying device events: %w", err)
+	}
+
+	byDevice := make(map[string][]models.DeviceEvent)
+	devices := make(map[string]bool)
+	for _, e := range events {
+		byDevice[e.DeviceID] = append(byDevice[e.DeviceID], e)
+		devices[e.DeviceID] = true
+	}
+	for _, deviceID := range req.DeviceIDs {
+		devices[deviceID] = true // Reported as offline over the whole range when it never reported
+	}
+
+	resp := models.AvailabilityResponse{
+		LocationID: req.LocationID,
+		Start:      start,
+		Stop:       stop,
+		Timeout:    timeout.String(),
+		Devices:    []models.DeviceAvailability{},
+	}
+	var uptime, downtime time.Duration
+	outages := 0
+	for _, deviceID := range sortedKeys(devices) {
+		online := onlineIntervals(byDevice[deviceID], timeout, start, stop)
+		device := models.DeviceAvailability{DeviceID: deviceID, Outages: outagesBetween(online, start, stop)}
+
+		var deviceUptime time.Duration
+		for _, in := range online {
+			deviceUptime += in.end.Sub(in.start)
+		}
+		deviceDowntime := stop.Sub(start) - deviceUptime
+		device.Availability = summariseAvailability(deviceUptime, deviceDowntime, len(device.Outages))
+		resp.Devices = append(resp.Devices, device)
+
+		uptime += deviceUptime
+		downtime += deviceDowntime
+		outages += len(device.Outages)
+	}
+	resp.Location = summariseAvailability(uptime, downtime, outages)
+	return resp, nil
+}
+
+// EventDevices returns the devices of a location with heartbeat or status events that bear on their availability over
+// the time range of an availability request.
+func (s *DataService) EventDevices(ctx context.Context, locationID, rawStart, rawStop, rawTimeout string) ([]string, error) {
+	start, stop, timeout, err := s.availabilityRange(rawStart, rawStop, rawTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListDevices(ctx, locationID, "device_events", start.Add(-timeout), stop)
+}
+
+// availabilityRange parses the time range and heartbeat timeout of an availability request. The range ends now at the
+// latest: the future is neither uptime nor downtime.
+func (s *DataService) availabilityRange(rawStart, rawStop, rawTimeout string) (time.Time, time.Time, time.Duration, error) {
+	start, stop, err := parseTimeRange(rawStart, rawStop)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, err
+	}
+	timeout, err := parseOptionalDuration("timeout", rawTimeout, s.heartbeatTimeout)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, err
+	}
+	if now := time.Now(); stop.After(now) {
+		stop = now
+	}
+	if !start.Before(stop) {
+		return time.Time{}, time.Time{}, 0, models.NewAPIError(models.ErrorCodeValidationFailed, "time_range_start must be in the past", nil, http.StatusBadRequest)
+	}
+	return start, stop, timeout, nil
+}
+
+// interval is a half-open [start, end) time interval.
+type interval struct {
+	start, end time.Time
+}
+
+// onlineIntervals derives the periods during which a device was online from its events in chronological order,
+// clipped to [from, to]. Any event other than an "offline" status keeps the device online for timeout; an
+// "offline" status ends the period immediately. The events may be reduced to the boundaries of the periods, as
+// returned by QueryDeviceEvents: the gap of an event then locates the previous, skipped event.
+func onlineIntervals(events []models.DeviceEvent, timeout time.Duration, from, to time.Time) []interval {
+	var intervals []interval
+	add := func(start, end time.Time) {
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if start.Before(end) {
+			intervals = append(intervals, interval{start, end})
+		}
+	}
+
+	var current *interval
+	for _, e := range events {
+		if current != nil && e.Gap != nil {
+			// The skipped events kept the device online until one timeout after the previous event
+			if end := e.Time.Add(-*e.Gap).Add(timeout); end.After(current.end) {
+				current.end = end
+			}
+		}
+		if strings.EqualFold(e.Status, models.DeviceStatusOffline) {
+			if current != nil {
+				if e.Time.Before(current.end) {
+					current.end = e.Time
+				}
+				add(current.start, current.end)
+				current = nil
+			}
+			continue
+		}
+		if current != nil && !e.Time.After(current.end) {
+			current.end = e.Time.Add(timeout)
+			continue
+		}
+		if current != nil {
+			add(current.start, current.end)
+		}
+		current = &interval{start: e.Time, end: e.Time.Add(timeout)}
+	}
+	if current != nil {
+		add(current.start, current.end)
+	}
+	return intervals
+}
+
+// outagesBetween returns the gaps between the online intervals within [from, to].
+func outagesBetween(online []interval, from, to time.Time) []models.Outage {
+	outages := []models.Outage{}
+	add := func(start, end time.Time) {
+		if start.Before(end) {
+			outages = append(outages, models.Outage{Start: start, End: end, DurationSeconds: end.Sub(start).Seconds()})
+		}
+	}
+	cursor := from
+	for _, in := range online {
+		add(cursor, in.start)
+		cursor = in.end
+	}
+	add(cursor, to)
+	return outages
+}
+
+// summariseAvailability computes the uptime percentage, MTBF and MTTR from the total uptime, downtime and number of
+// outages.
+func summariseAvailability(uptime, downtime time.Duration, outages int) models.Availability {
+	a := models.Availability{
+		UptimeSeconds:   uptime.Seconds(),
+		DowntimeSeconds: downtime.Seconds(),
+		OutageCount:     outages,
+	}
+	if total := uptime + downtime; total > 0 {
+		a.UptimePercent = 100 * uptime.Seconds() / total.Seconds()
+	}
+	if outages > 0 {
+		mtbf := uptime.Seconds() / float64(outages)
+		mttr := downtime.Seconds() / float64(outages)
+		a.MTBFSeconds, a.MTTRSeconds = &mtbf, &mttr
+	}
+	return a
+}
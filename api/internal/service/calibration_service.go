@@ -0,0 +1,311 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// calibrationDocumentKind is the settings document kind holding the calibration profiles of one sensor.
+const calibrationDocumentKind = "calibration"
+
+// calibrationStore caches the calibration profiles of every sensor, keyed by "deviceID/sensorID" and sorted by
+// EffectiveFrom.
+type calibrationStore struct {
+	mu       sync.RWMutex
+	profiles map[string][]models.CalibrationProfile
+}
+
+func calibrationKey(deviceID, sensorID string) string {
+	return deviceID + "/" + sensorID
+}
+
+// newID returns a random identifier for API-managed resources.
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// LoadCalibrations loads the calibration profiles stored in InfluxDB into memory. Call it once at startup.
+func (s *DataService) LoadCalibrations(ctx context.Context) error {
+	documents, err := s.repo.LoadDocuments(ctx, calibrationDocumentKind)
+	if err != nil {
+		return fmt.Errorf("error loading calibration profiles: %w", err)
+	}
+
+	profiles := make(map[string][]models.CalibrationProfile, len(documents))
+	for key, document := range documents {
+		var list []models.CalibrationProfile
+		if err := json.Unmarshal(document, &list); err != nil {
+			log.Printf("Skipping invalid calibration document '%s': %v", key, err)
+			continue
+		}
+		profiles[key] = list
+	}
+
+	s.calibrations.mu.Lock()
+	s.calibrations.profiles = profiles
+	s.calibrations.mu.Unlock()
+	log.Printf("Loaded calibration profiles for %d sensors", len(profiles))
+	return nil
+}
+
+// ListCalibrations returns the calibration profiles of every sensor of a device.
+func (s *DataService) ListCalibrations(deviceID string) []models.CalibrationProfile {
+	s.calibrations.mu.RLock()
+	defer s.calibrations.mu.RUnlock()
+
+	result := []models.CalibrationProfile{}
+	prefix := deviceID + "/"
+	for key, list := range s.calibrations.profiles {
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, list...)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SensorID != result[j].SensorID {
+			return result[i].SensorID < result[j].SensorID
+		}
+		return result[i].EffectiveFrom.Before(result[j].EffectiveFrom)
+	})
+	return result
+}
+
+// CreateCalibration adds a calibration profile to a sensor.
+func (s *DataService) CreateCalibration(ctx context.Context, deviceID, sensorID string, profile models.CalibrationProfile) (models.CalibrationProfile, error) {
+	profile.ID = newID()
+	profile.DeviceID = deviceID
+	profile.SensorID = sensorID
+	if err := validateCalibration(profile); err != nil {
+		return models.CalibrationProfile{}, err
+	}
+
+	err := s.updateCalibrations(ctx, deviceID, sensorID, func(list []models.CalibrationProfile) ([]models.CalibrationProfile, error) {
+		return append(list, profile), nil
+	})
+	if err != nil {
+		return models.CalibrationProfile{}, err
+	}
+	return profile, nil
+}
+
+// UpdateCalibration replaces an existing calibration profile of a sensor.
+func (s *DataService) UpdateCalibration(ctx context.Context, deviceID, sensorID, profileID string, profile models.CalibrationProfile) (models.CalibrationProfile, error) {
+	profile.ID = profileID
+	profile.DeviceID = deviceID
+	profile.SensorID = sensorID
+	if err := validateCalibration(profile); err != nil {
+		return models.CalibrationProfile{}, err
+	}
+
+	err := s.updateCalibrations(ctx, deviceID, sensorID, func(list []models.CalibrationProfile) ([]models.CalibrationProfile, error) {
+		for i := range list {
+			if list[i].ID == profileID {
+				list[i] = profile
+				return list, nil
+			}
+		}
+		return nil, calibrationNotFound(profileID)
+	})
+	if err != nil {
+		return models.CalibrationProfile{}, err
+	}
+	return profile, nil
+}
+
+// DeleteCalibration removes a calibration profile from a sensor.
+func (s *DataService) DeleteCalibration(ctx context.Context, deviceID, sensorID, profileID string) error {
+	return s.updateCalibrations(ctx, deviceID, sensorID, func(list []models.CalibrationProfile) ([]models.CalibrationProfile, error) {
+		for i := range list {
+			if list[i].ID == profileID {
+				return append(list[:i], list[i+1:]...), nil
+			}
+		}
+		return nil, calibrationNotFound(profileID)
+	})
+}
+
+// updateCalibrations applies change to a copy of the profiles of a sensor, persists the result and then
+// updates the cache.
+func (s *DataService) updateCalibrations(ctx context.Context, deviceID, sensorID string, change func([]models.CalibrationProfile) ([]models.CalibrationProfile, error)) error {
+	key := calibrationKey(deviceID, sensorID)
+
+	s.calibrations.mu.Lock()
+	defer s.calibrations.mu.Unlock()
+
+	current := append([]models.CalibrationProfile(nil), s.calibrations.profiles[key]...)
+	updated, err := change(current)
+	if err != nil {
+		return err
+	}
+	sort.Slice(updated, func(i, j int) bool { return updated[i].EffectiveFrom.Before(updated[j].EffectiveFrom) })
+
+	if len(updated) == 0 {
+		err = s.repo.DeleteDocument(ctx, calibrationDocumentKind, key)
+	} else {
+		var document []byte
+		document, err = json.Marshal(updated)
+		if err == nil {
+			err = s.repo.SaveDocument(ctx, calibrationDocumentKind, key, document)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error saving calibration profiles: %w", err)
+	}
+
+	if s.calibrations.profiles == nil {
+		s.calibrations.profiles = make(map[string][]models.CalibrationProfile)
+	}
+	if len(updated) == 0 {
+		delete(s.calibrations.profiles, key)
+	} else {
+		s.calibrations.profiles[key] = updated
+	}
+	return nil
+}
+
+// RecomputeCalibration reapplies the current calibration profiles of a sensor to the raw values stored over a range,
+// overwriting the calibrated values in place.
+func (s *DataService) RecomputeCalibration(ctx context.Context, deviceID, sensorID string, req models.RecomputeCalibrationRequest) (models.RecomputeCalibrationResponse, error) {
+	if req.LocationID == "" || req.Field == "" {
+		return models.RecomputeCalibrationResponse{}, models.NewAPIError(models.ErrorCodeMissingParameter, "location_id and field are required", nil, http.StatusBadRequest)
+	}
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return models.RecomputeCalibrationResponse{}, err
+	}
+
+	points, err := s.repo.QueryRawSensorData(ctx, req.LocationID, deviceID, sensorID, req.Field, start, stop)
+	if err != nil {
+		return models.RecomputeCalibrationResponse{}, fmt.Errorf("error reading raw sensor data: %w", err)
+	}
+
+	s.calibrations.mu.RLock()
+	profiles := s.calibrations.profiles[calibrationKey(deviceID, sensorID)]
+	s.calibrations.mu.RUnlock()
+
+	rewritten := make([]models.SensorData, 0, len(points))
+	for _, p := range points {
+		raw := p.RawValue
+		value := raw
+		if profile := effectiveCalibration(profiles, p.Time); profile != nil {
+			value = applyCalibration(*profile, raw)
+		}
+		rewritten = append(rewritten, models.SensorData{
+			DeviceID:  deviceID,
+			SensorID:  sensorID,
+			Field:     req.Field,
+			Value:     value,
+			RawValue:  &raw,
+			Timestamp: p.Time.Format(time.RFC3339Nano),
+			// Keep the original tags, quality flags included, so the point overwrites itself rather than creating a
+			// new series
+			Tags: p.Tags,
+		})
+	}
+
+	if err := s.repo.WriteSensorDataBatch(ctx, req.LocationID, rewritten); err != nil {
+		return models.RecomputeCalibrationResponse{}, fmt.Errorf("error rewriting calibrated data: %w", err)
+	}
+	s.latest.invalidate(req.LocationID, deviceID)
+	log.Printf("Recomputed calibration of sensor %s (device %s): %d points rewritten", sensorID, deviceID, len(rewritten))
+	return models.RecomputeCalibrationResponse{SensorID: sensorID, PointsRewritten: len(rewritten)}, nil
+}
+
+// calibrate replaces the value of data with its calibrated value when a profile applies, keeping the raw value.
+func (s *DataService) calibrate(data *models.SensorData) {
+	if data.SensorID == "" {
+		return
+	}
+	s.calibrations.mu.RLock()
+	profiles := s.calibrations.profiles[calibrationKey(data.DeviceID, data.SensorID)]
+	s.calibrations.mu.RUnlock()
+	if len(profiles) == 0 {
+		return
+	}
+
+	profile := effectiveCalibration(profiles, readingTime(data.Timestamp))
+	if profile == nil {
+		return
+	}
+	raw := data.Value
+	data.RawValue = &raw
+	data.Value = applyCalibration(*profile, raw)
+}
+
+// effectiveCalibration returns the profile in force at t, i.e. the latest one whose EffectiveFrom is not after t.
+// profiles must be sorted by EffectiveFrom.
+func effectiveCalibration(profiles []models.CalibrationProfile, t time.Time) *models.CalibrationProfile {
+	var found *models.CalibrationProfile
+	for i := range profiles {
+		if profiles[i].EffectiveFrom.After(t) {
+			break
+		}
+		found = &profiles[i]
+	}
+	return found
+}
+
+// applyCalibration computes the calibrated value of raw.
+func applyCalibration(profile models.CalibrationProfile, raw float64) float64 {
+	if len(profile.Polynomial) > 0 {
+		// Horner's method
+		value := 0.0
+		for i := len(profile.Polynomial) - 1; i >= 0; i-- {
+			value = value*raw + profile.Polynomial[i]
+		}
+		return value
+	}
+	gain := 1.0
+	if profile.Gain != nil {
+		gain = *profile.Gain
+	}
+	return raw*gain + profile.Offset
+}
+
+func validateCalibration(profile models.CalibrationProfile) error {
+	if profile.EffectiveFrom.IsZero() {
+		return models.NewAPIError(models.ErrorCodeMissingParameter, "effective_from is required", nil, http.StatusBadRequest)
+	}
+	if profile.Gain != nil && *profile.Gain == 0 {
+		return models.NewAPIError(models.ErrorCodeValidationFailed, "gain must not be zero", nil, http.StatusBadRequest)
+	}
+	return nil
+}
+
+func calibrationNotFound(profileID string) error {
+	return models.NewAPIError(models.ErrorCodeResourceNotFound, fmt.Sprintf("calibration profile '%s' not found", profileID), nil, http.StatusNotFound)
+}
+
+// parseTimeRange parses a time range and checks that start is strictly before stop. Each bound is an RFC3339 time,
+// "now()" or a negative Flux duration such as "-1h" or "-7d", resolved against the current time.
+func parseTimeRange(rawStart, rawStop string) (time.Time, time.Time, error) {
+	if rawStart == "" || rawStop == "" {
+		return time.Time{}, time.Time{}, models.NewAPIError(models.ErrorCodeMissingParameter, "time_range_start and time_range_stop are required", nil, http.StatusBadRequest)
+	}
+	now := time.Now()
+	start, err := parseTimeBound(rawStart, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, models.NewAPIError(models.ErrorCodeInvalidFormat, fmt.Sprintf("invalid time_range_start format: %v", err), nil, http.StatusBadRequest)
+	}
+	stop, err := parseTimeBound(rawStop, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, models.NewAPIError(models.ErrorCodeInvalidFormat, fmt.Sprintf("invalid time_range_stop format: %v", err), nil, http.StatusBadRequest)
+	}
+	if !start.Before(stop) {
+		return time.Time{}, time.Time{}, models.NewAPIError(models.ErrorCodeValidationFailed, "time range start must be strictly before time range stop", nil, http.StatusBadRequest)
+	}
+	return start, stop, nil
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Defaults of the change-point detection.
+const (
+	defaultMinSegment = 5
+	minMinSegment     = 2
+)
+
+// DetectChangePoints segments the aggregated series of a field with PELT (Pruned Exact Linear Time) under a normal
+// likelihood cost and returns the change points with the mean and variance of the segments on each side.
+// Empty windows are ignored.
+func (s *DataService) DetectChangePoints(ctx context.Context, req models.ChangePointRequest) (models.ChangePointResponse, error) {
+	if req.DeviceID == "" || req.Field == "" {
+		return models.ChangePointResponse{}, models.NewAPIError(models.ErrorCodeMissingParameter, "device_id and field are required", nil, http.StatusBadRequest)
+	}
+	invalid := func(message string) error {
+		return models.NewAPIError(models.ErrorCodeValidationFailed, message, nil, http.StatusBadRequest)
+	}
+	switch req.Cost {
+	case "":
+		req.Cost = models.ChangePointCostMeanVar
+	case models.ChangePointCostMean, models.ChangePointCostMeanVar:
+	default:
+		return models.ChangePointResponse{}, invalid("cost must be 'mean' or 'meanvar'")
+	}
+	if req.Penalty != nil && *req.Penalty <= 0 {
+		return models.ChangePointResponse{}, invalid("penalty must be positive")
+	}
+	if req.MinSegment == 0 {
+		req.MinSegment = defaultMinSegment
+	}
+	if req.MinSegment < minMinSegment {
+		return models.ChangePointResponse{}, invalid(fmt.Sprintf("min_segment must be at least %d", minMinSegment))
+	}
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return models.ChangePointResponse{}, err
+	}
+	window, err := planWindow(req.TimeRangeStart, req.TimeRangeStop, req.WindowPeriod, 1)
+	if err != nil {
+		return models.ChangePointResponse{}, err
+	}
+
+	points, unit, err := s.fieldSeries(ctx, seriesSelector{
+		Source:     req.Source,
+		LocationID: req.LocationID,
+		DeviceID:   req.DeviceID,
+		Field:      req.Field,
+		Window:     window,
+		Timezone:   req.Timezone,
+		Unit:       req.Unit,
+		Fill:       fillNone,
+	}, start, stop)
+	if err != nil {
+		return models.ChangePointResponse{}, err
+	}
+	times := make([]time.Time, 0, len(points))
+	y := make([]float64, 0, len(points))
+	for _, p := range points {
+		if p.Value != nil {
+			times = append(times, p.Time)
+			y = append(y, *p.Value)
+		}
+	}
+
+	resp := models.ChangePointResponse{
+		DeviceID:     req.DeviceID,
+		Field:        req.Field,
+		Unit:         unit,
+		WindowPeriod: window,
+		Cost:         req.Cost,
+		ChangePoints: []models.ChangePoint{},
+		Segments:     []models.Segment{},
+	}
+	if len(y) == 0 {
+		return resp, nil
+	}
+	resp.Penalty = bicPenalty(req.Cost, len(y))
+	if req.Penalty != nil {
+		resp.Penalty = *req.Penalty
+	}
+
+	cost := newSegmentCost(req.Cost, y)
+	bounds := pelt(len(y), req.MinSegment, resp.Penalty, cost.cost)
+	previous := 0
+	for _, bound := range bounds {
+		resp.Segments = append(resp.Segments, cost.segment(previous, bound, times))
+		previous = bound
+	}
+	for i := 1; i < len(resp.Segments); i++ {
+		before, after := resp.Segments[i-1], resp.Segments[i]
+		resp.ChangePoints = append(resp.ChangePoints, models.ChangePoint{
+			Time:      after.Start,
+			Before:    before,
+			After:     after,
+			MeanShift: after.Mean - before.Mean,
+		})
+	}
+	return resp, nil
+}
+
+// bicPenalty is the Bayesian Information Criterion penalty of a change point in n values: ln(n) per parameter added,
+// the change location plus the mean (and the variance for "meanvar").
+func bicPenalty(cost string, n int) float64 {
+	params := 2.0
+	if cost == models.ChangePointCostMeanVar {
+		params = 3
+	}
+	return params * math.Log(float64(n))
+}
+
+// segmentCost computes the cost of the segments y[s:t] in constant time from prefix sums. The cost is twice the
+// negative normal log-likelihood of the segment, up to a constant.
+type segmentCost struct {
+	kind     string
+	sum      []float64 // sum[i] is the sum of y[:i]
+	squares  []float64
+	variance float64 // "mean" cost: variance of the whole series; "meanvar" cost: floor of the segment variances
+}
+
+// newSegmentCost prepares the cost of the segments of y.
+func newSegmentCost(kind string, y []float64) segmentCost {
+	c := segmentCost{kind: kind, sum: make([]float64, len(y)+1), squares: make([]float64, len(y)+1)}
+	for i, v := range y {
+		c.sum[i+1] = c.sum[i] + v
+		c.squares[i+1] = c.squares[i] + v*v
+	}
+	overall := c.segmentVariance(0, len(y))
+
+	if kind == models.ChangePointCostMean {
+		// The noise variance is estimated from the differences of consecutive values, which a few level shifts
+		// barely affect: MAD(diff) / (0.6745 * sqrt(2)) estimates the standard deviation of the noise.
+		if len(y) > 2 {
+			diffs := make([]float64, len(y)-1)
+			for i := 1; i < len(y); i++ {
+				diffs[i-1] = math.Abs(y[i] - y[i-1])
+			}
+			sort.Float64s(diffs)
+			sigma := madToStdDev * percentile(diffs, 50) / math.Sqrt2
+			c.variance = sigma * sigma
+		}
+		if c.variance == 0 {
+			c.variance = overall
+		}
+	} else {
+		// Segments of identical values would have an infinitely good fit, their variance is floored
+		c.variance = overall * 1e-6
+	}
+	return c
+}
+
+// segmentVariance is the population variance of y[s:t].
+func (c segmentCost) segmentVariance(s, t int) float64 {
+	n := float64(t - s)
+	sum := c.sum[t] - c.sum[s]
+	v := (c.squares[t]-c.squares[s])/n - (sum/n)*(sum/n)
+	return math.Max(v, 0)
+}
+
+// cost is the cost of the segment y[s:t].
+func (c segmentCost) cost(s, t int) float64 {
+	if c.variance == 0 {
+		return 0 // Constant series, no change to detect
+	}
+	n := float64(t - s)
+	if c.kind == models.ChangePointCostMean {
+		return n * c.segmentVariance(s, t) / c.variance
+	}
+	return n * math.Log(math.Max(c.segmentVariance(s, t), c.variance))
+}
+
+// segment describes the segment y[s:t].
+func (c segmentCost) segment(s, t int, times []time.Time) models.Segment {
+	return models.Segment{
+		Start:    times[s],
+		End:      times[t-1],
+		Windows:  t - s,
+		Mean:     (c.sum[t] - c.sum[s]) / float64(t-s),
+		Variance: c.segmentVariance(s, t),
+	}
+}
+
+// pelt returns the ends of the optimal segments of n values, the last one being n, minimizing the total cost plus
+// penalty per change point with segments of at least minSegment values (Killick, Fearnhead and Eckley, 2012).
+func pelt(n, minSegment int, penalty float64, cost func(s, t int) float64) []int {
+	if n < 2*minSegment {
+		return []int{n}
+	}
+	// best[t] is the optimal cost of y[:t] and last[t] the start of its last segment
+	best := make([]float64, n+1)
+	last := make([]int, n+1)
+	best[0] = -penalty
+	candidates := []int{0}
+	for t := minSegment; t <= n; t++ {
+		if s := t - minSegment; s >= minSegment {
+			candidates = append(candidates, s)
+		}
+		best[t] = math.Inf(1)
+		for _, s := range candidates {
+			if v := best[s] + cost(s, t) + penalty; v < best[t] {
+				best[t], last[t] = v, s
+			}
+		}
+		// Candidates that cannot start the last segment of a better segmentation are pruned
+		kept := candidates[:0]
+		for _, s := range candidates {
+			if best[s]+cost(s, t) <= best[t] {
+				kept = append(kept, s)
+			}
+		}
+		candidates = kept
+	}
+
+	var bounds []int
+	for t := n; t > 0; t = last[t] {
+		bounds = append(bounds, t)
+	}
+	for i, j := 0, len(bounds)-1; i < j; i, j = i+1, j-1 {
+		bounds[i], bounds[j] = bounds[j], bounds[i]
+	}
+	return bounds
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// piecewiseSeries concatenates normal segments of the given lengths, means and standard deviations.
+func piecewiseSeries(seed int64, lengths []int, means, stdDevs []float64) []float64 {
+	r := rand.New(rand.NewSource(seed))
+	var y []float64
+	for i, n := range lengths {
+		for j := 0; j < n; j++ {
+			y = append(y, means[i]+stdDevs[i]*r.NormFloat64())
+		}
+	}
+	return y
+}
+
+func TestPELTFindsKnownChangePoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		cost    string
+		lengths []int
+		means   []float64
+		stdDevs []float64
+	}{
+		{"no change", models.ChangePointCostMean, []int{120}, []float64{3}, []float64{1}},
+		{"mean shift", models.ChangePointCostMean, []int{50, 50}, []float64{0, 5}, []float64{1, 1}},
+		{"two mean shifts", models.ChangePointCostMean, []int{40, 50, 50}, []float64{0, 4, -3}, []float64{1, 1, 1}},
+		{"mean shift with meanvar", models.ChangePointCostMeanVar, []int{60, 60}, []float64{10, 16}, []float64{1, 1}},
+		{"variance change", models.ChangePointCostMeanVar, []int{60, 60}, []float64{0, 0}, []float64{0.5, 5}},
+		{"short segment", models.ChangePointCostMean, []int{50, 8, 50}, []float64{0, 10, 0}, []float64{1, 1, 1}},
+	}
+	const tolerance = 2 // Windows
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			y := piecewiseSeries(42, tt.lengths, tt.means, tt.stdDevs)
+			c := newSegmentCost(tt.cost, y)
+			bounds := pelt(len(y), defaultMinSegment, bicPenalty(tt.cost, len(y)), c.cost)
+
+			var want []int
+			end := 0
+			for _, n := range tt.lengths {
+				end += n
+				want = append(want, end)
+			}
+			if len(bounds) != len(want) {
+				t.Fatalf("segment ends = %v, want %v", bounds, want)
+			}
+			for i := range want {
+				if d := bounds[i] - want[i]; d < -tolerance || d > tolerance {
+					t.Errorf("segment ends = %v, want %v ± %d", bounds, want, tolerance)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestPELTMinSegment(t *testing.T) {
+	// A spike every 3 windows cannot be split into segments of at least 5 windows around each spike
+	y := make([]float64, 60)
+	for i := range y {
+		if i%3 == 0 {
+			y[i] = 10
+		}
+	}
+	c := newSegmentCost(models.ChangePointCostMeanVar, y)
+	for _, minSegment := range []int{2, 5, 10} {
+		bounds := pelt(len(y), minSegment, 0, c.cost)
+		start := 0
+		for _, end := range bounds {
+			if end-start < minSegment {
+				t.Errorf("min_segment %d: segment [%d, %d) too short in %v", minSegment, start, end, bounds)
+			}
+			start = end
+		}
+		if start != len(y) {
+			t.Errorf("min_segment %d: last segment ends at %d, want %d", minSegment, start, len(y))
+		}
+	}
+
+	if bounds := pelt(9, 5, 0, c.cost); len(bounds) != 1 || bounds[0] != 9 {
+		t.Errorf("series shorter than two segments split into %v", bounds)
+	}
+}
+
+func TestSegmentCostConstantSeries(t *testing.T) {
+	y := []float64{4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4}
+	for _, kind := range []string{models.ChangePointCostMean, models.ChangePointCostMeanVar} {
+		c := newSegmentCost(kind, y)
+		if bounds := pelt(len(y), 2, bicPenalty(kind, len(y)), c.cost); len(bounds) != 1 {
+			t.Errorf("%s: constant series split into %v", kind, bounds)
+		}
+	}
+}
+
+// optimalPartitioning is PELT without pruning, the exact reference of the pruned search.
+func optimalPartitioning(n, minSegment int, penalty float64, cost func(s, t int) float64) float64 {
+	best := make([]float64, n+1)
+	best[0] = -penalty
+	for t := 1; t <= n; t++ {
+		best[t] = math.Inf(1)
+		for s := 0; s <= t-minSegment; s++ {
+			if s != 0 && s < minSegment {
+				continue
+			}
+			if v := best[s] + cost(s, t) + penalty; v < best[t] {
+				best[t] = v
+			}
+		}
+	}
+	return best[n]
+}
+
+func TestPELTPruningIsExact(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		y := piecewiseSeries(seed, []int{30, 25, 35}, []float64{0, 1.5, -1}, []float64{1, 2, 1})
+		for _, kind := range []string{models.ChangePointCostMean, models.ChangePointCostMeanVar} {
+			c := newSegmentCost(kind, y)
+			penalty := bicPenalty(kind, len(y))
+			bounds := pelt(len(y), defaultMinSegment, penalty, c.cost)
+
+			total, start := float64(len(bounds)-1)*penalty, 0
+			for _, end := range bounds {
+				total += c.cost(start, end)
+				start = end
+			}
+			if want := optimalPartitioning(len(y), defaultMinSegment, penalty, c.cost); math.Abs(total-want) > 1e-6 {
+				t.Errorf("seed %d, %s: PELT cost %g, optimal %g", seed, kind, total, want)
+			}
+		}
+	}
+}
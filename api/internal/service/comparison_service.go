@@ -0,0 +1,181 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Period totals of a comparison.
+const (
+	totalMean = "mean"
+	totalSum  = "sum"
+)
+
+// maxComparisonOffsets bounds the number of periods queried by a comparison.
+const maxComparisonOffsets = 5
+
+// ComparePeriods runs the aggregated query of a field for a base range and for the same range shifted back by each
+// offset, and overlays the periods on a time axis relative to their start with per-window and total deltas.
+func (s *DataService) ComparePeriods(ctx context.Context, req models.ComparisonRequest) (models.ComparisonResponse, error) {
+	if req.DeviceID == "" || req.Field == "" {
+		return models.ComparisonResponse{}, models.NewAPIError(models.ErrorCodeMissingParameter, "device_id and field are required", nil, http.StatusBadRequest)
+	}
+	if len(req.Offsets) == 0 || len(req.Offsets) > maxComparisonOffsets {
+		return models.ComparisonResponse{}, models.NewAPIError(models.ErrorCodeValidationFailed, fmt.Sprintf("between 1 and %d offsets are required", maxComparisonOffsets), nil, http.StatusBadRequest)
+	}
+	switch req.Total {
+	case "":
+		req.Total = totalMean
+	case totalMean, totalSum:
+	default:
+		return models.ComparisonResponse{}, models.NewAPIError(models.ErrorCodeValidationFailed, "total must be 'mean' or 'sum'", nil, http.StatusBadRequest)
+	}
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return models.ComparisonResponse{}, err
+	}
+	// Every period uses the window of the base period so that their windows line up
+	window, err := planWindow(req.TimeRangeStart, req.TimeRangeStop, req.WindowPeriod, 1)
+	if err != nil {
+		return models.ComparisonResponse{}, err
+	}
+
+	_, loc, err := s.timezones.Resolve(req.Timezone, req.LocationID)
+	if err != nil {
+		return models.ComparisonResponse{}, err
+	}
+
+	resp := models.ComparisonResponse{Field: req.Field, WindowPeriod: window, Total: req.Total, Comparisons: []models.ComparisonPeriod{}}
+	resp.Base, resp.Unit, err = s.comparisonPeriod(ctx, req, start, stop, window)
+	if err != nil {
+		return models.ComparisonResponse{}, err
+	}
+	for _, offset := range req.Offsets {
+		periodStart, ok := shiftBack(start, offset, loc)
+		periodStop, _ := shiftBack(stop, offset, loc)
+		if !ok {
+			return models.ComparisonResponse{}, models.NewAPIError(models.ErrorCodeInvalidFormat,
+				fmt.Sprintf("invalid offset '%s', expected a duration (e.g. '168h') or a calendar offset ('1d', '1w', '1mo', '1y')", offset), nil, http.StatusBadRequest)
+		}
+		period, _, err := s.comparisonPeriod(ctx, req, periodStart, periodStop, window)
+		if err != nil {
+			return models.ComparisonResponse{}, err
+		}
+		period.Offset = offset
+		compareWithBase(resp.Base, &period)
+		resp.Comparisons = append(resp.Comparisons, period)
+	}
+	return resp, nil
+}
+
+// comparisonPeriod queries the aggregated series of one period and returns it with the unit of its values.
+func (s *DataService) comparisonPeriod(ctx context.Context, req models.ComparisonRequest, start, stop time.Time, window string) (models.ComparisonPeriod, string, error) {
+	points, unit, err := s.fieldSeries(ctx, seriesSelector{
+		Source:     req.Source,
+		LocationID: req.LocationID,
+		DeviceID:   req.DeviceID,
+		Field:      req.Field,
+		Window:     window,
+		Timezone:   req.Timezone,
+		Unit:       req.Unit,
+	}, start, stop)
+	if err != nil {
+		return models.ComparisonPeriod{}, "", err
+	}
+
+	period := models.ComparisonPeriod{Start: start, Stop: stop, Points: make([]models.ComparisonPoint, 0, len(points))}
+	var sum float64
+	var count int
+	for _, p := range points {
+		period.Points = append(period.Points, models.ComparisonPoint{OffsetSeconds: p.Time.Sub(start).Seconds(), Time: p.Time, Value: p.Value})
+		if p.Value != nil {
+			sum += *p.Value
+			count++
+		}
+	}
+	if count > 0 {
+		total := sum
+		if req.Total == totalMean {
+			total = sum / float64(count)
+		}
+		period.Total = &total
+	}
+	return period, unit, nil
+}
+
+// compareWithBase sets the deltas of the base period against a compared period, window by window at the same
+// position and on the totals.
+func compareWithBase(base models.ComparisonPeriod, period *models.ComparisonPeriod) {
+	for i := range period.Points {
+		if i < len(base.Points) {
+			period.Points[i].Delta, period.Points[i].DeltaPercent = delta(base.Points[i].Value, period.Points[i].Value)
+		}
+	}
+	period.TotalDelta, period.TotalDeltaPercent = delta(base.Total, period.Total)
+}
+
+// delta returns current - previous and its percentage of previous, unset when a value is missing or previous is 0.
+func delta(current, previous *float64) (*float64, *float64) {
+	if current == nil || previous == nil {
+		return nil, nil
+	}
+	d := *current - *previous
+	if *previous == 0 {
+		return &d, nil
+	}
+	pct := 100 * d / math.Abs(*previous)
+	return &d, &pct
+}
+
+// shiftBack moves t back by an offset, either a Go duration or a calendar offset ("2d", "1w", "1mo", "1y") applied
+// in loc.
+func shiftBack(t time.Time, offset string, loc *time.Location) (time.Time, bool) {
+	return shiftBy(t, offset, -1, loc)
+}
+
+// shiftBy moves t by n times an offset, either a Go duration or a calendar offset applied in loc. Times parsed from
+// RFC3339 carry a fixed offset, calendar offsets are applied after converting them to loc so that days keep their
+// local time across DST changes.
+func shiftBy(t time.Time, offset string, n int, loc *time.Location) (time.Time, bool) {
+	if m := calendarWindowPattern.FindStringSubmatch(offset); m != nil {
+		count, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, false
+		}
+		count *= n
+		t = t.In(loc)
+		switch m[2] {
+		case "d":
+			return t.AddDate(0, 0, count), true
+		case "w":
+			return t.AddDate(0, 0, 7*count), true
+		case "mo":
+			return addMonthsClamped(t, count), true
+		case "y":
+			return addMonthsClamped(t, 12*count), true
+		}
+	}
+	d, err := time.ParseDuration(offset)
+	if err != nil || d <= 0 {
+		return time.Time{}, false
+	}
+	return t.Add(time.Duration(n) * d), true
+}
+
+// addMonthsClamped adds months to t, clamping the day to the end of the target month (March 31 minus one month is
+// February 28 or 29, not March 2 or 3).
+func addMonthsClamped(t time.Time, months int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month(), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	target := firstOfMonth.AddDate(0, months, 0)
+	lastDay := target.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return target.AddDate(0, 0, day-1)
+}
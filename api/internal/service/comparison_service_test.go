@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShiftBy(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("timezone database unavailable: %v", err)
+	}
+	// Times as parsed from RFC3339 query parameters, with a fixed offset
+	parse := func(raw string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	tests := []struct {
+		name   string
+		t      time.Time
+		offset string
+		n      int
+		loc    *time.Location
+		want   time.Time
+	}{
+		{"day back across spring DST", parse("2024-04-01T00:00:00+02:00"), "1d", -1, paris, time.Date(2024, time.March, 31, 0, 0, 0, 0, paris)},
+		{"week back across spring DST", parse("2024-04-03T00:00:00+02:00"), "1w", -1, paris, time.Date(2024, time.March, 27, 0, 0, 0, 0, paris)},
+		{"day forward across autumn DST", parse("2024-10-26T12:00:00+02:00"), "1d", 1, paris, time.Date(2024, time.October, 27, 12, 0, 0, 0, paris)},
+		{"year back from summer to summer", parse("2024-07-01T00:00:00Z"), "1y", -1, paris, parse("2023-07-01T00:00:00Z")},
+		{"month back clamped", parse("2024-03-31T10:00:00+02:00"), "1mo", -1, paris, time.Date(2024, time.February, 29, 10, 0, 0, 0, paris)},
+		{"months forward clamped", parse("2024-01-31T00:00:00Z"), "1mo", 3, time.UTC, parse("2024-04-30T00:00:00Z")},
+		{"duration ignores the timezone", parse("2024-04-01T00:00:00+02:00"), "24h", -1, paris, parse("2024-03-31T00:00:00+02:00")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := shiftBy(tt.t, tt.offset, tt.n, tt.loc)
+			if !ok || !got.Equal(tt.want) {
+				t.Errorf("shiftBy(%s, %q, %d) = %s, %v, want %s", tt.t, tt.offset, tt.n, got, ok, tt.want)
+			}
+		})
+	}
+
+	for _, offset := range []string{"", "0d", "-1h", "1q", "0s"} {
+		if _, ok := shiftBy(time.Now(), offset, 1, time.UTC); ok {
+			t.Errorf("shiftBy accepted offset %q", offset)
+		}
+	}
+}
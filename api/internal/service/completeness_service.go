@@ -0,0 +1,115 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// defaultMinGapIntervals is the default shortest reported gap, in expected sampling intervals.
+const defaultMinGapIntervals = 3
+
+// GetCompleteness reports, for each field of a device, the expected and received sample counts over the time range,
+// the gaps longer than the minimum gap and a completeness percentage.
+func (s *DataService) GetCompleteness(ctx context.Context, req models.CompletenessRequest) (models.CompletenessResponse, error) {
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return models.CompletenessResponse{}, err
+	}
+	if req.ExpectedInterval == "" {
+		return models.CompletenessResponse{}, models.NewAPIError(models.ErrorCodeMissingParameter, "expected_interval is required", nil, http.StatusBadRequest)
+	}
+	interval, err := parseOptionalDuration("expected_interval", req.ExpectedInterval, 0)
+	if err != nil {
+		return models.CompletenessResponse{}, err
+	}
+	minGap, err := parseOptionalDuration("min_gap", req.MinGap, defaultMinGapIntervals*interval)
+	if err != nil {
+		return models.CompletenessResponse{}, err
+	}
+	// Samples cannot be expected in the future
+	if now := time.Now(); stop.After(now) {
+		stop = now
+	}
+	if !start.Before(stop) {
+		return models.CompletenessResponse{}, models.NewAPIError(models.ErrorCodeValidationFailed, "time_range_start must be in the past", nil, http.StatusBadRequest)
+	}
+
+	stats, err := s.repo.QuerySampleStats(ctx, req, start, stop, minGap)
+	if err != nil {
+		return models.CompletenessResponse{}, fmt.Errorf("error querying sample statistics: %w", err)
+	}
+
+	fields := make(map[string]bool)
+	for field := range stats {
+		fields[field] = true
+	}
+	for _, field := range req.SensorType {
+		fields[field] = true // Requested fields without any sample are reported as missing
+	}
+
+	expected := int64(stop.Sub(start) / interval)
+	resp := models.CompletenessResponse{
+		LocationID:       req.LocationID,
+		DeviceID:         req.DeviceID,
+		Start:            start,
+		Stop:             stop,
+		ExpectedInterval: interval.String(),
+		MinGap:           minGap.String(),
+		Fields:           []models.FieldCompleteness{},
+	}
+	var totalExpected, totalReceived int64
+	for _, field := range sortedKeys(fields) {
+		samples := stats[field]
+		if samples == nil {
+			samples = &models.FieldSamples{}
+		}
+		fc := fieldCompleteness(field, samples, start, stop, expected, minGap)
+		resp.Fields = append(resp.Fields, fc)
+		totalExpected += fc.ExpectedSamples
+		totalReceived += int64(math.Min(float64(fc.ReceivedSamples), float64(fc.ExpectedSamples)))
+	}
+	resp.CompletenessPercent = completenessPercent(totalReceived, totalExpected)
+	return resp, nil
+}
+
+// fieldCompleteness builds the completeness of a field, adding the gaps before the first and after the last sample.
+func fieldCompleteness(field string, samples *models.FieldSamples, start, stop time.Time, expected int64, minGap time.Duration) models.FieldCompleteness {
+	gaps := append([]models.Gap{}, samples.Gaps...)
+	addGap := func(from, to time.Time) {
+		if to.Sub(from) > minGap {
+			gaps = append(gaps, models.Gap{Start: from, End: to, DurationSeconds: to.Sub(from).Seconds()})
+		}
+	}
+	if samples.Count == 0 {
+		addGap(start, stop)
+	} else {
+		addGap(start, samples.First)
+		addGap(samples.Last, stop)
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i].Start.Before(gaps[j].Start) })
+
+	fc := models.FieldCompleteness{
+		Field:               field,
+		ExpectedSamples:     expected,
+		ReceivedSamples:     samples.Count,
+		CompletenessPercent: completenessPercent(samples.Count, expected),
+		Gaps:                gaps,
+	}
+	for _, g := range gaps {
+		fc.MissingSeconds += g.DurationSeconds
+	}
+	return fc
+}
+
+// completenessPercent returns received over expected as a percentage, capped at 100.
+func completenessPercent(received, expected int64) float64 {
+	if expected <= 0 {
+		return 100
+	}
+	return math.Min(100, 100*float64(received)/float64(expected))
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Limits of the correlation endpoint.
+const (
+	maxCorrelationSeries = 10
+	defaultMaxLag        = 12
+	maxLagLimit          = 500
+	// minCorrelationPairs is the number of value pairs below which no coefficient is computed.
+	minCorrelationPairs = 3
+)
+
+// Correlate aligns the aggregated series of several fields on a common window and computes, for every pair, the
+// Pearson and Spearman correlations, the cross-correlation over shifts of up to MaxLag windows and optionally the
+// scatter dataset of the windows where both series have a value.
+func (s *DataService) Correlate(ctx context.Context, req models.CorrelationRequest) (models.CorrelationResponse, error) {
+	if len(req.Series) < 2 || len(req.Series) > maxCorrelationSeries {
+		return models.CorrelationResponse{}, models.NewAPIError(models.ErrorCodeValidationFailed, fmt.Sprintf("between 2 and %d series are required", maxCorrelationSeries), nil, http.StatusBadRequest)
+	}
+	maxLag := defaultMaxLag
+	if req.MaxLag != nil {
+		maxLag = *req.MaxLag
+	}
+	if maxLag < 0 || maxLag > maxLagLimit {
+		return models.CorrelationResponse{}, models.NewAPIError(models.ErrorCodeValidationFailed, fmt.Sprintf("max_lag must be between 0 and %d", maxLagLimit), nil, http.StatusBadRequest)
+	}
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return models.CorrelationResponse{}, err
+	}
+	window, err := planWindow(req.TimeRangeStart, req.TimeRangeStop, req.WindowPeriod, len(req.Series))
+	if err != nil {
+		return models.CorrelationResponse{}, err
+	}
+
+	// Every series is queried with the same window and timezone, that of the first sensor series by default, so
+	// that their windows share the same timestamps
+	var locationID string
+	for _, ref := range req.Series {
+		if ref.Source == models.SourceSensor {
+			locationID = ref.LocationID
+			break
+		}
+	}
+	timezone, loc, err := s.timezones.Resolve(req.Timezone, locationID)
+	if err != nil {
+		return models.CorrelationResponse{}, err
+	}
+
+	resp := models.CorrelationResponse{WindowPeriod: window, Series: make([]models.CorrelationSeries, 0, len(req.Series)), Pairs: []models.CorrelationPair{}}
+	byTime := make(map[int64]map[int]float64)
+	for i, ref := range req.Series {
+		points, unit, err := s.fieldSeries(ctx, seriesSelector{
+			Source:     ref.Source,
+			LocationID: ref.LocationID,
+			DeviceID:   ref.DeviceID,
+			Field:      ref.Field,
+			Window:     window,
+			Timezone:   timezone,
+		}, start, stop)
+		if err != nil {
+			return models.CorrelationResponse{}, err
+		}
+		series := models.CorrelationSeries{SeriesRef: ref, ID: ref.String(), Unit: unit}
+		for _, p := range points {
+			key := p.Time.UnixNano()
+			if byTime[key] == nil {
+				byTime[key] = make(map[int]float64)
+			}
+			if p.Value != nil {
+				byTime[key][i] = *p.Value
+				series.Values++
+			}
+		}
+		resp.Series = append(resp.Series, series)
+	}
+
+	keys := make([]int64, 0, len(byTime))
+	for key := range byTime {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool { return keys[a] < keys[b] })
+	times := make([]time.Time, len(keys))
+	for k, key := range keys {
+		times[k] = time.Unix(0, key).In(loc)
+	}
+	// aligned[i][k] is the value of series i in the k-th window, nil when empty
+	aligned := make([][]*float64, len(req.Series))
+	for i := range aligned {
+		aligned[i] = make([]*float64, len(keys))
+		for k, key := range keys {
+			if v, ok := byTime[key][i]; ok {
+				aligned[i][k] = &v
+			}
+		}
+	}
+
+	for i := 0; i < len(req.Series); i++ {
+		for j := i + 1; j < len(req.Series); j++ {
+			resp.Pairs = append(resp.Pairs, correlatePair(resp.Series[i].ID, resp.Series[j].ID, aligned[i], aligned[j], times, maxLag, req.IncludeScatter))
+		}
+	}
+	return resp, nil
+}
+
+// correlatePair computes the correlations of two aligned series.
+func correlatePair(xID, yID string, x, y []*float64, times []time.Time, maxLag int, includeScatter bool) models.CorrelationPair {
+	pair := models.CorrelationPair{X: xID, Y: yID, CrossCorrelation: []models.LagCorrelation{}}
+
+	xs, ys := lagPairs(x, y, 0)
+	pair.Pairs = len(xs)
+	pair.Pearson = pearson(xs, ys)
+	pair.Spearman = pearson(ranks(xs), ranks(ys))
+
+	for lag := -maxLag; lag <= maxLag; lag++ {
+		lx, ly := lagPairs(x, y, lag)
+		c := models.LagCorrelation{Lag: lag, Pairs: len(lx), Pearson: pearson(lx, ly)}
+		pair.CrossCorrelation = append(pair.CrossCorrelation, c)
+		if c.Pearson != nil && (pair.BestLag == nil || math.Abs(*c.Pearson) > math.Abs(*pair.BestLag.Pearson)) {
+			best := c
+			pair.BestLag = &best
+		}
+	}
+
+	if includeScatter {
+		pair.Scatter = make([]models.ScatterPoint, 0, pair.Pairs)
+		for k := range x {
+			if x[k] != nil && y[k] != nil {
+				pair.Scatter = append(pair.Scatter, models.ScatterPoint{Time: times[k], X: *x[k], Y: *y[k]})
+			}
+		}
+	}
+	return pair
+}
+
+// lagPairs returns the values of x and of y shifted by lag windows where both are set.
+func lagPairs(x, y []*float64, lag int) ([]float64, []float64) {
+	var xs, ys []float64
+	for k := range x {
+		if k+lag < 0 || k+lag >= len(y) {
+			continue
+		}
+		if x[k] != nil && y[k+lag] != nil {
+			xs = append(xs, *x[k])
+			ys = append(ys, *y[k+lag])
+		}
+	}
+	return xs, ys
+}
+
+// pearson returns the Pearson correlation coefficient of xs and ys, nil when it is not defined.
+func pearson(xs, ys []float64) *float64 {
+	n := len(xs)
+	if n < minCorrelationPairs {
+		return nil
+	}
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return nil
+	}
+	r := cov / math.Sqrt(varX*varY)
+	// Rounding can push a perfect correlation slightly out of [-1, 1]
+	r = math.Max(-1, math.Min(1, r))
+	return &r
+}
+
+// ranks returns the rank of each value, ties sharing their average rank, so that the Pearson correlation of the ranks
+// is the Spearman correlation.
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return values[order[a]] < values[order[b]] })
+
+	result := make([]float64, len(values))
+	for i := 0; i < len(order); {
+		j := i
+		for j+1 < len(order) && values[order[j+1]] == values[order[i]] {
+			j++
+		}
+		rank := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			result[order[k]] = rank
+		}
+		i = j + 1
+	}
+	return result
+}
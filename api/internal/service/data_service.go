@@ -6,17 +6,44 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
 )
 
 // DataService handles the business logic for processing sensor data.
 type DataService struct {
-	repo repository.Repository
+	repo         repository.Repository
+	units        *UnitRegistry
+	quality      *QualityMonitor
+	alerts       *AlertService
+	timezones    *TimezoneRegistry
+	carbon       *CarbonIntensityRegistry
+	degreeDays   *DegreeDayRegistry
+	calibrations calibrationStore
+	latest       latestCache
+	energy       energyCounters
+	// virtualSensors are the computed sensor types of each location
+	virtualSensors virtualSensorStore
+	// heartbeatTimeout is the default silence after which a device is considered offline.
+	heartbeatTimeout time.Duration
+	// consumptionDevices are the consumption devices of each location
+	consumptionDevices map[string][]string
 }
 
 // NewDataService creates a new DataService.
-func NewDataService(repo repository.Repository) *DataService { // Changed argument type
+func NewDataService(repo repository.Repository, units *UnitRegistry, quality *QualityMonitor, alerts *AlertService, timezones *TimezoneRegistry, carbon *CarbonIntensityRegistry, degreeDays *DegreeDayRegistry, heartbeatTimeout time.Duration, consumptionDevices map[string][]string) *DataService { // Changed argument type
 	return &DataService{
-		repo: repo,
+		repo:               repo,
+		units:              units,
+		quality:            quality,
+		alerts:             alerts,
+		timezones:          timezones,
+		carbon:             carbon,
+		degreeDays:         degreeDays,
+		heartbeatTimeout:   heartbeatTimeout,
+		consumptionDevices: consumptionDevices,
 	}
 }
 
@@ -28,6 +55,24 @@ func (s *DataService) ProcessAndSaveSensorData(ctx context.Context, data models.
 	}
 	// It's ok if some sensor values are zero, but you might want to log if all are.
 
+	// Normalize the value to the canonical unit of the field.
+	value, err := s.units.ToCanonical(data.Field, data.Unit, data.Value)
+	if err != nil {
+		return err
+	}
+	data.Value = value
+	data.Unit = ""
+
+	// Apply the sensor's calibration profile, keeping the raw value.
+	s.calibrate(&data)
+
+	// Flag stuck, spiking or impossible values.
+	seriesKey := fmt.Sprintf("%s|%s|%s|%s", data.Location, data.DeviceID, data.SensorID, data.Field)
+	data.QualityFlags = s.quality.Check(seriesKey, data.Field, data.Value, readingTime(data.Timestamp))
+	if len(data.QualityFlags) > 0 {
+		log.Printf("Quality flags %v on device %s, field %s, value %f", data.QualityFlags, data.DeviceID, data.Field, data.Value)
+	}
+
 	// Use the location from the sensor data as the bucket name.
 	bucketName := data.Location
 
@@ -51,18 +96,117 @@ func (s *DataService) ProcessAndSaveSensorData(ctx context.Context, data models.
 	}
 
 	// Now write the sensor data.
-	return s.repo.WriteSensorData(ctx, data)
+	if err := s.repo.WriteSensorData(ctx, data); err != nil {
+		return err
+	}
+	if !math.IsNaN(data.Value) && !math.IsInf(data.Value, 0) {
+		location := data.Location
+		if location == "" {
+			location = "default_location" // Bucket used by the repository
+		}
+		s.latest.update(location, data.DeviceID, data.Field, models.LatestValue{
+			Value:        data.Value,
+			Time:         readingTime(data.Timestamp),
+			QualityFlags: data.QualityFlags,
+		})
+	}
+
+	s.alerts.Evaluate(models.MetricPoint{
+		Source:     models.SourceSensor,
+		LocationID: data.Location,
+		DeviceID:   data.DeviceID,
+		Field:      data.Field,
+		Value:      data.Value,
+		Time:       readingTime(data.Timestamp),
+	})
+	return nil
 }
 
 func (s *DataService) GetData(req models.QueryRequest) ([]models.SensorQueryResponse, error) {
-
-	data, err := s.repo.Query(req)
+	virtual, stored := s.splitVirtualSensors(req.LocationID, req.SensorType)
+	units := s.units
+	if len(virtual) > 0 {
+		units = s.units.withFields(virtualSensorUnits(virtual))
+	}
+	outputUnits, err := units.OutputUnits(req.SensorType, req.Units)
 	if err != nil {
-		return nil, fmt.Errorf("error querying data: %w", err)
+		return nil, err
+	}
+	if len(req.DeviceIDs) == 0 {
+		return []models.SensorQueryResponse{}, nil
+	}
+	downsample, err := validateDownsample(req.Downsample, req.MaxPoints)
+	if err != nil {
+		return nil, err
+	}
+	fill, err := parseGapFill(req.Fill, req.FillMaxDistance)
+	if err != nil {
+		return nil, err
+	}
+	// With downsampling, the window only lightly pre-aggregates the raw fetch, which stays within the point budget.
+	// Virtual sensors count with the series of their inputs.
+	inputDevices, inputFields := virtualSensorInputs(virtual, req.DeviceIDs)
+	window, err := planWindow(req.TimeRangeStart, req.TimeRangeStop, req.WindowPeriod, len(stored)*len(req.DeviceIDs)+len(inputDevices)*len(inputFields))
+	if err != nil {
+		return nil, err
+	}
+	req.WindowPeriod = window
+	req.SkipEmpty = downsample || fill.skipEmpty()
+	timezone, loc, err := s.timezones.Resolve(req.Timezone, req.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	req.Timezone = timezone
+
+	data := []models.SensorQueryResponse{}
+	if len(stored) > 0 {
+		storedReq := req
+		storedReq.SensorType = stored
+		if data, err = s.repo.Query(storedReq); err != nil {
+			return nil, fmt.Errorf("error querying data: %w", err)
+		}
+	}
+	if len(virtual) > 0 {
+		if data, err = s.queryVirtualSensors(req, virtual, data); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range data {
+		if err := convertSensorReadings(units, data[i].Readings, outputUnits); err != nil {
+			return nil, err
+		}
+		fill.fillSensorReadings(data[i].Readings)
+		localizeSensorReadings(data[i].Readings, loc)
+		if downsample {
+			downsampleSensorReadings(data[i].Readings, req.MaxPoints)
+		}
+		data[i].Units = outputUnits
+		data[i].WindowPeriod = window
 	}
 	return data, nil
 }
 
+// ListDevices returns the devices of a location with sensor data between start and stop.
+func (s *DataService) ListDevices(ctx context.Context, locationID, rawStart, rawStop string) ([]string, error) {
+	start, stop, err := parseTimeRange(rawStart, rawStop)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListDevices(ctx, locationID, "sensor_data", start, stop)
+}
+
+// ListConsumptionDevices returns the consumption devices configured for a location. Consumption data carries no
+// location, so the devices of a location cannot be listed from the data.
+func (s *DataService) ListConsumptionDevices(locationID string) ([]string, error) {
+	devices, ok := s.consumptionDevices[locationID]
+	if !ok {
+		return nil, models.NewAPIError(models.ErrorCodeMissingParameter,
+			fmt.Sprintf("no consumption devices configured for location '%s', please set device_id", locationID), nil, http.StatusBadRequest)
+	}
+	return devices, nil
+}
+
 func (s *DataService) SaveConsumptionData(ctx context.Context, req models.ConsumptionReq) error {
 	// Validation: Check for device ID. It's good to have a device ID.
 	if req.DeviceID == "" {
@@ -70,6 +214,44 @@ func (s *DataService) SaveConsumptionData(ctx context.Context, req models.Consum
 	}
 	// It's ok if some sensor values are zero, but you might want to log if all are.
 
+	// Normalize every reading to the canonical unit of its metric.
+	for metric, unit := range req.Units {
+		var target *float64
+		switch metric {
+		case "current":
+			target = &req.Current
+		case "voltage":
+			target = &req.Voltage
+		case "power":
+			target = &req.Power
+		default:
+			return models.NewAPIError(models.ErrorCodeValidationFailed, fmt.Sprintf("unknown metric '%s' in units", metric), nil, http.StatusBadRequest)
+		}
+		value, err := s.units.ToCanonical(metric, unit, *target)
+		if err != nil {
+			return err
+		}
+		*target = value
+	}
+	req.Units = nil
+
+	// Flag stuck, spiking or impossible readings. Flags apply to the whole point.
+	at := readingTime(req.Timestamp)
+	flagSet := make(map[string]bool)
+	for metric, value := range map[string]float64{"current": req.Current, "voltage": req.Voltage, "power": req.Power} {
+		for _, flag := range s.quality.Check("consumption|"+req.DeviceID+"|"+metric, metric, value, at) {
+			flagSet[flag] = true
+		}
+	}
+	derived, consistent := deriveElectricalMetrics(req)
+	if !consistent {
+		flagSet[models.QualityFlagInconsistent] = true
+	}
+	req.QualityFlags = sortedKeys(flagSet)
+	if len(req.QualityFlags) > 0 {
+		log.Printf("Quality flags %v on consumption of device %s", req.QualityFlags, req.DeviceID)
+	}
+
 	// Use a fixed bucket name for consumption data.
 	bucketName := "consumption_data"
 
@@ -92,8 +274,36 @@ func (s *DataService) SaveConsumptionData(ctx context.Context, req models.Consum
 		log.Printf("Bucket '%s' created successfully.\n", bucketName)
 	}
 
-	// Now write the consumption data.
-	return s.repo.WriteConsumptionData(ctx, req)
+	// The energy counter is not stored rather than failing the write when its last value cannot be read.
+	energy, ok, commitEnergy, err := s.integrateEnergy(ctx, req.DeviceID, req.Power, at)
+	if err != nil {
+		log.Printf("Error loading the energy counter of device %s: %v", req.DeviceID, err)
+	} else if ok {
+		derived[models.MetricEnergy] = energy
+	}
+	req.Derived = derived
+
+	// Now write the consumption data. The counter only advances once the point holding it is stored.
+	err = s.repo.WriteConsumptionData(ctx, req)
+	commitEnergy(err == nil)
+	if err != nil {
+		return err
+	}
+
+	metrics := map[string]float64{"current": req.Current, "voltage": req.Voltage, "power": req.Power}
+	for metric, value := range derived {
+		metrics[metric] = value
+	}
+	for metric, value := range metrics {
+		s.alerts.Evaluate(models.MetricPoint{
+			Source:   models.SourceConsumption,
+			DeviceID: req.DeviceID,
+			Field:    metric,
+			Value:    value,
+			Time:     at,
+		})
+	}
+	return nil
 }
 
 func (s *DataService) GetConsumptionData(ctx context.Context, req models.ConsumptionQueryRequest) ([]models.ConsumptionQueryResponse, error) {
@@ -103,8 +313,32 @@ func (s *DataService) GetConsumptionData(ctx context.Context, req models.Consump
 
 	// Default to all metrics if empty
 	if len(req.Metrics) == 0 {
-		req.Metrics = []string{"current", "voltage", "power"}
+		req.Metrics = []string{"current", "voltage", "power", models.MetricApparentPower, models.MetricPowerFactor, models.MetricEnergy}
+	}
+
+	outputUnits, err := s.units.OutputUnits(req.Metrics, req.Units)
+	if err != nil {
+		return nil, err
+	}
+	downsample, err := validateDownsample(req.Downsample, req.MaxPoints)
+	if err != nil {
+		return nil, err
+	}
+	fill, err := parseGapFill(req.Fill, req.FillMaxDistance)
+	if err != nil {
+		return nil, err
+	}
+	window, err := planWindow(req.TimeRangeStart, req.TimeRangeStop, req.WindowPeriod, len(req.Metrics))
+	if err != nil {
+		return nil, err
 	}
+	req.WindowPeriod = window
+	req.SkipEmpty = downsample || fill.skipEmpty()
+	timezone, loc, err := s.timezones.Resolve(req.Timezone, req.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	req.Timezone = timezone
 
 	// Build the query for your repository layer
 	data, err := s.repo.QueryConsumptionData(ctx, req)
@@ -112,5 +346,126 @@ func (s *DataService) GetConsumptionData(ctx context.Context, req models.Consump
 		return nil, fmt.Errorf("error querying consumption data: %w", err)
 	}
 
+	for i := range data {
+		if err := s.convertDataPoints(data[i].Readings, outputUnits); err != nil {
+			return nil, err
+		}
+		fill.fillDataPoints(data[i].Readings)
+		localizeDataPoints(data[i].Readings, loc)
+		if downsample {
+			downsampleDataPoints(data[i].Readings, req.MaxPoints)
+		}
+		data[i].Units = outputUnits
+		data[i].WindowPeriod = window
+	}
 	return data, nil
 }
+
+// GetQualitySummary counts the flagged points of a device per field, over its sensor data in the location bucket
+// and its consumption data.
+func (s *DataService) GetQualitySummary(ctx context.Context, req models.QualityRequest) (models.QualitySummary, error) {
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return models.QualitySummary{}, err
+	}
+
+	fields, err := s.repo.QueryQualitySummary(ctx, req.LocationID, "sensor_data", req.DeviceID, start, stop)
+	if err != nil {
+		return models.QualitySummary{}, fmt.Errorf("error querying sensor data quality: %w", err)
+	}
+	consumption, err := s.repo.QueryQualitySummary(ctx, "consumption_data", "consumption_data", req.DeviceID, start, stop)
+	if err != nil {
+		return models.QualitySummary{}, fmt.Errorf("error querying consumption data quality: %w", err)
+	}
+	for metric, fq := range consumption {
+		fields[metric] = fq
+	}
+
+	for field, fq := range fields {
+		if fq.TotalPoints > 0 {
+			fq.FlaggedRatio = float64(fq.FlaggedPoints) / float64(fq.TotalPoints)
+		}
+		fields[field] = fq
+	}
+	return models.QualitySummary{DeviceID: req.DeviceID, LocationID: req.LocationID, Fields: fields}, nil
+}
+
+// readingTime parses the RFC3339 timestamp of a reading, falling back to the current time like the repository does.
+func readingTime(timestamp string) time.Time {
+	if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// ensureLocationBucket creates the bucket of a location if it does not exist yet.
+func (s *DataService) ensureLocationBucket(ctx context.Context, locationID string) error {
+	bucketExists, err := s.repo.BucketExists(ctx, locationID)
+	if err != nil {
+		return fmt.Errorf("error checking bucket '%s': %w", locationID, err)
+	}
+	if !bucketExists {
+		if err := s.repo.CreateBucket(ctx, locationID); err != nil {
+			return fmt.Errorf("error creating bucket '%s': %w", locationID, err)
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a set in lexical order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FieldUnits returns the canonical unit definition of every known field.
+func (s *DataService) FieldUnits() []models.FieldUnit {
+	return s.units.Fields()
+}
+
+// convertSensorReadings converts the canonical values of sensor readings to the requested output units in place.
+func convertSensorReadings(units *UnitRegistry, readings map[string][]map[string]interface{}, outputUnits map[string]string) error {
+	for field, points := range readings {
+		unit := outputUnits[field]
+		if unit == "" || unit == units.CanonicalUnit(field) {
+			continue
+		}
+		for _, point := range points {
+			value, ok := point["value"].(float64)
+			if !ok {
+				continue // null window
+			}
+			converted, err := units.FromCanonical(field, unit, value)
+			if err != nil {
+				return err
+			}
+			point["value"] = converted
+		}
+	}
+	return nil
+}
+
+// convertDataPoints converts the canonical values of consumption data points to the requested output units in place.
+func (s *DataService) convertDataPoints(readings map[string][]models.DataPoint, outputUnits map[string]string) error {
+	for metric, points := range readings {
+		unit := outputUnits[metric]
+		if unit == "" || unit == s.units.CanonicalUnit(metric) {
+			continue
+		}
+		for i := range points {
+			if points[i].Value == nil {
+				continue
+			}
+			converted, err := s.units.FromCanonical(metric, unit, *points[i].Value)
+			if err != nil {
+				return err
+			}
+			points[i].Value = &converted
+		}
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Defaults of the degree-day computation.
+const (
+	defaultOutdoorField = "temperature"
+	// degreeDayUnit is the unit of the outdoor temperatures and of the base temperatures.
+	degreeDayUnit = "C"
+)
+
+// DegreeDayRegistry knows the outdoor temperature sensor of each location and the default base temperatures.
+type DegreeDayRegistry struct {
+	sensors     map[string]outdoorSensor
+	heatingBase float64
+	coolingBase float64
+}
+
+// outdoorSensor is the field of a device measuring the outdoor temperature of a location.
+type outdoorSensor struct {
+	deviceID string
+	field    string
+}
+
+// NewDegreeDayRegistry creates a DegreeDayRegistry from the outdoor sensor of each location, "device" or
+// "device:field" (the "temperature" field by default), and the default heating and cooling base temperatures in °C.
+func NewDegreeDayRegistry(sensors map[string]string, heatingBase, coolingBase float64) *DegreeDayRegistry {
+	reg := &DegreeDayRegistry{sensors: make(map[string]outdoorSensor, len(sensors)), heatingBase: heatingBase, coolingBase: coolingBase}
+	for locationID, raw := range sensors {
+		deviceID, field, _ := strings.Cut(raw, ":")
+		if field == "" {
+			field = defaultOutdoorField
+		}
+		reg.sensors[locationID] = outdoorSensor{deviceID: deviceID, field: field}
+	}
+	return reg
+}
+
+// GetDegreeDays computes the heating and cooling degree-days of each local day from the daily mean of the outdoor
+// temperature of a location: HDD = max(0, heating base - mean), CDD = max(0, mean - cooling base).
+func (s *DataService) GetDegreeDays(ctx context.Context, req models.DegreeDaysRequest) (models.DegreeDaysResponse, error) {
+	if req.LocationID == "" {
+		return models.DegreeDaysResponse{}, models.NewAPIError(models.ErrorCodeMissingParameter, "location_id is required", nil, http.StatusBadRequest)
+	}
+	invalid := func(message string) error {
+		return models.NewAPIError(models.ErrorCodeValidationFailed, message, nil, http.StatusBadRequest)
+	}
+	sensor := s.degreeDays.sensors[req.LocationID]
+	if req.OutdoorDeviceID != "" {
+		sensor = outdoorSensor{deviceID: req.OutdoorDeviceID, field: req.OutdoorField}
+	}
+	if sensor.deviceID == "" {
+		return models.DegreeDaysResponse{}, invalid(fmt.Sprintf("no outdoor temperature sensor is configured for location '%s', please set outdoor_device_id", req.LocationID))
+	}
+	if sensor.field == "" {
+		sensor.field = defaultOutdoorField
+	}
+	heatingBase, coolingBase := s.degreeDays.heatingBase, s.degreeDays.coolingBase
+	if req.HeatingBase != nil {
+		heatingBase = *req.HeatingBase
+	}
+	if req.CoolingBase != nil {
+		coolingBase = *req.CoolingBase
+	}
+	if heatingBase > coolingBase {
+		return models.DegreeDaysResponse{}, invalid("heating_base must not be greater than cooling_base")
+	}
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return models.DegreeDaysResponse{}, err
+	}
+	if _, err := planWindow(req.TimeRangeStart, req.TimeRangeStop, "1d", 1); err != nil {
+		return models.DegreeDaysResponse{}, err
+	}
+	timezone, loc, err := s.timezones.Resolve(req.Timezone, req.LocationID)
+	if err != nil {
+		return models.DegreeDaysResponse{}, err
+	}
+
+	points, _, err := s.fieldSeries(ctx, seriesSelector{
+		Source:     models.SourceSensor,
+		LocationID: req.LocationID,
+		DeviceID:   sensor.deviceID,
+		Field:      sensor.field,
+		Window:     "1d",
+		Timezone:   timezone,
+		Unit:       degreeDayUnit,
+		Fill:       fillNone,
+	}, start, stop)
+	if err != nil {
+		return models.DegreeDaysResponse{}, err
+	}
+
+	resp := models.DegreeDaysResponse{
+		LocationID:      req.LocationID,
+		OutdoorDeviceID: sensor.deviceID,
+		OutdoorField:    sensor.field,
+		Timezone:        timezone,
+		HeatingBase:     heatingBase,
+		CoolingBase:     coolingBase,
+		Days:            make([]models.DegreeDay, 0, len(points)),
+	}
+	for _, p := range points {
+		if p.Value == nil {
+			continue
+		}
+		day := models.DegreeDay{
+			Day:             dayStart(p.Time, loc),
+			MeanTemperature: *p.Value,
+			HDD:             math.Max(0, heatingBase-*p.Value),
+			CDD:             math.Max(0, *p.Value-coolingBase),
+		}
+		resp.HDD += day.HDD
+		resp.CDD += day.CDD
+		resp.Days = append(resp.Days, day)
+	}
+	return resp, nil
+}
+
+// GetWeatherNormalization relates the daily energy of consumption devices, from the increase of their energy
+// counters, to the degree-days of the location: it fits the baseline energy = a + b·HDD + c·CDD over the range and
+// reports per period the energy per degree-day and the deviation from the energy the baseline expects.
+func (s *DataService) GetWeatherNormalization(ctx context.Context, req models.WeatherNormalizationRequest) (models.WeatherNormalizationResponse, error) {
+	degreeDays, err := s.GetDegreeDays(ctx, req.DegreeDaysRequest)
+	if err != nil {
+		return models.WeatherNormalizationResponse{}, err
+	}
+	if _, err := planWindow(req.TimeRangeStart, req.TimeRangeStop, "1d", len(req.DeviceIDs)+1); err != nil {
+		return models.WeatherNormalizationResponse{}, err
+	}
+	start, stop, _ := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	_, loc, _ := s.timezones.Resolve(degreeDays.Timezone, req.LocationID)
+	periods, err := billingPeriods(start, stop, req.Period, loc)
+	if err != nil {
+		return models.WeatherNormalizationResponse{}, err
+	}
+
+	// Energy of each local day, summed over the devices
+	energy := make(map[int64]float64)
+	for _, deviceID := range req.DeviceIDs {
+		baseline, counters, err := s.repo.QueryEnergyWindows(ctx, deviceID, "1d", degreeDays.Timezone, start, stop)
+		if err != nil {
+			return models.WeatherNormalizationResponse{}, fmt.Errorf("error querying energy of device %s: %w", deviceID, err)
+		}
+		for _, delta := range energyDeltas(baseline, counters) {
+			value, err := s.units.FromCanonical(models.MetricEnergy, reportEnergyUnit, *delta.Value)
+			if err != nil {
+				return models.WeatherNormalizationResponse{}, err
+			}
+			energy[dayStart(delta.Time, loc).UnixNano()] += value
+		}
+	}
+
+	resp := models.WeatherNormalizationResponse{
+		LocationID:      req.LocationID,
+		DeviceIDs:       req.DeviceIDs,
+		OutdoorDeviceID: degreeDays.OutdoorDeviceID,
+		OutdoorField:    degreeDays.OutdoorField,
+		Timezone:        degreeDays.Timezone,
+		EnergyUnit:      reportEnergyUnit,
+		HeatingBase:     degreeDays.HeatingBase,
+		CoolingBase:     degreeDays.CoolingBase,
+		Periods:         make([]models.NormalizedPeriod, 0, len(periods)),
+		Days:            []models.NormalizedDay{},
+	}
+	if resp.DeviceIDs == nil {
+		resp.DeviceIDs = []string{}
+	}
+	// Only the days with both energy and temperature data are analysed
+	for _, day := range degreeDays.Days {
+		if value, ok := energy[day.Day.UnixNano()]; ok {
+			resp.Days = append(resp.Days, models.NormalizedDay{Day: day.Day, Energy: value, HDD: day.HDD, CDD: day.CDD})
+		}
+	}
+	resp.Baseline = fitDegreeDayBaseline(resp.Days)
+	if resp.Baseline != nil {
+		for i := range resp.Days {
+			expected := (*degreeDayBaseline)(resp.Baseline).expect(resp.Days[i].HDD, resp.Days[i].CDD)
+			resp.Days[i].ExpectedEnergy = &expected
+		}
+	}
+
+	for _, period := range periods {
+		p := models.NormalizedPeriod{Start: period.Start, Stop: period.Stop}
+		var expected float64
+		for _, day := range resp.Days {
+			// The first day may start before the range
+			at := day.Day
+			if at.Before(start) {
+				at = start
+			}
+			if at.Before(period.Start) || !at.Before(period.Stop) {
+				continue
+			}
+			p.Days++
+			p.Energy += day.Energy
+			p.HDD += day.HDD
+			p.CDD += day.CDD
+			if day.ExpectedEnergy != nil {
+				expected += *day.ExpectedEnergy
+			}
+		}
+		if degrees := p.HDD + p.CDD; degrees > 0 {
+			perDegreeDay := p.Energy / degrees
+			p.EnergyPerDegreeDay = &perDegreeDay
+		}
+		if resp.Baseline != nil && p.Days > 0 {
+			deviation := p.Energy - expected
+			p.ExpectedEnergy, p.Deviation = &expected, &deviation
+			if expected != 0 {
+				percent := deviation / math.Abs(expected) * 100
+				p.DeviationPercent = &percent
+			}
+		}
+		resp.Periods = append(resp.Periods, p)
+	}
+	return resp, nil
+}
+
+// dayStart returns the local midnight starting the day of a daily window labelled by its end.
+func dayStart(windowEnd time.Time, loc *time.Location) time.Time {
+	local := windowEnd.Add(-time.Nanosecond).In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
+
+// degreeDayBaseline wraps the fitted baseline to predict the energy of a day.
+type degreeDayBaseline models.DegreeDayBaseline
+
+func (b *degreeDayBaseline) expect(hdd, cdd float64) float64 {
+	expected := b.Intercept
+	if b.HeatingSlope != nil {
+		expected += *b.HeatingSlope * hdd
+	}
+	if b.CoolingSlope != nil {
+		expected += *b.CoolingSlope * cdd
+	}
+	return expected
+}
+
+// fitDegreeDayBaseline fits energy = a + b·HDD + c·CDD by ordinary least squares over the days, leaving out the
+// degree-days that are zero on every day. It returns nil when there are no more days than coefficients or the
+// degree-days do not vary.
+func fitDegreeDayBaseline(days []models.NormalizedDay) *models.DegreeDayBaseline {
+	var heating, cooling bool
+	for _, day := range days {
+		heating = heating || day.HDD > 0
+		cooling = cooling || day.CDD > 0
+	}
+	row := func(day models.NormalizedDay) []float64 {
+		x := []float64{1}
+		if heating {
+			x = append(x, day.HDD)
+		}
+		if cooling {
+			x = append(x, day.CDD)
+		}
+		return x
+	}
+	k := len(row(models.NormalizedDay{}))
+	if len(days) <= k {
+		return nil
+	}
+
+	// Normal equations (XᵀX) β = Xᵀy
+	xtx := make([][]float64, k)
+	for i := range xtx {
+		xtx[i] = make([]float64, k+1) // Augmented with Xᵀy
+	}
+	var mean float64
+	for _, day := range days {
+		x := row(day)
+		for i := 0; i < k; i++ {
+			for j := 0; j < k; j++ {
+				xtx[i][j] += x[i] * x[j]
+			}
+			xtx[i][k] += x[i] * day.Energy
+		}
+		mean += day.Energy
+	}
+	mean /= float64(len(days))
+	beta, ok := solveLinearSystem(xtx)
+	if !ok {
+		return nil
+	}
+
+	baseline := &models.DegreeDayBaseline{Intercept: beta[0], Days: len(days)}
+	next := 1
+	if heating {
+		baseline.HeatingSlope = &beta[next]
+		next++
+	}
+	if cooling {
+		baseline.CoolingSlope = &beta[next]
+	}
+
+	var residual, total float64
+	for _, day := range days {
+		e := day.Energy - (*degreeDayBaseline)(baseline).expect(day.HDD, day.CDD)
+		residual += e * e
+		total += (day.Energy - mean) * (day.Energy - mean)
+	}
+	if total > 0 {
+		r2 := 1 - residual/total
+		baseline.RSquared = &r2
+	}
+	return baseline
+}
+
+// solveLinearSystem solves the augmented system m (k rows of k coefficients and the right-hand side) by Gaussian
+// elimination with partial pivoting. ok is false when the system is singular. A pivot is taken as zero relative to
+// the largest coefficient of its column, the rounding left by the elimination of collinear columns growing with it.
+func solveLinearSystem(m [][]float64) ([]float64, bool) {
+	k := len(m)
+	scale := make([]float64, k)
+	for _, row := range m {
+		for col := 0; col < k; col++ {
+			scale[col] = math.Max(scale[col], math.Abs(row[col]))
+		}
+	}
+	for col := 0; col < k; col++ {
+		pivot := col
+		for row := col + 1; row < k; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) <= 1e-9*scale[col] {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for row := col + 1; row < k; row++ {
+			factor := m[row][col] / m[col][col]
+			for j := col; j <= k; j++ {
+				m[row][j] -= factor * m[col][j]
+			}
+		}
+	}
+	x := make([]float64, k)
+	for row := k - 1; row >= 0; row-- {
+		sum := m[row][k]
+		for j := row + 1; j < k; j++ {
+			sum -= m[row][j] * x[j]
+		}
+		x[row] = sum / m[row][row]
+	}
+	return x, true
+}
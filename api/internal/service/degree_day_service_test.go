@@ -0,0 +1,96 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSolveLinearSystem(t *testing.T) {
+	tests := []struct {
+		name   string
+		m      [][]float64
+		want   []float64
+		wantOK bool
+	}{
+		{"single equation", [][]float64{{4, 2}}, []float64{0.5}, true},
+		{"needs pivoting", [][]float64{{0, 1, 3}, {2, 0, 4}}, []float64{2, 3}, true},
+		{"three unknowns", [][]float64{{2, 1, -1, 8}, {-3, -1, 2, -11}, {-2, 1, 2, -3}}, []float64{2, 3, -1}, true},
+		{"large coefficients", [][]float64{{365, 3650, 36500}, {3650, 36600, 366000}}, []float64{0, 10}, true},
+		{"zero matrix", [][]float64{{0, 0, 1}, {0, 0, 2}}, nil, false},
+		{"identical rows", [][]float64{{1, 2, 3}, {1, 2, 3}}, nil, false},
+		{"proportional columns", [][]float64{{0.1, 0.3, 1}, {0.7, 2.1, 2}}, nil, false},
+		{"dependent third row", [][]float64{{1, 2, 3, 1}, {4, 5, 6, 2}, {0.1*1 + 0.7*4, 0.1*2 + 0.7*5, 0.1*3 + 0.7*6, 3}}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := solveLinearSystem(tt.m)
+			if ok != tt.wantOK {
+				t.Fatalf("solveLinearSystem ok = %v (solution %v), want %v", ok, got, tt.wantOK)
+			}
+			for i := range tt.want {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Errorf("solution = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestFitDegreeDayBaseline(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	tests := []struct {
+		name        string
+		days        func(i int) models.NormalizedDay
+		wantNil     bool
+		wantHeating *float64
+		wantCooling *float64
+	}{
+		{"heating only", func(i int) models.NormalizedDay {
+			hdd := float64(i % 15)
+			return models.NormalizedDay{HDD: hdd, Energy: 50 + 4*hdd}
+		}, false, floatPtr(4), nil},
+		{"heating and cooling", func(i int) models.NormalizedDay {
+			hdd, cdd := math.Max(0, 10-float64(i%20)), math.Max(0, float64(i%20)-12)
+			return models.NormalizedDay{HDD: hdd, CDD: cdd, Energy: 80 + 3*hdd + 6*cdd}
+		}, false, floatPtr(3), floatPtr(6)},
+		{"no degree-days", func(i int) models.NormalizedDay {
+			return models.NormalizedDay{Energy: 100 + float64(i%3)}
+		}, false, nil, nil},
+		// Constant degree-days are collinear with the intercept, whatever the rounding of their sums
+		{"constant degree-days", func(i int) models.NormalizedDay {
+			return models.NormalizedDay{HDD: 12.093205759592392, Energy: 1000 + 500*r.Float64()}
+		}, true, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var days []models.NormalizedDay
+			for i := 0; i < 365; i++ {
+				days = append(days, tt.days(i))
+			}
+			baseline := fitDegreeDayBaseline(days)
+			if (baseline == nil) != tt.wantNil {
+				t.Fatalf("baseline = %+v, want nil %v", baseline, tt.wantNil)
+			}
+			if baseline == nil {
+				return
+			}
+			for name, slopes := range map[string][2]*float64{"heating": {baseline.HeatingSlope, tt.wantHeating}, "cooling": {baseline.CoolingSlope, tt.wantCooling}} {
+				got, want := slopes[0], slopes[1]
+				if (got == nil) != (want == nil) || (got != nil && math.Abs(*got-*want) > 1e-6) {
+					t.Errorf("%s slope = %s, want %s", name, formatOptional(got), formatOptional(want))
+				}
+			}
+		})
+	}
+
+	if baseline := fitDegreeDayBaseline([]models.NormalizedDay{{HDD: 1, Energy: 2}, {HDD: 2, Energy: 3}}); baseline != nil {
+		t.Errorf("baseline fitted on as many days as coefficients: %+v", baseline)
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
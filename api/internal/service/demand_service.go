@@ -0,0 +1,299 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/repository"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Defaults and limits of the demand analysis.
+const (
+	defaultDemandInterval = "15m"
+	maxDemandInterval     = time.Hour
+	defaultTopN           = 5
+	maxTopN               = 100
+	maxBillingPeriods     = 1000
+	// maxDemandIntervals bounds the demand intervals read per device, queried in chunks within the point budget.
+	maxDemandIntervals = 10 * repository.MAX_API_QUERY_POINTS
+	// baseLoadPercentile is the percentile of the demand reported as base load.
+	baseLoadPercentile = 5
+)
+
+// GetDemand analyses the power drawn by consumption devices: per billing period the top-N demand intervals, peak and
+// average demand, base load and load factor, and over the whole range the average daily or weekly load profile.
+// With Aggregate, the demand of the devices is summed and analysed as the load of the location.
+func (s *DataService) GetDemand(ctx context.Context, req models.DemandRequest) (models.DemandResponse, error) {
+	if req.LocationID == "" {
+		return models.DemandResponse{}, models.NewAPIError(models.ErrorCodeMissingParameter, "location_id is required", nil, http.StatusBadRequest)
+	}
+	invalid := func(message string) error {
+		return models.NewAPIError(models.ErrorCodeValidationFailed, message, nil, http.StatusBadRequest)
+	}
+	if req.DemandInterval == "" {
+		req.DemandInterval = defaultDemandInterval
+	}
+	interval, err := time.ParseDuration(req.DemandInterval)
+	if err != nil || interval < time.Minute || interval > maxDemandInterval || (24*time.Hour)%interval != 0 {
+		return models.DemandResponse{}, models.NewAPIError(models.ErrorCodeInvalidFormat, "demand_interval must be a duration between 1m and 1h dividing a day, e.g. '15m'", nil, http.StatusBadRequest)
+	}
+	if req.TopN == 0 {
+		req.TopN = defaultTopN
+	}
+	if req.TopN < 1 || req.TopN > maxTopN {
+		return models.DemandResponse{}, invalid(fmt.Sprintf("top_n must be between 1 and %d", maxTopN))
+	}
+	switch req.Profile {
+	case "":
+		req.Profile = models.LoadProfileDaily
+	case models.LoadProfileDaily, models.LoadProfileWeekly:
+	default:
+		return models.DemandResponse{}, invalid("profile must be 'daily' or 'weekly'")
+	}
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return models.DemandResponse{}, err
+	}
+	if intervals := float64(stop.Sub(start)) / float64(interval); intervals > maxDemandIntervals {
+		return models.DemandResponse{}, invalid(fmt.Sprintf("query too broad: %.0f demand intervals exceed the limit of %d per device. Please reduce the time range or use a longer demand_interval", intervals, maxDemandIntervals))
+	}
+	outputUnits, err := s.units.OutputUnits([]string{"power"}, []string{req.Unit})
+	if err != nil {
+		return models.DemandResponse{}, err
+	}
+	timezone, loc, err := s.timezones.Resolve(req.Timezone, req.LocationID)
+	if err != nil {
+		return models.DemandResponse{}, err
+	}
+	periods, err := billingPeriods(start, stop, req.BillingPeriod, loc)
+	if err != nil {
+		return models.DemandResponse{}, err
+	}
+
+	resp := models.DemandResponse{
+		LocationID:     req.LocationID,
+		DeviceIDs:      req.DeviceIDs,
+		Aggregated:     req.Aggregate,
+		Unit:           outputUnits["power"],
+		DemandInterval: req.DemandInterval,
+		Profile:        req.Profile,
+		Timezone:       timezone,
+		Results:        []models.DeviceDemand{},
+	}
+	if resp.DeviceIDs == nil {
+		resp.DeviceIDs = []string{}
+	}
+
+	total := make(map[int64]float64)
+	for _, deviceID := range req.DeviceIDs {
+		points, err := s.demandSeries(ctx, deviceID, req.DemandInterval, timezone, req.Unit, start, stop, loc)
+		if err != nil {
+			return models.DemandResponse{}, err
+		}
+		if !req.Aggregate {
+			result := analyseDemand(points, periods, start, interval, req.TopN, req.Profile, loc)
+			result.DeviceID = deviceID
+			resp.Results = append(resp.Results, result)
+			continue
+		}
+		for _, p := range points {
+			total[p.Time.UnixNano()] += *p.Value
+		}
+	}
+
+	if req.Aggregate {
+		// A window where a device has no data counts as no demand from that device
+		points := make([]models.DataPoint, 0, len(total))
+		for key, demand := range total {
+			demand := demand
+			points = append(points, models.DataPoint{Time: time.Unix(0, key).In(loc), Value: &demand})
+		}
+		sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+		resp.Results = append(resp.Results, analyseDemand(points, periods, start, interval, req.TopN, req.Profile, loc))
+	}
+	return resp, nil
+}
+
+// demandSeries returns the non-empty demand intervals of a device. The range is queried in chunks of whole days that
+// fit the point budget, so that chunk boundaries fall on window boundaries.
+func (s *DataService) demandSeries(ctx context.Context, deviceID, window, timezone, unit string, start, stop time.Time, loc *time.Location) ([]models.DataPoint, error) {
+	interval, _ := time.ParseDuration(window)
+	chunkDays := int(time.Duration(repository.MAX_API_QUERY_POINTS)*interval/(24*time.Hour)) - 1 // Leaves room for 25-hour days
+	if chunkDays < 1 {
+		chunkDays = 1
+	}
+
+	var points []models.DataPoint
+	for from := start; from.Before(stop); {
+		local := from.In(loc)
+		to := time.Date(local.Year(), local.Month(), local.Day()+chunkDays, 0, 0, 0, 0, loc)
+		if to.After(stop) {
+			to = stop
+		}
+		chunk, _, err := s.fieldSeries(ctx, seriesSelector{
+			Source:   models.SourceConsumption,
+			DeviceID: deviceID,
+			Field:    "power",
+			Window:   window,
+			Timezone: timezone,
+			Unit:     unit,
+			Fill:     fillNone,
+		}, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range chunk {
+			if p.Value != nil {
+				points = append(points, p)
+			}
+		}
+		from = to
+	}
+	return points, nil
+}
+
+// billingPeriods splits [start, stop) into billing periods aligned on the calendar of loc (midnight, Monday, first of
+// the month or of the year) or, for durations, on the Unix epoch. The first and last periods are clipped to the range.
+// An empty period returns the whole range.
+func billingPeriods(start, stop time.Time, period string, loc *time.Location) ([]models.DemandPeriod, error) {
+	if period == "" {
+		return []models.DemandPeriod{{Start: start.In(loc), Stop: stop.In(loc)}}, nil
+	}
+	invalid := models.NewAPIError(models.ErrorCodeInvalidFormat, "billing_period must be a positive duration (e.g. '24h') or a calendar period ('1d', '1w', '1mo', '1y')", nil, http.StatusBadRequest)
+
+	var first time.Time
+	if m := calendarWindowPattern.FindStringSubmatch(period); m != nil {
+		local := start.In(loc)
+		midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		switch m[2] {
+		case "d":
+			first = midnight
+		case "w":
+			first = midnight.AddDate(0, 0, -((int(local.Weekday()) + 6) % 7))
+		case "mo":
+			first = time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+		case "y":
+			first = time.Date(local.Year(), time.January, 1, 0, 0, 0, 0, loc)
+		}
+	} else {
+		d, err := time.ParseDuration(period)
+		if err != nil || d <= 0 {
+			return nil, invalid
+		}
+		first = start.Truncate(d).In(loc)
+	}
+
+	var periods []models.DemandPeriod
+	for k := 0; ; k++ {
+		from, ok := shiftBy(first, period, k, loc)
+		if !ok {
+			return nil, invalid
+		}
+		if !from.Before(stop) {
+			break
+		}
+		to, _ := shiftBy(first, period, k+1, loc)
+		if len(periods) == maxBillingPeriods {
+			return nil, models.NewAPIError(models.ErrorCodeValidationFailed, fmt.Sprintf("the range spans more than %d billing periods", maxBillingPeriods), nil, http.StatusBadRequest)
+		}
+		if from.Before(start) {
+			from = start.In(loc)
+		}
+		if to.After(stop) {
+			to = stop.In(loc)
+		}
+		periods = append(periods, models.DemandPeriod{Start: from, Stop: to})
+	}
+	return periods, nil
+}
+
+// analyseDemand summarizes demand intervals, labelled by their end as returned by aggregateWindow, per billing
+// period and in a load profile.
+func analyseDemand(points []models.DataPoint, periods []models.DemandPeriod, rangeStart time.Time, interval time.Duration, topN int, profile string, loc *time.Location) models.DeviceDemand {
+	peaks := make([]models.DemandPeak, len(points))
+	for i, p := range points {
+		intervalStart := p.Time.Add(-interval)
+		if intervalStart.Before(rangeStart) {
+			intervalStart = rangeStart.In(loc)
+		}
+		peaks[i] = models.DemandPeak{Start: intervalStart, End: p.Time, Demand: *p.Value}
+	}
+
+	result := models.DeviceDemand{Periods: make([]models.DemandPeriod, 0, len(periods)), Profile: loadProfile(peaks, profile, loc)}
+	for _, period := range periods {
+		var demands []float64
+		var inPeriod []models.DemandPeak
+		for _, peak := range peaks {
+			if !peak.Start.Before(period.Start) && peak.Start.Before(period.Stop) {
+				demands = append(demands, peak.Demand)
+				inPeriod = append(inPeriod, peak)
+			}
+		}
+		period.Intervals = len(demands)
+		period.Peaks = []models.DemandPeak{}
+		if len(demands) > 0 {
+			sort.Float64s(demands)
+			var sum float64
+			for _, d := range demands {
+				sum += d
+			}
+			peak, average, base := demands[len(demands)-1], sum/float64(len(demands)), percentile(demands, baseLoadPercentile)
+			period.PeakDemand, period.AverageDemand, period.BaseLoad = &peak, &average, &base
+			if peak > 0 {
+				loadFactor := average / peak
+				period.LoadFactor = &loadFactor
+			}
+
+			sort.SliceStable(inPeriod, func(i, j int) bool { return inPeriod[i].Demand > inPeriod[j].Demand })
+			if len(inPeriod) > topN {
+				inPeriod = inPeriod[:topN]
+			}
+			period.Peaks = inPeriod
+		}
+		result.Periods = append(result.Periods, period)
+	}
+	return result
+}
+
+// loadProfile averages the demand intervals per time of day, and per weekday for weekly profiles, in loc. Weeks start
+// on Monday.
+func loadProfile(intervals []models.DemandPeak, profile string, loc *time.Location) []models.LoadProfileSlot {
+	slots := make(map[int]*models.LoadProfileSlot)
+	for _, interval := range intervals {
+		local := interval.Start.In(loc)
+		minutes := local.Hour()*60 + local.Minute()
+		key := minutes
+		if profile == models.LoadProfileWeekly {
+			key += ((int(local.Weekday()) + 6) % 7) * 24 * 60
+		}
+		slot, ok := slots[key]
+		if !ok {
+			slot = &models.LoadProfileSlot{TimeOfDay: fmt.Sprintf("%02d:%02d", minutes/60, minutes%60), Min: math.Inf(1), Max: math.Inf(-1)}
+			if profile == models.LoadProfileWeekly {
+				slot.Weekday = local.Weekday().String()
+			}
+			slots[key] = slot
+		}
+		slot.Mean += interval.Demand // Sum until all intervals are counted
+		slot.Min = math.Min(slot.Min, interval.Demand)
+		slot.Max = math.Max(slot.Max, interval.Demand)
+		slot.Samples++
+	}
+
+	keys := make([]int, 0, len(slots))
+	for key := range slots {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	result := make([]models.LoadProfileSlot, 0, len(keys))
+	for _, key := range keys {
+		slot := slots[key]
+		slot.Mean /= float64(slot.Samples)
+		result = append(result, *slot)
+	}
+	return result
+}
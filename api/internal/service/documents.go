@@ -0,0 +1,38 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// loadDocuments decodes every stored document of a kind into target, skipping invalid ones.
+func loadDocuments[T any](ctx context.Context, repo repository.Repository, kind string, target map[string]T) error {
+	documents, err := repo.LoadDocuments(ctx, kind)
+	if err != nil {
+		return fmt.Errorf("error loading %s documents: %w", kind, err)
+	}
+	for id, document := range documents {
+		var value T
+		if err := json.Unmarshal(document, &value); err != nil {
+			log.Printf("Skipping invalid %s document '%s': %v", kind, id, err)
+			continue
+		}
+		target[id] = value
+	}
+	return nil
+}
+
+// saveDocument encodes and stores a settings document.
+func saveDocument(ctx context.Context, repo repository.Repository, kind, id string, value any) error {
+	document, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error encoding %s document: %w", kind, err)
+	}
+	if err := repo.SaveDocument(ctx, kind, id, document); err != nil {
+		return fmt.Errorf("error saving %s document: %w", kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/repository"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// downsampleLTTB is the downsample value selecting Largest-Triangle-Three-Buckets.
+const downsampleLTTB = "lttb"
+
+// validateDownsample checks the downsampling options of a query. It reports whether downsampling is requested.
+func validateDownsample(mode string, maxPoints int) (bool, error) {
+	switch mode {
+	case "":
+		return false, nil
+	case downsampleLTTB:
+		if maxPoints < 3 || maxPoints > repository.MAX_API_QUERY_POINTS {
+			return false, models.NewAPIError(models.ErrorCodeValidationFailed,
+				fmt.Sprintf("max_points must be between 3 and %d with downsample=lttb", repository.MAX_API_QUERY_POINTS), nil, http.StatusBadRequest)
+		}
+		return true, nil
+	default:
+		return false, models.NewAPIError(models.ErrorCodeValidationFailed, fmt.Sprintf("unknown downsample mode '%s', expected 'lttb'", mode), nil, http.StatusBadRequest)
+	}
+}
+
+// lttb returns the indices of at most threshold points of the series (xs, ys) selected by the
+// Largest-Triangle-Three-Buckets algorithm. The first and last points are always kept; xs must be ascending.
+func lttb(xs, ys []float64, threshold int) []int {
+	n := len(xs)
+	if threshold >= n || threshold < 3 {
+		indices := make([]int, n)
+		for i := range indices {
+			indices[i] = i
+		}
+		return indices
+	}
+
+	indices := make([]int, 0, threshold)
+	indices = append(indices, 0)
+	bucketSize := float64(n-2) / float64(threshold-2)
+	a := 0
+	for i := 0; i < threshold-2; i++ {
+		// Average of the next bucket, the third vertex of the triangles
+		nextStart := int(math.Floor(float64(i+1)*bucketSize)) + 1
+		nextEnd := int(math.Floor(float64(i+2)*bucketSize)) + 1
+		if nextEnd > n {
+			nextEnd = n
+		}
+		var avgX, avgY float64
+		for j := nextStart; j < nextEnd; j++ {
+			avgX += xs[j]
+			avgY += ys[j]
+		}
+		if count := float64(nextEnd - nextStart); count > 0 {
+			avgX /= count
+			avgY /= count
+		}
+
+		// Point of the current bucket forming the largest triangle with the previously selected point
+		start := int(math.Floor(float64(i)*bucketSize)) + 1
+		end := nextStart
+		best, bestArea := start, -1.0
+		for j := start; j < end; j++ {
+			area := math.Abs((xs[a]-avgX)*(ys[j]-ys[a]) - (xs[a]-xs[j])*(avgY-ys[a]))
+			if area > bestArea {
+				best, bestArea = j, area
+			}
+		}
+		indices = append(indices, best)
+		a = best
+	}
+	return append(indices, n-1)
+}
+
+// downsampleSensorReadings reduces each sensor series to at most maxPoints points in place. Null windows are dropped.
+func downsampleSensorReadings(readings map[string][]map[string]interface{}, maxPoints int) {
+	for field, points := range readings {
+		var kept []map[string]interface{}
+		var xs, ys []float64
+		for _, point := range points {
+			value, ok := point["value"].(float64)
+			if !ok {
+				continue
+			}
+			raw, _ := point["time"].(string)
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				continue
+			}
+			kept = append(kept, point)
+			xs = append(xs, float64(t.UnixNano()))
+			ys = append(ys, value)
+		}
+		selected := make([]map[string]interface{}, 0, maxPoints)
+		for _, i := range lttb(xs, ys, maxPoints) {
+			selected = append(selected, kept[i])
+		}
+		readings[field] = selected
+	}
+}
+
+// downsampleDataPoints reduces each consumption series to at most maxPoints points in place. Null windows are dropped.
+func downsampleDataPoints(readings map[string][]models.DataPoint, maxPoints int) {
+	for metric, points := range readings {
+		var kept []models.DataPoint
+		var xs, ys []float64
+		for _, point := range points {
+			if point.Value == nil {
+				continue
+			}
+			kept = append(kept, point)
+			xs = append(xs, float64(point.Time.UnixNano()))
+			ys = append(ys, *point.Value)
+		}
+		selected := make([]models.DataPoint, 0, maxPoints)
+		for _, i := range lttb(xs, ys, maxPoints) {
+			selected = append(selected, kept[i])
+		}
+		readings[metric] = selected
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLTTBBuckets(t *testing.T) {
+	tests := []struct {
+		name      string
+		n         int
+		threshold int
+	}{
+		{"three points from four", 4, 3},
+		{"one point dropped", 10, 9},
+		{"minimum threshold", 10, 3},
+		{"uneven buckets", 100, 7},
+		{"bucket size close to an integer", 1000, 13},
+		{"large series", 15000, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xs := make([]float64, tt.n)
+			ys := make([]float64, tt.n)
+			for i := range xs {
+				xs[i] = float64(i)
+				ys[i] = math.Sin(float64(i) / 3)
+			}
+			indices := lttb(xs, ys, tt.threshold)
+			if len(indices) != tt.threshold {
+				t.Fatalf("%d points kept, want %d", len(indices), tt.threshold)
+			}
+			if indices[0] != 0 || indices[len(indices)-1] != tt.n-1 {
+				t.Errorf("first and last kept points = %d, %d, want 0, %d", indices[0], indices[len(indices)-1], tt.n-1)
+			}
+			// Each point in between comes from its own bucket, so the indices stay strictly ascending
+			bucketSize := float64(tt.n-2) / float64(tt.threshold-2)
+			for i, index := range indices[1 : len(indices)-1] {
+				start := int(math.Floor(float64(i)*bucketSize)) + 1
+				end := int(math.Floor(float64(i+1)*bucketSize)) + 1
+				if index < start || index >= end {
+					t.Errorf("point %d = index %d, outside its bucket [%d, %d)", i+1, index, start, end)
+				}
+				if index <= indices[i] {
+					t.Errorf("indices not ascending: %v", indices)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestLTTBKeepsEverythingUnderThreshold(t *testing.T) {
+	xs := []float64{0, 1, 2, 3, 4}
+	ys := []float64{1, 5, 2, 8, 3}
+	for _, threshold := range []int{2, 5, 10} {
+		if got := lttb(xs, ys, threshold); len(got) != len(xs) {
+			t.Errorf("lttb(threshold=%d) kept %d points, want all %d", threshold, len(got), len(xs))
+		}
+	}
+	if got := lttb(nil, nil, 3); len(got) != 0 {
+		t.Errorf("lttb of an empty series = %v, want empty", got)
+	}
+}
+
+func TestLTTBKeepsPeaks(t *testing.T) {
+	const n, peak, dip = 200, 57, 143
+	xs := make([]float64, n)
+	ys := make([]float64, n)
+	for i := range xs {
+		xs[i] = float64(i)
+	}
+	ys[peak] = 100
+	ys[dip] = -100
+
+	kept := make(map[int]bool)
+	for _, i := range lttb(xs, ys, 10) {
+		kept[i] = true
+	}
+	if !kept[peak] || !kept[dip] {
+		t.Errorf("lttb dropped the peak or the dip: kept %v", kept)
+	}
+}
+
+func TestDownsampleDataPointsSkipsNulls(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var points []models.DataPoint
+	for i := 0; i < 20; i++ {
+		point := models.DataPoint{Time: start.Add(time.Duration(i) * time.Minute)}
+		if i%4 != 1 {
+			value := float64(i)
+			point.Value = &value
+		}
+		points = append(points, point)
+	}
+	readings := map[string][]models.DataPoint{"power": points}
+
+	downsampleDataPoints(readings, 5)
+	got := readings["power"]
+	if len(got) != 5 {
+		t.Fatalf("%d points kept, want 5", len(got))
+	}
+	for _, point := range got {
+		if point.Value == nil {
+			t.Errorf("null window at %s kept", point.Time)
+		}
+	}
+	if !got[0].Time.Equal(start) || !got[4].Time.Equal(start.Add(19*time.Minute)) {
+		t.Errorf("first and last points = %s, %s, want the first and last values", got[0].Time, got[4].Time)
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Margins by which the active power may exceed the apparent power before a point is flagged inconsistent, covering
+// measurement noise and the offsets of idle devices.
+const (
+	powerRelativeTolerance = 0.02
+	powerAbsoluteTolerance = 1.0 // W
+)
+
+// reportEnergyUnit is the unit of the energy in the emissions and weather normalization reports.
+const reportEnergyUnit = "kWh"
+
+// maxEnergyGap is the longest interval between two points of a device over which the power is integrated into its
+// energy counter. Longer silences add no energy.
+const maxEnergyGap = time.Hour
+
+// deriveElectricalMetrics computes the apparent power and power factor of a consumption point, in canonical units,
+// and reports whether its active power is consistent with its voltage and current.
+func deriveElectricalMetrics(req models.ConsumptionReq) (map[string]float64, bool) {
+	derived := make(map[string]float64)
+	apparent := math.Abs(req.Voltage * req.Current)
+	if math.IsNaN(apparent) || math.IsInf(apparent, 0) || math.IsNaN(req.Power) || math.IsInf(req.Power, 0) {
+		return derived, true // Invalid readings are already flagged
+	}
+	derived[models.MetricApparentPower] = apparent
+	if apparent > 0 {
+		derived[models.MetricPowerFactor] = req.Power / apparent
+	}
+	return derived, math.Abs(req.Power) <= apparent*(1+powerRelativeTolerance)+powerAbsoluteTolerance
+}
+
+// energyCounters integrates the active power of each consumption device into a monotonic energy counter.
+type energyCounters struct {
+	mu      sync.Mutex
+	devices map[string]*energyState
+}
+
+// energyState is the counter of a device with its last integrated point. powerKnown is false after a restart,
+// when the counter was loaded without the power of its last point. mu is held from the integration of a point until
+// it is stored, so that the points of a device are integrated in turn.
+type energyState struct {
+	mu         sync.Mutex
+	energy     float64 // Wh
+	lastTime   time.Time
+	lastPower  float64
+	powerKnown bool
+}
+
+// integrateEnergy adds the energy drawn since the previous point of a device to its counter, using the trapezoidal
+// rule on the positive active power (W), and returns the counter value to store with the point. ok is false for
+// points older than the last integrated one, which are stored without counter.
+// The counter only advances through commit, which must be called once the point is written, with whether the write
+// succeeded: a point that failed to be stored leaves the counter as it was.
+func (s *DataService) integrateEnergy(ctx context.Context, deviceID string, power float64, at time.Time) (float64, bool, func(stored bool), error) {
+	noCommit := func(bool) {}
+	if math.IsNaN(power) || math.IsInf(power, 0) {
+		return 0, false, noCommit, nil
+	}
+	c := &s.energy
+	c.mu.Lock()
+	state, ok := c.devices[deviceID]
+	c.mu.Unlock()
+	if !ok {
+		// The counter continues from its last stored value. The lookup runs unlocked, a concurrent first point of
+		// the same device keeps whichever state was stored first.
+		energy, lastTime, _, err := s.repo.QueryLastEnergy(ctx, deviceID)
+		if err != nil {
+			return 0, false, noCommit, err
+		}
+		c.mu.Lock()
+		if c.devices == nil {
+			c.devices = make(map[string]*energyState)
+		}
+		if state, ok = c.devices[deviceID]; !ok {
+			state = &energyState{energy: energy, lastTime: lastTime}
+			c.devices[deviceID] = state
+		}
+		c.mu.Unlock()
+	}
+
+	state.mu.Lock()
+	if !state.lastTime.IsZero() && !at.After(state.lastTime) {
+		state.mu.Unlock()
+		return 0, false, noCommit, nil
+	}
+	power = math.Max(power, 0)
+	energy := state.energy
+	if elapsed := at.Sub(state.lastTime); !state.lastTime.IsZero() && elapsed <= maxEnergyGap {
+		previous := power
+		if state.powerKnown {
+			previous = state.lastPower
+		}
+		energy += (previous + power) / 2 * elapsed.Hours()
+	}
+	commit := func(stored bool) {
+		if stored {
+			state.energy, state.lastTime, state.lastPower, state.powerKnown = energy, at, power, true
+		}
+		state.mu.Unlock()
+	}
+	return energy, true, commit, nil
+}
+
+// energyDeltas turns the energy counter of a device at the end of each window, and its value before the first one,
+// into the energy used in each window in canonical units.
+func energyDeltas(baseline float64, counters []models.DataPoint) []models.DataPoint {
+	deltas := make([]models.DataPoint, 0, len(counters))
+	previous := baseline
+	for _, counter := range counters {
+		delta := *counter.Value - previous
+		if delta < 0 {
+			delta = *counter.Value // The counter restarted from zero
+		}
+		previous = *counter.Value
+		deltas = append(deltas, models.DataPoint{Time: counter.Time, Value: &delta})
+	}
+	return deltas
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/repository"
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// energyRepo has no stored energy counter; the other repository methods are not used by the tests.
+type energyRepo struct {
+	repository.Repository
+}
+
+func (energyRepo) QueryLastEnergy(context.Context, string) (float64, time.Time, bool, error) {
+	return 0, time.Time{}, false, nil
+}
+
+func TestIntegrateEnergyCommitsOnlyStoredPoints(t *testing.T) {
+	s := &DataService{repo: energyRepo{}}
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	points := []struct {
+		power   float64
+		at      time.Duration
+		stored  bool
+		want    float64
+		wantOK  bool
+		comment string
+	}{
+		{1000, 0, true, 0, true, "first point starts the counter"},
+		{1000, 30 * time.Minute, true, 500, true, "trapezoid over 30 minutes"},
+		{3000, time.Hour, false, 1500, true, "failed write, the counter stays at 500 Wh"},
+		{1000, 90 * time.Minute, true, 1500, true, "integrated from the last stored point"},
+		{1000, 80 * time.Minute, true, 0, false, "older point"},
+		{-200, 2 * time.Hour, true, 1750, true, "negative power counts as zero"},
+		{1000, 4 * time.Hour, true, 1750, true, "gap longer than maxEnergyGap adds nothing"},
+	}
+	for _, p := range points {
+		energy, ok, commit, err := s.integrateEnergy(context.Background(), "meter", p.power, start.Add(p.at))
+		if err != nil {
+			t.Fatalf("%s: %v", p.comment, err)
+		}
+		commit(p.stored)
+		if ok != p.wantOK || (ok && math.Abs(energy-p.want) > 1e-9) {
+			t.Errorf("%s: energy = %g, %v, want %g, %v", p.comment, energy, ok, p.want, p.wantOK)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Units of the emissions report.
+const (
+	emissionsIntensityUnit = "gCO2e/kWh"
+	emissionsUnit          = "kgCO2e"
+)
+
+// CarbonIntensityRegistry knows the grid country of each location, the static carbon intensity of each country and
+// the bucket of the time-varying intensity series.
+type CarbonIntensityRegistry struct {
+	factors        map[string]float64
+	locations      map[string]string
+	defaultCountry string
+	bucket         string
+}
+
+// NewCarbonIntensityRegistry creates a CarbonIntensityRegistry with static intensities in gCO2e/kWh per country,
+// per-location countries and a default country.
+func NewCarbonIntensityRegistry(factors map[string]float64, locations map[string]string, defaultCountry, bucket string) *CarbonIntensityRegistry {
+	return &CarbonIntensityRegistry{factors: factors, locations: locations, defaultCountry: defaultCountry, bucket: bucket}
+}
+
+// Resolve returns the requested country, or else the one configured for the location, or else the default one,
+// with its static intensity when one is configured.
+func (c *CarbonIntensityRegistry) Resolve(requested, locationID string) (string, *float64) {
+	country := requested
+	if country == "" {
+		country = c.locations[locationID]
+	}
+	if country == "" {
+		country = c.defaultCountry
+	}
+	if factor, ok := c.factors[country]; ok {
+		return country, &factor
+	}
+	return country, nil
+}
+
+// GetEmissions estimates the CO2e emissions of consumption devices from the increase of their energy counter in each
+// window, multiplied by the carbon intensity of the grid: the static factor of the country, or the mean of the
+// intensity series of the country over the window, the static factor filling its gaps.
+func (s *DataService) GetEmissions(ctx context.Context, req models.EmissionsRequest) (models.EmissionsResponse, error) {
+	if req.LocationID == "" {
+		return models.EmissionsResponse{}, models.NewAPIError(models.ErrorCodeMissingParameter, "location_id is required", nil, http.StatusBadRequest)
+	}
+	invalid := func(message string) error {
+		return models.NewAPIError(models.ErrorCodeValidationFailed, message, nil, http.StatusBadRequest)
+	}
+	switch req.Intensity {
+	case "":
+		req.Intensity = models.IntensityStatic
+	case models.IntensityStatic, models.IntensitySeries:
+	default:
+		return models.EmissionsResponse{}, invalid("intensity must be 'static' or 'series'")
+	}
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return models.EmissionsResponse{}, err
+	}
+	series := len(req.DeviceIDs)
+	if req.Intensity == models.IntensitySeries {
+		series++
+	}
+	window, err := planWindow(req.TimeRangeStart, req.TimeRangeStop, req.WindowPeriod, series)
+	if err != nil {
+		return models.EmissionsResponse{}, err
+	}
+	timezone, loc, err := s.timezones.Resolve(req.Timezone, req.LocationID)
+	if err != nil {
+		return models.EmissionsResponse{}, err
+	}
+	country, factor := s.carbon.Resolve(req.Country, req.LocationID)
+	if country == "" {
+		return models.EmissionsResponse{}, invalid(fmt.Sprintf("no country is configured for location '%s', please set country", req.LocationID))
+	}
+	if req.Intensity == models.IntensityStatic && factor == nil {
+		return models.EmissionsResponse{}, invalid(fmt.Sprintf("no carbon intensity is configured for country '%s'", country))
+	}
+
+	// Intensity of each window, keyed by window time
+	intensities := make(map[int64]float64)
+	if req.Intensity == models.IntensitySeries {
+		points, err := s.repo.QueryCarbonIntensity(ctx, s.carbon.bucket, country, window, timezone, start, stop)
+		if err != nil {
+			return models.EmissionsResponse{}, fmt.Errorf("error querying carbon intensity: %w", err)
+		}
+		for _, p := range points {
+			intensities[p.Time.UnixNano()] = *p.Value
+		}
+	}
+
+	resp := models.EmissionsResponse{
+		LocationID:      req.LocationID,
+		Country:         country,
+		IntensitySource: req.Intensity,
+		WindowPeriod:    window,
+		Timezone:        timezone,
+		EnergyUnit:      reportEnergyUnit,
+		IntensityUnit:   emissionsIntensityUnit,
+		EmissionsUnit:   emissionsUnit,
+		Devices:         make([]models.DeviceEmissions, 0, len(req.DeviceIDs)),
+	}
+	for _, deviceID := range req.DeviceIDs {
+		baseline, counters, err := s.repo.QueryEnergyWindows(ctx, deviceID, window, timezone, start, stop)
+		if err != nil {
+			return models.EmissionsResponse{}, fmt.Errorf("error querying energy of device %s: %w", deviceID, err)
+		}
+
+		device := models.DeviceEmissions{DeviceID: deviceID, Windows: make([]models.EmissionsWindow, 0, len(counters))}
+		for _, delta := range energyDeltas(baseline, counters) {
+			energy, err := s.units.FromCanonical(models.MetricEnergy, reportEnergyUnit, *delta.Value)
+			if err != nil {
+				return models.EmissionsResponse{}, err
+			}
+
+			w := models.EmissionsWindow{Time: delta.Time.In(loc), Energy: energy}
+			intensity, ok := intensities[delta.Time.UnixNano()]
+			if !ok && factor != nil {
+				intensity, ok = *factor, true
+			}
+			if ok {
+				emissions := energy * intensity / 1000 // g -> kg
+				w.Intensity, w.Emissions = &intensity, &emissions
+				device.Emissions += emissions
+			} else {
+				device.UncoveredEnergy += energy
+			}
+			device.Energy += energy
+			device.Windows = append(device.Windows, w)
+		}
+
+		resp.Energy += device.Energy
+		resp.Emissions += device.Emissions
+		resp.UncoveredEnergy += device.UncoveredEnergy
+		resp.Devices = append(resp.Devices, device)
+	}
+	return resp, nil
+}
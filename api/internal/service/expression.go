@@ -0,0 +1,307 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"unicode"
+)
+
+// expression is a compiled arithmetic expression evaluated against the values of its variables.
+type expression func(vars map[string]float64) float64
+
+// expressionFunction is a function callable from an expression. minArgs == maxArgs for fixed arities, maxArgs -1
+// for variadic functions.
+type expressionFunction struct {
+	minArgs, maxArgs int
+	call             func(args []float64) float64
+}
+
+// maxExpressionDepth bounds the nesting of parentheses, calls, signs and powers, which the parser follows recursively.
+const maxExpressionDepth = 32
+
+// expressionFunctions are the functions of the expression language.
+var expressionFunctions = map[string]expressionFunction{
+	"abs":   unaryFunction(math.Abs),
+	"sqrt":  unaryFunction(math.Sqrt),
+	"exp":   unaryFunction(math.Exp),
+	"ln":    unaryFunction(math.Log),
+	"log10": unaryFunction(math.Log10),
+	"floor": unaryFunction(math.Floor),
+	"ceil":  unaryFunction(math.Ceil),
+	"round": unaryFunction(math.Round),
+	"sin":   unaryFunction(math.Sin),
+	"cos":   unaryFunction(math.Cos),
+	"tan":   unaryFunction(math.Tan),
+	"atan":  unaryFunction(math.Atan),
+	"pow":   {2, 2, func(args []float64) float64 { return math.Pow(args[0], args[1]) }},
+	"min": {2, -1, func(args []float64) float64 {
+		result := args[0]
+		for _, v := range args[1:] {
+			result = math.Min(result, v)
+		}
+		return result
+	}},
+	"max": {2, -1, func(args []float64) float64 {
+		result := args[0]
+		for _, v := range args[1:] {
+			result = math.Max(result, v)
+		}
+		return result
+	}},
+}
+
+// expressionConstants are the named constants of the expression language.
+var expressionConstants = map[string]float64{"pi": math.Pi, "e": math.E}
+
+func unaryFunction(fn func(float64) float64) expressionFunction {
+	return expressionFunction{1, 1, func(args []float64) float64 { return fn(args[0]) }}
+}
+
+// compileExpression parses an expression made of numbers, the given variables, the constants pi and e, the operators
+// + - * / ^ (power, right-associative) and parentheses, and calls of expressionFunctions.
+func compileExpression(source string, variables map[string]bool) (expression, error) {
+	p := &expressionParser{source: source, variables: variables}
+	p.next()
+	expr, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "" {
+		return nil, p.fail("unexpected '%s'", p.token)
+	}
+	return expr, nil
+}
+
+// expressionParser is a recursive-descent parser holding the current token and the position it starts at.
+type expressionParser struct {
+	source    string
+	variables map[string]bool
+	pos       int
+	token     string
+	tokenPos  int
+	depth     int // Nesting of the operand being parsed
+}
+
+// next reads the following token: a number, an identifier or a single operator character. The token is empty at the
+// end of the source.
+func (p *expressionParser) next() {
+	for p.pos < len(p.source) && unicode.IsSpace(rune(p.source[p.pos])) {
+		p.pos++
+	}
+	p.tokenPos = p.pos
+	if p.pos >= len(p.source) {
+		p.token = ""
+		return
+	}
+	c := p.source[p.pos]
+	end := p.pos + 1
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for end < len(p.source) && (isDigit(p.source[end]) || p.source[end] == '.') {
+			end++
+		}
+		// Exponent, e.g. 1e-3
+		if end < len(p.source) && (p.source[end] == 'e' || p.source[end] == 'E') {
+			exp := end + 1
+			if exp < len(p.source) && (p.source[exp] == '+' || p.source[exp] == '-') {
+				exp++
+			}
+			if exp < len(p.source) && isDigit(p.source[exp]) {
+				for end = exp; end < len(p.source) && isDigit(p.source[end]); end++ {
+				}
+			}
+		}
+	case isIdentifierStart(c):
+		for end < len(p.source) && (isIdentifierStart(p.source[end]) || isDigit(p.source[end])) {
+			end++
+		}
+	}
+	p.token = p.source[p.pos:end]
+	p.pos = end
+}
+
+// fail reports an error at the current token.
+func (p *expressionParser) fail(format string, args ...interface{}) error {
+	return p.failAt(p.tokenPos, format, args...)
+}
+
+// failAt reports an error at a byte offset of the source.
+func (p *expressionParser) failAt(pos int, format string, args ...interface{}) error {
+	message := fmt.Sprintf("invalid expression at position %d: %s", pos+1, fmt.Sprintf(format, args...))
+	return models.NewAPIError(models.ErrorCodeValidationFailed, message, nil, http.StatusBadRequest)
+}
+
+// parseSum parses terms separated by + and -.
+func (p *expressionParser) parseSum() (expression, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.token == "+" || p.token == "-" {
+		op := p.token
+		p.next()
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "+" {
+			left = func(vars map[string]float64) float64 { return l(vars) + right(vars) }
+		} else {
+			left = func(vars map[string]float64) float64 { return l(vars) - right(vars) }
+		}
+	}
+	return left, nil
+}
+
+// parseProduct parses factors separated by * and /.
+func (p *expressionParser) parseProduct() (expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.token == "*" || p.token == "/" {
+		op := p.token
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "*" {
+			left = func(vars map[string]float64) float64 { return l(vars) * right(vars) }
+		} else {
+			left = func(vars map[string]float64) float64 { return l(vars) / right(vars) }
+		}
+	}
+	return left, nil
+}
+
+// parseUnary parses a signed power. The sign applies after the power: -x^2 is -(x^2). Every nested operand goes
+// through parseUnary, which bounds the nesting.
+func (p *expressionParser) parseUnary() (expression, error) {
+	if p.depth++; p.depth > maxExpressionDepth {
+		return nil, p.fail("expression nested more than %d levels deep", maxExpressionDepth)
+	}
+	defer func() { p.depth-- }()
+	if p.token == "-" || p.token == "+" {
+		negate := p.token == "-"
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if negate {
+			return func(vars map[string]float64) float64 { return -operand(vars) }, nil
+		}
+		return operand, nil
+	}
+	return p.parsePower()
+}
+
+// parsePower parses a primary raised to a signed power, right-associative.
+func (p *expressionParser) parsePower() (expression, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "^" {
+		return base, nil
+	}
+	p.next()
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return func(vars map[string]float64) float64 { return math.Pow(base(vars), exponent(vars)) }, nil
+}
+
+// parsePrimary parses a number, a variable, a constant, a function call or a parenthesized expression.
+func (p *expressionParser) parsePrimary() (expression, error) {
+	token := p.token
+	switch {
+	case token == "":
+		return nil, p.fail("unexpected end of expression")
+	case token == "(":
+		p.next()
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.token != ")" {
+			return nil, p.fail("missing ')'")
+		}
+		p.next()
+		return inner, nil
+	case isDigit(token[0]) || token[0] == '.':
+		value, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, p.fail("invalid number '%s'", token)
+		}
+		p.next()
+		return func(map[string]float64) float64 { return value }, nil
+	case isIdentifierStart(token[0]):
+		at := p.tokenPos
+		p.next()
+		if p.token == "(" {
+			return p.parseCall(token, at)
+		}
+		if p.variables[token] {
+			return func(vars map[string]float64) float64 { return vars[token] }, nil
+		}
+		if value, ok := expressionConstants[token]; ok {
+			return func(map[string]float64) float64 { return value }, nil
+		}
+		return nil, p.failAt(at, "unknown variable '%s'", token)
+	}
+	return nil, p.fail("unexpected '%s'", token)
+}
+
+// parseCall parses the arguments of a call of the function name found at offset at, the current token being the
+// opening parenthesis.
+func (p *expressionParser) parseCall(name string, at int) (expression, error) {
+	fn, ok := expressionFunctions[name]
+	if !ok {
+		return nil, p.failAt(at, "unknown function '%s'", name)
+	}
+	p.next()
+	var args []expression
+	if p.token != ")" {
+		for {
+			arg, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.token != "," {
+				break
+			}
+			p.next()
+		}
+	}
+	if p.token != ")" {
+		return nil, p.fail("missing ')' after the arguments of %s", name)
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, p.failAt(at, "wrong number of arguments for %s", name)
+	}
+	p.next()
+	return func(vars map[string]float64) float64 {
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			values[i] = arg(vars)
+		}
+		return fn.call(values)
+	}, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
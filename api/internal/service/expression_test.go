@@ -0,0 +1,106 @@
+package service
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCompileExpression(t *testing.T) {
+	variables := map[string]bool{"x": true, "y": true, "temp_1": true}
+	vars := map[string]float64{"x": 3, "y": 2, "temp_1": 20}
+	tests := []struct {
+		source string
+		want   float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"24 / 4 / 2", 3},
+		{"-x^2", -9},
+		{"(-x)^2", 9},
+		{"2^3^2", 512},
+		{"2^-1", 0.5},
+		{"-2^-2", -0.25},
+		{"x - -y", 5},
+		{"+x * -y", -6},
+		{"1.5e1 + .5", 15.5},
+		{"2E-1 * 10", 2},
+		{"temp_1 * 9 / 5 + 32", 68},
+		{"pi", math.Pi},
+		{"ln(e)", 1},
+		{"pow(y, 10)", 1024},
+		{"min(x, y, 1)", 1},
+		{"max(x, y)", 3},
+		{"sqrt(abs(-16)) + round(2.5)", 7},
+		{"atan(1) * 4", math.Pi},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			expr, err := compileExpression(tt.source, variables)
+			if err != nil {
+				t.Fatalf("compileExpression(%q): %v", tt.source, err)
+			}
+			if got := expr(vars); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("%s = %g, want %g", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileExpressionErrors(t *testing.T) {
+	variables := map[string]bool{"x": true}
+	tests := []struct {
+		name, source string
+	}{
+		{"empty", ""},
+		{"dangling operator", "x +"},
+		{"missing parenthesis", "(x + 1"},
+		{"extra parenthesis", "x + 1)"},
+		{"unknown variable", "x + y"},
+		{"unknown function", "foo(x)"},
+		{"unary function without argument", "abs()"},
+		{"unary function with two arguments", "sqrt(x, 2)"},
+		{"pow with one argument", "pow(x)"},
+		{"pow with three arguments", "pow(x, 2, 3)"},
+		{"min with one argument", "min(x)"},
+		{"trailing comma", "max(x, )"},
+		{"invalid number", "1.2.3"},
+		{"incomplete exponent", "1e"},
+		{"two values", "x 2"},
+		{"invalid character", "x # 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileExpression(tt.source, variables); err == nil {
+				t.Errorf("compileExpression(%q) succeeded, want an error", tt.source)
+			}
+		})
+	}
+}
+
+func TestCompileExpressionDepth(t *testing.T) {
+	variables := map[string]bool{"x": true}
+	nested := func(open, close string, n int) string {
+		return strings.Repeat(open, n) + "x" + strings.Repeat(close, n)
+	}
+	tests := []struct {
+		name, source string
+		wantErr      bool
+	}{
+		{"parentheses within the limit", nested("(", ")", maxExpressionDepth-2), false},
+		{"parentheses beyond the limit", nested("(", ")", maxExpressionDepth), true},
+		{"calls beyond the limit", nested("abs(", ")", maxExpressionDepth), true},
+		{"signs beyond the limit", nested("-", "", maxExpressionDepth), true},
+		{"powers beyond the limit", strings.Repeat("x^", maxExpressionDepth) + "x", true},
+		{"long flat sum", "x" + strings.Repeat(" + x", 200), false},
+		{"deep nesting does not overflow the stack", nested("(", ")", 100000), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileExpression(tt.source, variables); (err != nil) != tt.wantErr {
+				t.Errorf("compileExpression error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/repository"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Defaults of the forecast endpoint.
+const (
+	defaultForecastHistory    = "7d"
+	defaultForecastHorizon    = "1d"
+	defaultForecastSeason     = "1d"
+	defaultForecastConfidence = 0.95
+)
+
+// smoothingGrid holds the values tried for each Holt-Winters smoothing factor that is not given.
+var smoothingGrid = []float64{0.01, 0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9}
+
+// Forecast fits a Holt-Winters or seasonal-naive model to the aggregated history of a field ending now and predicts
+// its windows up to the horizon, with a prediction interval at the requested confidence.
+func (s *DataService) Forecast(ctx context.Context, req models.ForecastRequest) (models.ForecastResponse, error) {
+	if req.DeviceID == "" || req.Field == "" {
+		return models.ForecastResponse{}, models.NewAPIError(models.ErrorCodeMissingParameter, "device_id and field are required", nil, http.StatusBadRequest)
+	}
+	invalid := func(message string) error {
+		return models.NewAPIError(models.ErrorCodeValidationFailed, message, nil, http.StatusBadRequest)
+	}
+	switch req.Model {
+	case "":
+		req.Model = models.ForecastModelHoltWinters
+	case models.ForecastModelHoltWinters, models.ForecastModelSeasonalNaive:
+	default:
+		return models.ForecastResponse{}, invalid("model must be 'holt_winters' or 'seasonal_naive'")
+	}
+	if req.Confidence == 0 {
+		req.Confidence = defaultForecastConfidence
+	}
+	if req.Confidence <= 0 || req.Confidence >= 1 {
+		return models.ForecastResponse{}, invalid("confidence must be between 0 and 1, e.g. 0.95")
+	}
+	for name, factor := range map[string]*float64{"alpha": req.Alpha, "beta": req.Beta, "gamma": req.Gamma} {
+		if factor != nil && (*factor < 0 || *factor > 1) {
+			return models.ForecastResponse{}, invalid(fmt.Sprintf("%s must be between 0 and 1", name))
+		}
+	}
+	if req.History == "" {
+		req.History = defaultForecastHistory
+	}
+	if req.Horizon == "" {
+		req.Horizon = defaultForecastHorizon
+	}
+	if req.Season == "" {
+		req.Season = defaultForecastSeason
+	}
+
+	_, loc, err := s.timezones.Resolve(req.Timezone, req.LocationID)
+	if err != nil {
+		return models.ForecastResponse{}, err
+	}
+	now := time.Now()
+	start, ok := shiftBy(now, req.History, -1, loc)
+	if !ok {
+		return models.ForecastResponse{}, models.NewAPIError(models.ErrorCodeInvalidFormat, "history must be a positive duration (e.g. '168h') or a calendar period ('7d', '4w')", nil, http.StatusBadRequest)
+	}
+	var horizonEnd time.Time
+	if req.Horizon == models.ForecastHorizonEndOfDay {
+		local := now.In(loc)
+		horizonEnd = time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+	} else if horizonEnd, ok = shiftBy(now, req.Horizon, 1, loc); !ok {
+		return models.ForecastResponse{}, models.NewAPIError(models.ErrorCodeInvalidFormat, "horizon must be a positive duration (e.g. '6h'), a calendar period ('1d', '1w') or 'end_of_day'", nil, http.StatusBadRequest)
+	}
+
+	window, err := planWindow(start.Format(time.RFC3339), now.Format(time.RFC3339), req.WindowPeriod, 1)
+	if err != nil {
+		return models.ForecastResponse{}, err
+	}
+	m, ok := windowsPerSeason(req.Season, window)
+	if !ok || m < 2 {
+		return models.ForecastResponse{}, invalid(fmt.Sprintf("season '%s' must be a whole number of at least two %s windows", req.Season, window))
+	}
+
+	points, unit, err := s.fieldSeries(ctx, seriesSelector{
+		Source:     req.Source,
+		LocationID: req.LocationID,
+		DeviceID:   req.DeviceID,
+		Field:      req.Field,
+		Window:     window,
+		Timezone:   req.Timezone,
+		Unit:       req.Unit,
+		Fill:       fillLinear,
+	}, start, now)
+	if err != nil {
+		return models.ForecastResponse{}, err
+	}
+	points = completeWindows(points, window, loc)
+	if len(points) < 2*m {
+		return models.ForecastResponse{}, invalid(fmt.Sprintf("the history holds %d %s windows with data, at least two seasons (%d windows) are needed", len(points), window, 2*m))
+	}
+	y := make([]float64, len(points))
+	for i, p := range points {
+		y[i] = *p.Value
+	}
+
+	// Windows are predicted from the one following the last complete window up to the horizon
+	last := points[len(points)-1].Time
+	var times []time.Time
+	for h := 1; ; h++ {
+		t, _ := shiftBy(last, window, h, loc)
+		if t.After(horizonEnd) {
+			break
+		}
+		if len(times) == repository.MAX_API_QUERY_POINTS {
+			return models.ForecastResponse{}, invalid(fmt.Sprintf("the horizon spans more than %d %s windows, please use a shorter horizon or a larger window_period", repository.MAX_API_QUERY_POINTS, window))
+		}
+		times = append(times, t)
+	}
+
+	resp := models.ForecastResponse{
+		DeviceID:     req.DeviceID,
+		Field:        req.Field,
+		Unit:         unit,
+		Model:        req.Model,
+		WindowPeriod: window,
+		Season:       req.Season,
+		SeasonLength: m,
+		Confidence:   req.Confidence,
+		Forecast:     make([]models.ForecastPoint, 0, len(times)),
+	}
+	var predictions, stdErrors []float64
+	if req.Model == models.ForecastModelSeasonalNaive {
+		predictions, stdErrors, resp.RMSE = seasonalNaiveForecast(y, m, len(times))
+	} else {
+		hw := fitHoltWinters(y, m, req.Alpha, req.Beta, req.Gamma)
+		resp.Alpha, resp.Beta, resp.Gamma = &hw.alpha, &hw.beta, &hw.gamma
+		predictions, stdErrors, resp.RMSE = hw.forecast(y, len(times))
+	}
+
+	z := math.Sqrt2 * math.Erfinv(req.Confidence)
+	for i, t := range times {
+		resp.Forecast = append(resp.Forecast, models.ForecastPoint{
+			Time:  t,
+			Value: predictions[i],
+			Lower: predictions[i] - z*stdErrors[i],
+			Upper: predictions[i] + z*stdErrors[i],
+		})
+	}
+	if req.IncludeHistory {
+		resp.History = points
+	}
+	return resp, nil
+}
+
+// windowsPerSeason returns the number of windows in a season, counted from a fixed UTC reference so that calendar
+// windows and seasons ("1mo" in "1y") line up. ok is false when the season is not a whole number of windows.
+func windowsPerSeason(season, window string) (int, bool) {
+	ref := time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end, ok := shiftBy(ref, season, 1, time.UTC)
+	if !ok {
+		return 0, false
+	}
+	for k := 1; k <= repository.MAX_API_QUERY_POINTS; k++ {
+		t, ok := shiftBy(ref, window, k, time.UTC)
+		if !ok || t.After(end) {
+			return 0, false
+		}
+		if t.Equal(end) {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// completeWindows drops the last window when the range stopped inside it, then the empty windows at both ends of a
+// linearly filled series. Calendar windows are measured in loc.
+func completeWindows(points []models.DataPoint, window string, loc *time.Location) []models.DataPoint {
+	if n := len(points); n >= 2 {
+		if expected, _ := shiftBy(points[n-2].Time, window, 1, loc); points[n-1].Time.Before(expected) {
+			points = points[:n-1]
+		}
+	}
+	for len(points) > 0 && points[0].Value == nil {
+		points = points[1:]
+	}
+	for len(points) > 0 && points[len(points)-1].Value == nil {
+		points = points[:len(points)-1]
+	}
+	return points
+}
+
+// holtWinters is an additive Holt-Winters model with a season of m windows.
+type holtWinters struct {
+	alpha, beta, gamma float64
+	m                  int
+}
+
+// fitHoltWinters returns the model minimizing the one-step squared error over y, searching the smoothing factors
+// that are not given on smoothingGrid.
+func fitHoltWinters(y []float64, m int, alpha, beta, gamma *float64) holtWinters {
+	candidates := func(fixed *float64) []float64 {
+		if fixed != nil {
+			return []float64{*fixed}
+		}
+		return smoothingGrid
+	}
+
+	best, bestSSE := holtWinters{m: m}, math.Inf(1)
+	for _, a := range candidates(alpha) {
+		for _, b := range candidates(beta) {
+			for _, g := range candidates(gamma) {
+				hw := holtWinters{alpha: a, beta: b, gamma: g, m: m}
+				if _, _, _, sse := hw.smooth(y); sse < bestSSE {
+					best, bestSSE = hw, sse
+				}
+			}
+		}
+	}
+	return best
+}
+
+// smooth runs the model over y, initialized from its first two seasons, and returns the final level, trend and
+// seasonal components with the sum of the squared one-step errors.
+func (hw holtWinters) smooth(y []float64) (level, trend float64, seasonal []float64, sse float64) {
+	m := hw.m
+	var first, second float64
+	for i := 0; i < m; i++ {
+		first += y[i]
+		second += y[m+i]
+	}
+	level = first / float64(m)
+	trend = (second - first) / float64(m*m)
+	seasonal = make([]float64, m)
+	for i := 0; i < m; i++ {
+		seasonal[i] = y[i] - level
+	}
+
+	for t := m; t < len(y); t++ {
+		s := seasonal[t%m]
+		e := y[t] - (level + trend + s)
+		sse += e * e
+		newLevel := hw.alpha*(y[t]-s) + (1-hw.alpha)*(level+trend)
+		trend = hw.beta*(newLevel-level) + (1-hw.beta)*trend
+		seasonal[t%m] = hw.gamma*(y[t]-newLevel) + (1-hw.gamma)*s
+		level = newLevel
+	}
+	return level, trend, seasonal, sse
+}
+
+// forecast predicts the h windows following y and returns the predictions, their standard errors and the one-step
+// RMSE over y. The standard errors follow the additive ETS(A,A,A) variance:
+// σ²(1 + Σ_{j<h} (α(1 + jβ) + γ(1-α)·[j mod m = 0])²).
+func (hw holtWinters) forecast(y []float64, h int) ([]float64, []float64, float64) {
+	level, trend, seasonal, sse := hw.smooth(y)
+	sigma := math.Sqrt(sse / float64(len(y)-hw.m))
+
+	predictions := make([]float64, h)
+	stdErrors := make([]float64, h)
+	var variance float64 = 1
+	for i := 1; i <= h; i++ {
+		predictions[i-1] = level + float64(i)*trend + seasonal[(len(y)+i-1)%hw.m]
+		stdErrors[i-1] = sigma * math.Sqrt(variance)
+		c := hw.alpha * (1 + float64(i)*hw.beta)
+		if i%hw.m == 0 {
+			c += hw.gamma * (1 - hw.alpha)
+		}
+		variance += c * c
+	}
+	return predictions, stdErrors, sigma
+}
+
+// seasonalNaiveForecast predicts each of the h windows following y with the value of the same window in the last
+// season and returns the predictions, their standard errors and the RMSE of the seasonal differences of y.
+func seasonalNaiveForecast(y []float64, m, h int) ([]float64, []float64, float64) {
+	var sse float64
+	for t := m; t < len(y); t++ {
+		e := y[t] - y[t-m]
+		sse += e * e
+	}
+	sigma := math.Sqrt(sse / float64(len(y)-m))
+
+	predictions := make([]float64, h)
+	stdErrors := make([]float64, h)
+	for i := 1; i <= h; i++ {
+		predictions[i-1] = y[len(y)-m+(i-1)%m]
+		stdErrors[i-1] = sigma * math.Sqrt(float64((i-1)/m+1))
+	}
+	return predictions, stdErrors, sigma
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+// seasonalSeries returns seasons full seasons of pattern on top of a linear trend.
+func seasonalSeries(pattern []float64, seasons int, intercept, slope float64) []float64 {
+	y := make([]float64, 0, seasons*len(pattern))
+	for t := 0; t < seasons*len(pattern); t++ {
+		y = append(y, intercept+slope*float64(t)+pattern[t%len(pattern)])
+	}
+	return y
+}
+
+func TestHoltWintersForecast(t *testing.T) {
+	pattern := []float64{0, 10, 20, 5}
+	tests := []struct {
+		name      string
+		slope     float64
+		seasons   int
+		tolerance float64 // Largest accepted prediction error
+	}{
+		{"flat seasonal series", 0, 4, 1e-9},
+		{"seasonal series with a trend", 0.5, 12, 0.5},
+		{"seasonal series with a steep trend", 3, 20, 1},
+	}
+	const m, h = 4, 8
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			y := seasonalSeries(pattern, tt.seasons, 100, tt.slope)
+			hw := fitHoltWinters(y, m, nil, nil, nil)
+			predictions, stdErrors, sigma := hw.forecast(y, h)
+
+			future := seasonalSeries(pattern, tt.seasons+h/m, 100, tt.slope)[len(y):]
+			for i, want := range future {
+				if math.Abs(predictions[i]-want) > tt.tolerance {
+					t.Errorf("prediction %d = %.3f, want %.3f ± %g (model %+v)", i, predictions[i], want, tt.tolerance, hw)
+				}
+			}
+			if math.Abs(stdErrors[0]-sigma) > 1e-9 {
+				t.Errorf("first standard error = %g, want the one-step RMSE %g", stdErrors[0], sigma)
+			}
+			for i := 1; i < h; i++ {
+				if stdErrors[i] < stdErrors[i-1] {
+					t.Errorf("standard errors decrease at %d: %v", i, stdErrors)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestFitHoltWintersKeepsGivenFactors(t *testing.T) {
+	y := seasonalSeries([]float64{1, 4, 2}, 6, 10, 0.2)
+	alpha, gamma := 0.42, 0.17
+	hw := fitHoltWinters(y, 3, &alpha, nil, &gamma)
+	if hw.alpha != alpha || hw.gamma != gamma {
+		t.Errorf("fitted %+v, want alpha %g and gamma %g kept", hw, alpha, gamma)
+	}
+	found := false
+	for _, b := range smoothingGrid {
+		found = found || hw.beta == b
+	}
+	if !found {
+		t.Errorf("beta %g is not on the search grid", hw.beta)
+	}
+}
+
+func TestSeasonalNaiveForecast(t *testing.T) {
+	y := []float64{1, 2, 3, 1, 2, 3, 2, 3, 4}
+	predictions, stdErrors, sigma := seasonalNaiveForecast(y, 3, 7)
+
+	want := []float64{2, 3, 4, 2, 3, 4, 2}
+	for i := range want {
+		if predictions[i] != want[i] {
+			t.Errorf("predictions = %v, want %v", predictions, want)
+			break
+		}
+	}
+	// Seasonal differences are 0, 0, 0, 1, 1, 1
+	if wantSigma := math.Sqrt(0.5); math.Abs(sigma-wantSigma) > 1e-12 {
+		t.Errorf("sigma = %g, want %g", sigma, wantSigma)
+	}
+	// The error grows with the number of seasons ahead
+	for i, k := range []float64{1, 1, 1, 2, 2, 2, 3} {
+		if want := sigma * math.Sqrt(k); math.Abs(stdErrors[i]-want) > 1e-12 {
+			t.Errorf("standard error %d = %g, want %g", i, stdErrors[i], want)
+		}
+	}
+}
+
+func TestWindowsPerSeason(t *testing.T) {
+	tests := []struct {
+		season, window string
+		want           int
+		wantOK         bool
+	}{
+		{"1d", "1h", 24, true},
+		{"1d", "15m", 96, true},
+		{"1w", "1d", 7, true},
+		{"1y", "1mo", 12, true},
+		{"1d", "7m", 0, false},
+		{"1mo", "1w", 0, false},
+		{"1h", "1d", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := windowsPerSeason(tt.season, tt.window)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("windowsPerSeason(%q, %q) = %d, %v, want %d, %v", tt.season, tt.window, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Gap fill strategies of the empty windows of aggregated queries.
+const (
+	fillNull     = "null"     // Keep empty windows as null (default)
+	fillPrevious = "previous" // Repeat the last known value
+	fillLinear   = "linear"   // Interpolate between the surrounding known values
+	fillZero     = "zero"     // Use 0
+	fillNone     = "none"     // Drop empty windows
+)
+
+// gapFill is a validated fill strategy. maxDistance is the longest filled gap, 0 meaning unlimited.
+type gapFill struct {
+	mode        string
+	maxDistance time.Duration
+}
+
+// parseGapFill validates the fill parameters of a query.
+func parseGapFill(mode, rawMaxDistance string) (gapFill, error) {
+	switch mode {
+	case "":
+		mode = fillNull
+	case fillNull, fillPrevious, fillLinear, fillZero, fillNone:
+	default:
+		return gapFill{}, models.NewAPIError(models.ErrorCodeValidationFailed,
+			fmt.Sprintf("unknown fill '%s', expected null, previous, linear, zero or none", mode), nil, http.StatusBadRequest)
+	}
+	maxDistance, err := parseOptionalDuration("fill_max_distance", rawMaxDistance, 0)
+	if err != nil {
+		return gapFill{}, err
+	}
+	return gapFill{mode: mode, maxDistance: maxDistance}, nil
+}
+
+// skipEmpty reports whether empty windows should not be created at all.
+func (f gapFill) skipEmpty() bool {
+	return f.mode == fillNone
+}
+
+// within reports whether a gap of the given length may be filled.
+func (f gapFill) within(gap time.Duration) bool {
+	return f.maxDistance == 0 || gap <= f.maxDistance
+}
+
+// apply fills the null values of a series in place. previous and zero fill a window when it is at most maxDistance
+// after the last known value (zero also fills leading windows); linear fills windows between two known values at
+// most maxDistance apart.
+func (f gapFill) apply(times []time.Time, values []*float64) {
+	if f.mode == fillNull || f.mode == fillNone {
+		return
+	}
+	prev := -1
+	for i := range values {
+		if values[i] != nil {
+			prev = i
+			continue
+		}
+		switch f.mode {
+		case fillPrevious:
+			if prev >= 0 && f.within(times[i].Sub(times[prev])) {
+				v := *values[prev]
+				values[i] = &v
+			}
+		case fillZero:
+			if prev < 0 || f.within(times[i].Sub(times[prev])) {
+				v := 0.0
+				values[i] = &v
+			}
+		case fillLinear:
+			next := i + 1
+			for next < len(values) && values[next] == nil {
+				next++
+			}
+			if prev < 0 || next == len(values) || !f.within(times[next].Sub(times[prev])) {
+				continue
+			}
+			span := times[next].Sub(times[prev]).Seconds()
+			ratio := times[i].Sub(times[prev]).Seconds() / span
+			v := *values[prev] + (*values[next]-*values[prev])*ratio
+			values[i] = &v
+		}
+	}
+}
+
+// fillSensorReadings applies the fill strategy to every sensor series in place.
+func (f gapFill) fillSensorReadings(readings map[string][]map[string]interface{}) {
+	if f.mode == fillNull || f.mode == fillNone {
+		return
+	}
+	for _, points := range readings {
+		times := make([]time.Time, len(points))
+		values := make([]*float64, len(points))
+		for i, point := range points {
+			raw, _ := point["time"].(string)
+			times[i], _ = time.Parse(time.RFC3339, raw)
+			if value, ok := point["value"].(float64); ok {
+				values[i] = &value
+			}
+		}
+		f.apply(times, values)
+		for i, point := range points {
+			if values[i] != nil {
+				point["value"] = *values[i]
+			}
+		}
+	}
+}
+
+// fillDataPoints applies the fill strategy to every consumption series in place.
+func (f gapFill) fillDataPoints(readings map[string][]models.DataPoint) {
+	if f.mode == fillNull || f.mode == fillNone {
+		return
+	}
+	for _, points := range readings {
+		times := make([]time.Time, len(points))
+		values := make([]*float64, len(points))
+		for i, point := range points {
+			times[i], values[i] = point.Time, point.Value
+		}
+		f.apply(times, values)
+		for i := range points {
+			points[i].Value = values[i]
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGapFillApply(t *testing.T) {
+	v := func(x float64) *float64 { return &x }
+	tests := []struct {
+		name        string
+		mode        string
+		maxDistance time.Duration
+		values      []*float64 // One per minute
+		want        []*float64
+	}{
+		{"null keeps gaps", fillNull, 0,
+			[]*float64{v(1), nil, v(3)},
+			[]*float64{v(1), nil, v(3)}},
+		{"previous", fillPrevious, 0,
+			[]*float64{nil, v(1), nil, nil, v(4), nil},
+			[]*float64{nil, v(1), v(1), v(1), v(4), v(4)}},
+		{"previous within max distance", fillPrevious, 2 * time.Minute,
+			[]*float64{v(1), nil, nil, nil, v(5)},
+			[]*float64{v(1), v(1), v(1), nil, v(5)}},
+		{"zero fills leading windows", fillZero, time.Minute,
+			[]*float64{nil, v(2), nil, nil},
+			[]*float64{v(0), v(2), v(0), nil}},
+		{"linear", fillLinear, 0,
+			[]*float64{v(0), nil, nil, nil, v(8)},
+			[]*float64{v(0), v(2), v(4), v(6), v(8)}},
+		{"linear leaves edges", fillLinear, 0,
+			[]*float64{nil, v(1), nil, v(3), nil},
+			[]*float64{nil, v(1), v(2), v(3), nil}},
+		{"linear over a long gap", fillLinear, 3 * time.Minute,
+			[]*float64{v(0), nil, nil, nil, v(4), nil, v(6)},
+			[]*float64{v(0), nil, nil, nil, v(4), v(5), v(6)}},
+		{"linear at max distance", fillLinear, 4 * time.Minute,
+			[]*float64{v(0), nil, nil, nil, v(4)},
+			[]*float64{v(0), v(1), v(2), v(3), v(4)}},
+	}
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times := make([]time.Time, len(tt.values))
+			for i := range times {
+				times[i] = start.Add(time.Duration(i) * time.Minute)
+			}
+			values := append([]*float64(nil), tt.values...)
+			gapFill{mode: tt.mode, maxDistance: tt.maxDistance}.apply(times, values)
+			for i := range values {
+				got, want := values[i], tt.want[i]
+				if (got == nil) != (want == nil) || (got != nil && math.Abs(*got-*want) > 1e-9) {
+					t.Errorf("window %d = %s, want %s", i, formatOptional(got), formatOptional(want))
+				}
+			}
+		})
+	}
+}
+
+func TestParseGapFill(t *testing.T) {
+	tests := []struct {
+		mode, maxDistance string
+		wantErr           bool
+	}{
+		{"", "", false},
+		{fillLinear, "10m", false},
+		{"cubic", "", true},
+		{fillPrevious, "ten minutes", true},
+	}
+	for _, tt := range tests {
+		if _, err := parseGapFill(tt.mode, tt.maxDistance); (err != nil) != tt.wantErr {
+			t.Errorf("parseGapFill(%q, %q) error = %v, want error %v", tt.mode, tt.maxDistance, err, tt.wantErr)
+		}
+	}
+}
+
+func formatOptional(value *float64) string {
+	if value == nil {
+		return "null"
+	}
+	return strconv.FormatFloat(*value, 'g', -1, 64)
+}
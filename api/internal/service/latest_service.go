@@ -0,0 +1,184 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// latestLookback bounds the InfluxDB last() queries used to warm the latest value cache.
+const latestLookback = 30 * 24 * time.Hour
+
+// latestCache keeps the last known value of every field of every device, keyed by location then device.
+type latestCache struct {
+	mu        sync.RWMutex
+	locations map[string]map[string]*deviceLatest
+}
+
+// deviceLatest is the cached state of a device. Warmed is set once its values were loaded from InfluxDB, before
+// that only the fields written since startup are known.
+type deviceLatest struct {
+	warmed bool
+	fields map[string]models.LatestValue
+}
+
+// device returns the cache entry of a device, creating it. The caller must hold the write lock.
+func (c *latestCache) device(locationID, deviceID string) *deviceLatest {
+	if c.locations == nil {
+		c.locations = make(map[string]map[string]*deviceLatest)
+	}
+	devices, ok := c.locations[locationID]
+	if !ok {
+		devices = make(map[string]*deviceLatest)
+		c.locations[locationID] = devices
+	}
+	d, ok := devices[deviceID]
+	if !ok {
+		d = &deviceLatest{fields: make(map[string]models.LatestValue)}
+		devices[deviceID] = d
+	}
+	return d
+}
+
+// update records a value unless a more recent one is already known.
+func (c *latestCache) update(locationID, deviceID, field string, value models.LatestValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := c.device(locationID, deviceID)
+	if current, ok := d.fields[field]; !ok || !value.Time.Before(current.Time) {
+		d.fields[field] = value
+	}
+}
+
+// warm merges the values loaded from InfluxDB for the given devices and marks them as warmed.
+func (c *latestCache) warm(locationID string, deviceIDs []string, loaded map[string]map[string]models.LatestValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, deviceID := range deviceIDs {
+		c.device(locationID, deviceID).warmed = true
+	}
+	for deviceID, fields := range loaded {
+		d := c.device(locationID, deviceID)
+		d.warmed = true
+		for field, value := range fields {
+			if current, ok := d.fields[field]; !ok || value.Time.After(current.Time) {
+				d.fields[field] = value
+			}
+		}
+	}
+}
+
+// invalidate forgets the values of a device, e.g. after its history was rewritten.
+func (c *latestCache) invalidate(locationID, deviceID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.locations[locationID], deviceID)
+}
+
+// get returns a copy of the values of the warmed devices and the devices that still need warming.
+func (c *latestCache) get(locationID string, deviceIDs []string) (map[string]map[string]models.LatestValue, []string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	values := make(map[string]map[string]models.LatestValue)
+	var missing []string
+	for _, deviceID := range deviceIDs {
+		d, ok := c.locations[locationID][deviceID]
+		if !ok || !d.warmed {
+			missing = append(missing, deviceID)
+			continue
+		}
+		fields := make(map[string]models.LatestValue, len(d.fields))
+		for field, value := range d.fields {
+			fields[field] = value
+		}
+		values[deviceID] = fields
+	}
+	return values, missing
+}
+
+// WarmLatestCache loads the latest value of every field of every device of every location.
+func (s *DataService) WarmLatestCache(ctx context.Context) error {
+	buckets, err := s.repo.ListBuckets(ctx)
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		loaded, err := s.repo.QueryLatestValues(ctx, bucket, nil, latestLookback)
+		if err != nil {
+			return fmt.Errorf("error loading latest values of '%s': %w", bucket, err)
+		}
+		s.latest.warm(bucket, nil, loaded)
+	}
+	log.Printf("Latest value cache warmed from %d buckets", len(buckets))
+	return nil
+}
+
+// GetLatest returns the most recent reading of the fields of the requested devices, loading the devices missing from
+// the cache from InfluxDB.
+func (s *DataService) GetLatest(ctx context.Context, req models.LatestRequest) ([]models.DeviceLatest, error) {
+	values, missing := s.latest.get(req.LocationID, req.DeviceIDs)
+	if len(missing) > 0 {
+		loaded, err := s.repo.QueryLatestValues(ctx, req.LocationID, missing, latestLookback)
+		if err != nil {
+			return nil, fmt.Errorf("error loading latest values: %w", err)
+		}
+		s.latest.warm(req.LocationID, missing, loaded)
+		values, _ = s.latest.get(req.LocationID, req.DeviceIDs)
+	}
+
+	wanted := make(map[string]bool)
+	for _, field := range req.SensorType {
+		wanted[field] = true
+	}
+
+	present := make(map[string]bool)
+	for _, fields := range values {
+		for field := range fields {
+			if len(wanted) > 0 && !wanted[field] {
+				delete(fields, field)
+				continue
+			}
+			present[field] = true
+		}
+	}
+	outputUnits, err := s.units.OutputUnits(sortedKeys(present), req.Units)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := []models.DeviceLatest{}
+	for _, deviceID := range req.DeviceIDs {
+		fields := values[deviceID]
+		if len(fields) == 0 {
+			continue
+		}
+		units := make(map[string]string)
+		for field, value := range fields {
+			unit := outputUnits[field]
+			if unit == "" {
+				continue
+			}
+			units[field] = unit
+			if unit == s.units.CanonicalUnit(field) {
+				continue
+			}
+			converted, err := s.units.FromCanonical(field, unit, value.Value)
+			if err != nil {
+				return nil, err
+			}
+			value.Value = converted
+			fields[field] = value
+		}
+		latest = append(latest, models.DeviceLatest{DeviceID: deviceID, Fields: fields, Units: units})
+	}
+	return latest, nil
+}
+
+// RecentDevices returns the devices of a location with sensor data within the latest value lookback period.
+func (s *DataService) RecentDevices(ctx context.Context, locationID string) ([]string, error) {
+	now := time.Now()
+	return s.repo.ListDevices(ctx, locationID, "sensor_data", now.Add(-latestLookback), now)
+}
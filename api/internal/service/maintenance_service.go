@@ -0,0 +1,136 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Defaults of the maintenance forecast.
+const (
+	defaultMaintenanceHorizon  = 30 * 24 * time.Hour
+	defaultMaintenanceLookback = 7 * 24 * time.Hour
+	// maxProjectionHours keeps projected dates within time.Duration; slower components are reported as not running.
+	maxProjectionHours = 100 * 365 * 24
+)
+
+// SaveRunningHours stores the running hours counter of a device component in the location bucket.
+func (s *DataService) SaveRunningHours(ctx context.Context, locationID string, req models.RunningHoursReq) error {
+	if req.DeviceID == "" || req.ComponentID == "" {
+		return models.NewAPIError(models.ErrorCodeMissingParameter, "device_id and component_id are required", nil, http.StatusBadRequest)
+	}
+	if req.RunningHours < 0 || (req.MaxRunningHours != nil && *req.MaxRunningHours <= 0) {
+		return models.NewAPIError(models.ErrorCodeValidationFailed, "running_hours must not be negative and max_running_hours must be positive", nil, http.StatusBadRequest)
+	}
+
+	if err := s.ensureLocationBucket(ctx, locationID); err != nil {
+		return err
+	}
+	if err := s.repo.WriteRunningHours(ctx, locationID, req); err != nil {
+		return err
+	}
+
+	s.alerts.Evaluate(models.MetricPoint{
+		Source:     models.SourceSensor,
+		LocationID: locationID,
+		DeviceID:   req.DeviceID,
+		Field:      "running_hours",
+		Value:      req.RunningHours,
+		Time:       readingTime(req.Timestamp),
+	})
+	return nil
+}
+
+// GetMaintenanceForecast projects, for every component of the requested devices of a location with a known maximum
+// running hours, when it will reach that maximum at its recent usage rate.
+func (s *DataService) GetMaintenanceForecast(ctx context.Context, req models.MaintenanceRequest) (models.MaintenanceResponse, error) {
+	horizon, err := parseOptionalDuration("horizon", req.Horizon, defaultMaintenanceHorizon)
+	if err != nil {
+		return models.MaintenanceResponse{}, err
+	}
+	lookback, err := parseOptionalDuration("lookback", req.Lookback, defaultMaintenanceLookback)
+	if err != nil {
+		return models.MaintenanceResponse{}, err
+	}
+
+	now := time.Now()
+	usage, err := s.repo.QueryComponentUsage(ctx, req.LocationID, req.DeviceIDs, now.Add(-lookback), now)
+	if err != nil {
+		return models.MaintenanceResponse{}, fmt.Errorf("error querying running hours: %w", err)
+	}
+
+	forecasts := []models.MaintenanceForecast{}
+	for _, u := range usage {
+		if u.MaxRunningHours == nil {
+			continue
+		}
+		f := forecastMaintenance(u, now, horizon)
+		if f.DueWithin || req.IncludeAll {
+			forecasts = append(forecasts, f)
+		}
+	}
+
+	// Soonest first, components that are not running last
+	sort.Slice(forecasts, func(i, j int) bool {
+		a, b := forecasts[i].ProjectedDueAt, forecasts[j].ProjectedDueAt
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.Before(*b)
+	})
+	return models.MaintenanceResponse{LocationID: req.LocationID, Horizon: horizon.String(), Components: forecasts}, nil
+}
+
+// ComponentDevices returns the devices of a location with running hours within the lookback period of a maintenance
+// forecast.
+func (s *DataService) ComponentDevices(ctx context.Context, locationID, rawLookback string) ([]string, error) {
+	lookback, err := parseOptionalDuration("lookback", rawLookback, defaultMaintenanceLookback)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return s.repo.ListDevices(ctx, locationID, "running_hours", now.Add(-lookback), now)
+}
+
+// forecastMaintenance projects the due date of a component from its usage over the lookback period.
+func forecastMaintenance(u models.ComponentUsage, now time.Time, horizon time.Duration) models.MaintenanceForecast {
+	f := models.MaintenanceForecast{
+		DeviceID:        u.DeviceID,
+		ComponentID:     u.ComponentID,
+		RunningHours:    u.LastHours,
+		MaxRunningHours: *u.MaxRunningHours,
+		RemainingHours:  *u.MaxRunningHours - u.LastHours,
+		LastUpdate:      u.LastTime,
+	}
+
+	if elapsed := u.LastTime.Sub(u.FirstTime).Hours(); elapsed > 0 {
+		f.UsageRate = u.Increase / elapsed
+	}
+
+	switch {
+	case f.RemainingHours <= 0:
+		f.Overdue = true
+		due := u.LastTime
+		f.ProjectedDueAt = &due
+	case f.UsageRate > 0 && f.RemainingHours/f.UsageRate < maxProjectionHours:
+		due := u.LastTime.Add(time.Duration(f.RemainingHours / f.UsageRate * float64(time.Hour)))
+		f.ProjectedDueAt = &due
+	}
+	f.DueWithin = f.ProjectedDueAt != nil && f.ProjectedDueAt.Before(now.Add(horizon))
+	return f
+}
+
+// parseOptionalDuration parses a duration parameter, returning fallback when it is empty.
+func parseOptionalDuration(name, raw string, fallback time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, models.NewAPIError(models.ErrorCodeInvalidFormat, fmt.Sprintf("%s must be a positive duration, e.g. '720h'", name), nil, http.StatusBadRequest)
+	}
+	return d, nil
+}
@@ -0,0 +1,560 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/repository"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Settings document kinds of the notification subsystem.
+const (
+	webhookDocumentKind    = "webhook"
+	deadLetterDocumentKind = "dead_letter"
+)
+
+// Headers sent with every webhook request. The signature is the hex HMAC-SHA256 of "<timestamp>.<body>"
+// keyed with the webhook secret.
+const (
+	SignatureHeader = "X-CapIoT-Signature"
+	TimestampHeader = "X-CapIoT-Timestamp"
+)
+
+// maxBackoff caps the delay between two delivery attempts.
+const maxBackoff = time.Minute
+
+// errBlockedAddress is returned when a webhook resolves to an address of the internal network.
+var errBlockedAddress = errors.New("webhook address is not allowed: loopback, private and link-local addresses are blocked")
+
+// NewWebhookClient returns an HTTP client for webhook deliveries that refuses to connect to loopback, private,
+// link-local and unspecified addresses, so that webhooks cannot be used to probe the internal network. The address
+// is checked when dialing, after name resolution and for every redirect. timeout bounds each delivery attempt.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return errBlockedAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No proxy: the proxy address would be checked instead of the receiver's
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// blockedIP reports whether a webhook may not connect to ip.
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// NotificationService delivers alert events to the webhooks of their location.
+// The HTTP client's timeout bounds each delivery attempt.
+type NotificationService struct {
+	repo        repository.Repository
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+
+	mu          sync.Mutex
+	webhooks    map[string]models.Webhook
+	deadLetters map[string]models.DeadLetter
+	lastSent    map[string]time.Time           // keyed by "webhookID|ruleID|deviceID"
+	pending     map[string][]models.AlertEvent // events waiting for their group window, keyed by "webhookID|ruleID"
+}
+
+// NewNotificationService creates a dispatcher making up to maxAttempts delivery attempts per notification,
+// waiting backoff after the first failure and doubling the wait after each further one.
+func NewNotificationService(repo repository.Repository, client *http.Client, maxAttempts int, backoff time.Duration) *NotificationService {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &NotificationService{
+		repo:        repo,
+		client:      client,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		webhooks:    make(map[string]models.Webhook),
+		deadLetters: make(map[string]models.DeadLetter),
+		lastSent:    make(map[string]time.Time),
+		pending:     make(map[string][]models.AlertEvent),
+	}
+}
+
+// Load loads the stored webhooks and dead letters into memory.
+func (s *NotificationService) Load(ctx context.Context) error {
+	webhooks := make(map[string]models.Webhook)
+	deadLetters := make(map[string]models.DeadLetter)
+	if err := loadDocuments(ctx, s.repo, webhookDocumentKind, webhooks); err != nil {
+		return err
+	}
+	if err := loadDocuments(ctx, s.repo, deadLetterDocumentKind, deadLetters); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.webhooks = webhooks
+	s.deadLetters = deadLetters
+	s.mu.Unlock()
+	log.Printf("Loaded %d webhooks and %d dead letters", len(webhooks), len(deadLetters))
+	return nil
+}
+
+// ListWebhooks returns the webhooks of a location, without their secrets.
+func (s *NotificationService) ListWebhooks(locationID string) []models.Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhooks := []models.Webhook{}
+	for _, webhook := range s.webhooks {
+		if webhook.LocationID == locationID {
+			webhooks = append(webhooks, redactWebhook(webhook))
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].Name < webhooks[j].Name })
+	return webhooks
+}
+
+// CreateWebhook validates and stores a new webhook for a location.
+func (s *NotificationService) CreateWebhook(ctx context.Context, locationID string, webhook models.Webhook) (models.Webhook, error) {
+	webhook.ID = newID()
+	webhook.LocationID = locationID
+	if err := validateWebhook(&webhook); err != nil {
+		return models.Webhook{}, err
+	}
+	if err := saveDocument(ctx, s.repo, webhookDocumentKind, webhook.ID, webhook); err != nil {
+		return models.Webhook{}, err
+	}
+
+	s.mu.Lock()
+	s.webhooks[webhook.ID] = webhook
+	s.mu.Unlock()
+	return redactWebhook(webhook), nil
+}
+
+// UpdateWebhook replaces a webhook of a location. An empty secret keeps the current one.
+func (s *NotificationService) UpdateWebhook(ctx context.Context, locationID, webhookID string, webhook models.Webhook) (models.Webhook, error) {
+	current, err := s.getWebhook(locationID, webhookID)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	webhook.ID = webhookID
+	webhook.LocationID = locationID
+	if webhook.Secret == "" {
+		webhook.Secret = current.Secret
+	}
+	if err := validateWebhook(&webhook); err != nil {
+		return models.Webhook{}, err
+	}
+	if err := saveDocument(ctx, s.repo, webhookDocumentKind, webhook.ID, webhook); err != nil {
+		return models.Webhook{}, err
+	}
+
+	s.mu.Lock()
+	s.webhooks[webhook.ID] = webhook
+	s.mu.Unlock()
+	return redactWebhook(webhook), nil
+}
+
+// DeleteWebhook removes a webhook of a location.
+func (s *NotificationService) DeleteWebhook(ctx context.Context, locationID, webhookID string) error {
+	if _, err := s.getWebhook(locationID, webhookID); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteDocument(ctx, webhookDocumentKind, webhookID); err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+
+	s.mu.Lock()
+	delete(s.webhooks, webhookID)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *NotificationService) getWebhook(locationID, webhookID string) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[webhookID]
+	if !ok || webhook.LocationID != locationID {
+		return models.Webhook{}, models.NewAPIError(models.ErrorCodeResourceNotFound, fmt.Sprintf("webhook '%s' not found", webhookID), nil, http.StatusNotFound)
+	}
+	return webhook, nil
+}
+
+// TestWebhook sends a synthetic alert event to a webhook once and reports the outcome.
+func (s *NotificationService) TestWebhook(ctx context.Context, locationID, webhookID string) (models.DeliveryResult, error) {
+	webhook, err := s.getWebhook(locationID, webhookID)
+	if err != nil {
+		return models.DeliveryResult{}, err
+	}
+
+	value := 42.0
+	event := models.AlertEvent{
+		Time:       time.Now().UTC(),
+		RuleID:     "test",
+		RuleName:   "Test notification",
+		RuleType:   models.RuleTypeThreshold,
+		LocationID: locationID,
+		DeviceID:   "test-device",
+		Field:      "temperature",
+		State:      models.AlertStateFiring,
+		Severity:   "info",
+		Value:      &value,
+		Message:    fmt.Sprintf("Test notification for webhook '%s'", webhook.Name),
+	}
+
+	result := models.DeliveryResult{WebhookID: webhookID, Attempts: 1}
+	status, err := s.send(ctx, webhook, []models.AlertEvent{event}, true)
+	result.StatusCode = status
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Delivered = true
+	return result, nil
+}
+
+// Notify routes an alert event to the matching webhooks, applying each webhook's throttling and grouping.
+// Delivery happens in the background.
+func (s *NotificationService) Notify(event models.AlertEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, webhook := range s.webhooks {
+		if !webhookMatches(webhook, event) {
+			continue
+		}
+
+		// Resolutions always go through so that receivers never keep a stale firing alert.
+		throttleKey := webhook.ID + "|" + event.RuleID + "|" + event.DeviceID
+		if throttle, _ := time.ParseDuration(webhook.Throttle); throttle > 0 && event.State == models.AlertStateFiring {
+			if last, ok := s.lastSent[throttleKey]; ok && event.Time.Sub(last) < throttle {
+				log.Printf("Notification of rule %s to webhook %s throttled", event.RuleID, webhook.ID)
+				continue
+			}
+			s.lastSent[throttleKey] = event.Time
+		}
+
+		window, _ := time.ParseDuration(webhook.GroupWindow)
+		if window <= 0 {
+			go s.deliver(context.Background(), webhook, []models.AlertEvent{event})
+			continue
+		}
+
+		groupKey := webhook.ID + "|" + event.RuleID
+		if _, waiting := s.pending[groupKey]; !waiting {
+			webhookID := webhook.ID
+			time.AfterFunc(window, func() { s.flushGroup(webhookID, groupKey) })
+		}
+		s.pending[groupKey] = append(s.pending[groupKey], event)
+	}
+}
+
+// flushGroup delivers the events collected for a webhook and rule during the group window.
+func (s *NotificationService) flushGroup(webhookID, groupKey string) {
+	s.mu.Lock()
+	events := s.pending[groupKey]
+	delete(s.pending, groupKey)
+	webhook, ok := s.webhooks[webhookID]
+	s.mu.Unlock()
+
+	if ok && len(events) > 0 {
+		s.deliver(context.Background(), webhook, events)
+	}
+}
+
+// deliver sends events to a webhook with exponential backoff and stores them as a dead letter when every attempt
+// fails, the receiver rejects them or ctx is cancelled.
+func (s *NotificationService) deliver(ctx context.Context, webhook models.Webhook, events []models.AlertEvent) models.DeliveryResult {
+	result := models.DeliveryResult{WebhookID: webhook.ID}
+	wait := s.backoff
+
+	var lastErr error
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		result.Attempts = attempt
+		status, err := s.send(ctx, webhook, events, false)
+		result.StatusCode = status
+		if err == nil {
+			result.Delivered = true
+			return result
+		}
+		lastErr = err
+		log.Printf("Webhook %s delivery attempt %d/%d failed: %v", webhook.ID, attempt, s.maxAttempts, err)
+
+		if !retryable(status) || attempt == s.maxAttempts {
+			break
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			lastErr = ctx.Err()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wait *= 2
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+	}
+
+	result.Error = lastErr.Error()
+	s.storeDeadLetter(models.DeadLetter{
+		ID:         newID(),
+		WebhookID:  webhook.ID,
+		LocationID: webhook.LocationID,
+		Events:     events,
+		Attempts:   result.Attempts,
+		LastError:  result.Error,
+		FailedAt:   time.Now().UTC(),
+	})
+	return result
+}
+
+// retryable reports whether a failed delivery may succeed later: network errors (status 0), throttling and
+// server errors.
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// send makes one signed delivery attempt and returns the receiver's status code (0 when no response was received).
+func (s *NotificationService) send(ctx context.Context, webhook models.Webhook, events []models.AlertEvent, test bool) (int, error) {
+	body, err := formatPayload(webhook, events, test)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	if webhook.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+SignPayload(webhook.Secret, timestamp, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignPayload returns the hex HMAC-SHA256 of "<timestamp>.<body>", as sent in the signature header.
+func SignPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// formatPayload renders events in the webhook's format.
+func formatPayload(webhook models.Webhook, events []models.AlertEvent, test bool) ([]byte, error) {
+	switch webhook.Format {
+	case models.WebhookFormatSlack:
+		lines := make([]string, len(events))
+		for i, e := range events {
+			lines[i] = fmt.Sprintf("%s *[%s] %s* — %s (device `%s`)", stateEmoji(e.State), strings.ToUpper(e.Severity), e.RuleName, e.Message, e.DeviceID)
+		}
+		return json.Marshal(map[string]string{"text": strings.Join(lines, "\n")})
+
+	case models.WebhookFormatTeams:
+		lines := make([]string, len(events))
+		for i, e := range events {
+			lines[i] = fmt.Sprintf("**%s** (%s, device %s): %s", e.RuleName, e.State, e.DeviceID, e.Message)
+		}
+		color := "2DC72D"
+		for _, e := range events {
+			if e.State == models.AlertStateFiring {
+				color = "E81123"
+			}
+		}
+		return json.Marshal(map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "http://schema.org/extensions",
+			"summary":    fmt.Sprintf("%d alert event(s)", len(events)),
+			"themeColor": color,
+			"title":      fmt.Sprintf("CapIoT alerts — %s", webhook.Name),
+			"text":       strings.Join(lines, "\n\n"),
+		})
+
+	default:
+		return json.Marshal(models.WebhookPayload{WebhookID: webhook.ID, Test: test, Events: events})
+	}
+}
+
+func stateEmoji(state string) string {
+	if state == models.AlertStateFiring {
+		return ":red_circle:"
+	}
+	return ":large_green_circle:"
+}
+
+// storeDeadLetter keeps an undeliverable notification for later inspection or replay.
+func (s *NotificationService) storeDeadLetter(letter models.DeadLetter) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertWriteTimeout)
+	defer cancel()
+	if err := saveDocument(ctx, s.repo, deadLetterDocumentKind, letter.ID, letter); err != nil {
+		log.Printf("Error storing dead letter for webhook %s: %v", letter.WebhookID, err)
+	}
+
+	s.mu.Lock()
+	s.deadLetters[letter.ID] = letter
+	s.mu.Unlock()
+}
+
+// ListDeadLetters returns the undelivered notifications of a location, most recent first.
+func (s *NotificationService) ListDeadLetters(locationID string) []models.DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters := []models.DeadLetter{}
+	for _, letter := range s.deadLetters {
+		if letter.LocationID == locationID {
+			letters = append(letters, letter)
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i].FailedAt.After(letters[j].FailedAt) })
+	return letters
+}
+
+// RetryDeadLetter removes a dead letter and redelivers it to its webhook in the background, with the usual retries.
+// If the delivery fails again, a new dead letter replaces it.
+func (s *NotificationService) RetryDeadLetter(ctx context.Context, locationID, letterID string) (models.DeliveryResult, error) {
+	letter, err := s.getDeadLetter(locationID, letterID)
+	if err != nil {
+		return models.DeliveryResult{}, err
+	}
+	webhook, err := s.getWebhook(locationID, letter.WebhookID)
+	if err != nil {
+		return models.DeliveryResult{}, err
+	}
+	if err := s.DeleteDeadLetter(ctx, locationID, letterID); err != nil {
+		return models.DeliveryResult{}, err
+	}
+	go s.deliver(context.Background(), webhook, letter.Events)
+	return models.DeliveryResult{WebhookID: webhook.ID, Queued: true}, nil
+}
+
+// DeleteDeadLetter discards a dead letter.
+func (s *NotificationService) DeleteDeadLetter(ctx context.Context, locationID, letterID string) error {
+	if _, err := s.getDeadLetter(locationID, letterID); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteDocument(ctx, deadLetterDocumentKind, letterID); err != nil {
+		return fmt.Errorf("error deleting dead letter: %w", err)
+	}
+
+	s.mu.Lock()
+	delete(s.deadLetters, letterID)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *NotificationService) getDeadLetter(locationID, letterID string) (models.DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letter, ok := s.deadLetters[letterID]
+	if !ok || letter.LocationID != locationID {
+		return models.DeadLetter{}, models.NewAPIError(models.ErrorCodeResourceNotFound, fmt.Sprintf("dead letter '%s' not found", letterID), nil, http.StatusNotFound)
+	}
+	return letter, nil
+}
+
+// webhookMatches reports whether a webhook subscribes to an event.
+func webhookMatches(webhook models.Webhook, event models.AlertEvent) bool {
+	if !webhook.Enabled || webhook.LocationID != event.LocationID {
+		return false
+	}
+	if len(webhook.RuleIDs) == 0 {
+		return true
+	}
+	for _, id := range webhook.RuleIDs {
+		if id == event.RuleID {
+			return true
+		}
+	}
+	return false
+}
+
+func redactWebhook(webhook models.Webhook) models.Webhook {
+	webhook.Secret = ""
+	return webhook
+}
+
+// validateWebhook checks a webhook and fills its defaults.
+func validateWebhook(webhook *models.Webhook) error {
+	invalid := func(message string) error {
+		return models.NewAPIError(models.ErrorCodeValidationFailed, message, nil, http.StatusBadRequest)
+	}
+
+	if webhook.Name == "" {
+		return invalid("name is required")
+	}
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return invalid("url must be an absolute http(s) URL")
+	}
+	// Names are checked again when dialing, this only rejects obvious internal targets early
+	if ip := net.ParseIP(u.Hostname()); (ip != nil && blockedIP(ip)) || strings.EqualFold(u.Hostname(), "localhost") {
+		return invalid("url must not point to a loopback, private or link-local address")
+	}
+	if webhook.Format == "" {
+		webhook.Format = models.WebhookFormatJSON
+	}
+	if webhook.Format != models.WebhookFormatJSON && webhook.Format != models.WebhookFormatSlack && webhook.Format != models.WebhookFormatTeams {
+		return invalid("format must be 'json', 'slack' or 'teams'")
+	}
+	for name, raw := range map[string]string{"throttle": webhook.Throttle, "group_window": webhook.GroupWindow} {
+		if raw == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(raw); err != nil || d < 0 {
+			return invalid(fmt.Sprintf("%s must be a duration, e.g. '10m'", name))
+		}
+	}
+	return nil
+}
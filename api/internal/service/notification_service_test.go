@@ -0,0 +1,219 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/repository"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// documentRepo keeps the settings documents in memory; the other repository methods are not used by the tests.
+type documentRepo struct {
+	repository.Repository
+
+	mu        sync.Mutex
+	documents map[string][]byte
+}
+
+func (r *documentRepo) SaveDocument(_ context.Context, kind, id string, document []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.documents == nil {
+		r.documents = make(map[string][]byte)
+	}
+	r.documents[kind+"/"+id] = document
+	return nil
+}
+
+func (r *documentRepo) DeleteDocument(_ context.Context, kind, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.documents, kind+"/"+id)
+	return nil
+}
+
+// newTestWebhook registers a webhook of location "loc" targeting url. It bypasses validation, which rejects the
+// loopback address of the test servers.
+func newTestWebhook(t *testing.T, s *NotificationService, url string, webhook models.Webhook) models.Webhook {
+	t.Helper()
+	webhook.ID = newID()
+	webhook.LocationID = "loc"
+	webhook.Name = "test"
+	webhook.URL = url
+	webhook.Format = models.WebhookFormatJSON
+	webhook.Enabled = true
+	s.mu.Lock()
+	s.webhooks[webhook.ID] = webhook
+	s.mu.Unlock()
+	return webhook
+}
+
+func testEvent(state string, at time.Time) models.AlertEvent {
+	return models.AlertEvent{Time: at, RuleID: "rule", LocationID: "loc", DeviceID: "dev", State: state, Message: "test"}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	const secret = "s3cret"
+	type received struct {
+		signature, timestamp string
+		body                 []byte
+	}
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{r.Header.Get(SignatureHeader), r.Header.Get(TimestampHeader), body}
+	}))
+	defer server.Close()
+
+	s := NewNotificationService(&documentRepo{}, server.Client(), 1, time.Millisecond)
+	webhook := newTestWebhook(t, s, server.URL, models.Webhook{Secret: secret})
+
+	result, err := s.TestWebhook(context.Background(), "loc", webhook.ID)
+	if err != nil || !result.Delivered {
+		t.Fatalf("TestWebhook = %+v, %v; want delivered", result, err)
+	}
+	got := <-requests
+	if got.timestamp == "" {
+		t.Fatalf("missing %s header", TimestampHeader)
+	}
+	if want := "sha256=" + SignPayload(secret, got.timestamp, got.body); got.signature != want {
+		t.Errorf("signature = %q, want %q", got.signature, want)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		statuses      []int // Answered in turn, the last one repeated
+		wantDelivered bool
+		wantAttempts  int
+		wantDead      int
+	}{
+		{"success", []int{http.StatusOK}, true, 1, 0},
+		{"retry then success", []int{http.StatusServiceUnavailable, http.StatusOK}, true, 2, 0},
+		{"retry then dead letter", []int{http.StatusInternalServerError}, false, 3, 1},
+		{"rejected without retry", []int{http.StatusBadRequest}, false, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&calls, 1))
+				if n > len(tt.statuses) {
+					n = len(tt.statuses)
+				}
+				w.WriteHeader(tt.statuses[n-1])
+			}))
+			defer server.Close()
+
+			s := NewNotificationService(&documentRepo{}, server.Client(), 3, time.Millisecond)
+			webhook := newTestWebhook(t, s, server.URL, models.Webhook{})
+
+			result := s.deliver(context.Background(), webhook, []models.AlertEvent{testEvent(models.AlertStateFiring, time.Now())})
+			if result.Delivered != tt.wantDelivered || result.Attempts != tt.wantAttempts {
+				t.Errorf("deliver = %+v, want delivered %v after %d attempts", result, tt.wantDelivered, tt.wantAttempts)
+			}
+			if got := int(atomic.LoadInt32(&calls)); got != tt.wantAttempts {
+				t.Errorf("receiver got %d requests, want %d", got, tt.wantAttempts)
+			}
+			letters := s.ListDeadLetters("loc")
+			if len(letters) != tt.wantDead {
+				t.Fatalf("%d dead letters, want %d", len(letters), tt.wantDead)
+			}
+			if tt.wantDead > 0 && letters[0].Attempts != tt.wantAttempts {
+				t.Errorf("dead letter attempts = %d, want %d", letters[0].Attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestDeliverStopsWhenCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	s := NewNotificationService(&documentRepo{}, server.Client(), 5, time.Hour)
+	webhook := newTestWebhook(t, s, server.URL, models.Webhook{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result := s.deliver(ctx, webhook, []models.AlertEvent{testEvent(models.AlertStateFiring, time.Now())})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("deliver took %s after cancellation", elapsed)
+	}
+	if result.Delivered || result.Attempts != 1 {
+		t.Errorf("deliver = %+v, want one failed attempt", result)
+	}
+	if len(s.ListDeadLetters("loc")) != 1 {
+		t.Errorf("the cancelled delivery must be dead-lettered")
+	}
+}
+
+func TestNotifyThrottle(t *testing.T) {
+	received := make(chan models.WebhookPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload models.WebhookPayload
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		received <- payload
+	}))
+	defer server.Close()
+
+	s := NewNotificationService(&documentRepo{}, server.Client(), 1, time.Millisecond)
+	newTestWebhook(t, s, server.URL, models.Webhook{Throttle: "10m"})
+
+	now := time.Now()
+	s.Notify(testEvent(models.AlertStateFiring, now))
+	s.Notify(testEvent(models.AlertStateFiring, now.Add(time.Minute)))     // Throttled
+	s.Notify(testEvent(models.AlertStateResolved, now.Add(2*time.Minute))) // Resolutions are never throttled
+	s.Notify(testEvent(models.AlertStateFiring, now.Add(11*time.Minute)))  // Throttle elapsed
+
+	states := make(map[string]int)
+	for i := 0; i < 3; i++ {
+		select {
+		case payload := <-received:
+			for _, event := range payload.Events {
+				states[event.State]++
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d notifications received, want 3", i)
+		}
+	}
+	select {
+	case payload := <-received:
+		t.Fatalf("unexpected notification %+v", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if states[models.AlertStateFiring] != 2 || states[models.AlertStateResolved] != 1 {
+		t.Errorf("received %v, want 2 firing and 1 resolved", states)
+	}
+}
+
+func TestWebhookClientBlocksInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	resp, err := NewWebhookClient(time.Second).Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("request to loopback %s succeeded, want it blocked", server.URL)
+	}
+
+	for _, raw := range []string{"http://127.0.0.1/hook", "http://10.0.0.5/hook", "http://169.254.169.254/latest", "http://[::1]/hook", "http://localhost:8086"} {
+		webhook := models.Webhook{Name: "internal", URL: raw}
+		if err := validateWebhook(&webhook); err == nil {
+			t.Errorf("validateWebhook(%s) accepted an internal address", raw)
+		}
+	}
+}
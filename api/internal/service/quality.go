@@ -0,0 +1,125 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"math"
+	"sync"
+	"time"
+)
+
+// defaultFieldLimits are the physically possible ranges of the fields written by the devices, in canonical units.
+var defaultFieldLimits = map[string]models.ValueRange{
+	"temperature": {Min: -60, Max: 150},
+	"humidity":    {Min: 0, Max: 100},
+	"voltage":     {Min: 0, Max: 1000},
+	"current":     {Min: 0, Max: 1000},
+	"power":       {Min: 0, Max: 1e6},
+}
+
+// defaultFieldMaxRates are the largest plausible rates of change of the fields, in canonical units per second.
+var defaultFieldMaxRates = map[string]float64{
+	"temperature": 1,
+	"humidity":    5,
+}
+
+// flatlineEpsilon is the tolerance under which two consecutive values are considered identical.
+const flatlineEpsilon = 1e-9
+
+// QualityMonitor keeps the last values of every series and flags incoming points that look wrong.
+type QualityMonitor struct {
+	window   int
+	limits   map[string]models.ValueRange
+	maxRates map[string]float64
+
+	mu     sync.Mutex
+	series map[string]*seriesHistory
+}
+
+// seriesHistory is a ring buffer of the last values of a series.
+type seriesHistory struct {
+	values []float64
+	times  []time.Time
+	next   int
+	count  int
+}
+
+// NewQualityMonitor creates a monitor flagging a series as stuck after window identical values.
+// limits and maxRates override or extend the defaults per field.
+func NewQualityMonitor(window int, limits map[string]models.ValueRange, maxRates map[string]float64) *QualityMonitor {
+	if window < 2 {
+		window = 2
+	}
+	m := &QualityMonitor{
+		window:   window,
+		limits:   make(map[string]models.ValueRange),
+		maxRates: make(map[string]float64),
+		series:   make(map[string]*seriesHistory),
+	}
+	for field, r := range defaultFieldLimits {
+		m.limits[field] = r
+	}
+	for field, r := range limits {
+		m.limits[field] = r
+	}
+	for field, rate := range defaultFieldMaxRates {
+		m.maxRates[field] = rate
+	}
+	for field, rate := range maxRates {
+		m.maxRates[field] = rate
+	}
+	return m
+}
+
+// Check returns the quality flags of a new value of a series and records it in the series history.
+// Invalid values are not recorded.
+func (m *QualityMonitor) Check(seriesKey, field string, value float64, at time.Time) []string {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return []string{models.QualityFlagInvalid}
+	}
+
+	var flags []string
+	if r, ok := m.limits[field]; ok && (value < r.Min || value > r.Max) {
+		flags = append(flags, models.QualityFlagOutOfRange)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.series[seriesKey]
+	if !ok {
+		h = &seriesHistory{values: make([]float64, m.window), times: make([]time.Time, m.window)}
+		m.series[seriesKey] = h
+	}
+
+	if h.count > 0 {
+		prev := (h.next - 1 + m.window) % m.window
+		if maxRate, ok := m.maxRates[field]; ok && maxRate > 0 {
+			elapsed := at.Sub(h.times[prev]).Seconds()
+			if elapsed > 0 && math.Abs(value-h.values[prev])/elapsed > maxRate {
+				flags = append(flags, models.QualityFlagSpike)
+			}
+		}
+	}
+
+	h.values[h.next] = value
+	h.times[h.next] = at
+	h.next = (h.next + 1) % m.window
+	if h.count < m.window {
+		h.count++
+	}
+
+	if h.count == m.window && h.isFlat() {
+		flags = append(flags, models.QualityFlagFlatline)
+	}
+	return flags
+}
+
+// isFlat reports whether every value in the history is identical.
+func (h *seriesHistory) isFlat() bool {
+	for i := 1; i < h.count; i++ {
+		if math.Abs(h.values[i]-h.values[0]) > flatlineEpsilon {
+			return false
+		}
+	}
+	return true
+}
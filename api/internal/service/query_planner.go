@@ -0,0 +1,140 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"CapIot.influxDB/internal/repository"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// autoWindow is the window_period value asking the planner to pick the window.
+const autoWindow = "auto"
+
+// niceWindows are the windows the planner picks from, smallest first.
+var niceWindows = []struct {
+	flux     string
+	duration time.Duration
+}{
+	{"1s", time.Second},
+	{"5s", 5 * time.Second},
+	{"10s", 10 * time.Second},
+	{"30s", 30 * time.Second},
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"10m", 10 * time.Minute},
+	{"15m", 15 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"1h", time.Hour},
+	{"3h", 3 * time.Hour},
+	{"6h", 6 * time.Hour},
+	{"12h", 12 * time.Hour},
+	{"1d", 24 * time.Hour},
+	{"1w", 7 * 24 * time.Hour},
+	{"1mo", calendarUnits["mo"]},
+}
+
+// calendarUnits are the Flux calendar duration units, with their shortest length used for the point budget.
+var calendarUnits = map[string]time.Duration{
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"mo": 28 * 24 * time.Hour,
+	"y":  365 * 24 * time.Hour,
+}
+
+// calendarWindowPattern matches calendar windows such as "1d", "2w", "1mo" or "1y".
+var calendarWindowPattern = regexp.MustCompile(`^([1-9][0-9]*)(d|w|mo|y)$`)
+
+// parseWindow parses a window period, either a Go duration ("30m") or a calendar window ("1d", "1w", "1mo", "1y").
+func parseWindow(raw string) (time.Duration, bool) {
+	if m := calendarWindowPattern.FindStringSubmatch(raw); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(n) * calendarUnits[m[2]], true
+	}
+	d, err := time.ParseDuration(raw)
+	return d, err == nil && d > 0
+}
+
+// relativeTimePattern matches the negative Flux durations accepted as time bounds, such as "-1h", "-1h30m" or "-1mo".
+var relativeTimePattern = regexp.MustCompile(`^-([0-9]+(ns|us|µs|ms|s|mo|m|h|d|w|y))+$`)
+
+// relativeTimeUnitPattern matches one magnitude and unit of a relative time bound.
+var relativeTimeUnitPattern = regexp.MustCompile(`([0-9]+)(ns|us|µs|ms|s|mo|m|h|d|w|y)`)
+
+// parseTimeBound parses a time range bound: an RFC3339 time, "now()" or a negative Flux duration resolved against
+// now. Like Flux, the months (mo, y) are moved first and clamped to the end of the month, then the days (d, w), then
+// the remaining time. The accepted forms are also valid Flux, so the raw bound can be passed to the query as is.
+func parseTimeBound(raw string, now time.Time) (time.Time, error) {
+	if raw == "now()" {
+		return now, nil
+	}
+	if !relativeTimePattern.MatchString(raw) {
+		return time.Parse(time.RFC3339, raw)
+	}
+	var months, days int
+	var rest time.Duration
+	for _, m := range relativeTimeUnitPattern.FindAllStringSubmatch(raw, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative time %q: %w", raw, err)
+		}
+		switch m[2] {
+		case "y":
+			months += 12 * n
+		case "mo":
+			months += n
+		case "w":
+			days += 7 * n
+		case "d":
+			days += n
+		default:
+			unit, _ := time.ParseDuration("1" + m[2])
+			rest += time.Duration(n) * unit
+		}
+	}
+	return addMonthsClamped(now, -months).AddDate(0, 0, -days).Add(-rest), nil
+}
+
+// planWindow validates an aggregated query against the point budget and returns the window to use. series is the
+// number of series returned (fields times devices), each one yielding a point per window. An empty or "auto" window
+// picks the smallest nice window that fits the budget.
+func planWindow(rawStart, rawStop, rawWindow string, series int) (string, error) {
+	start, stop, err := parseTimeRange(rawStart, rawStop)
+	if err != nil {
+		return "", err
+	}
+	if series < 1 {
+		series = 1
+	}
+	budget := repository.MAX_API_QUERY_POINTS
+	points := func(window time.Duration) float64 {
+		// float64 division prevents overflow from large duration/window values
+		return math.Ceil(float64(stop.Sub(start))/float64(window)) * float64(series)
+	}
+
+	if rawWindow == "" || rawWindow == autoWindow {
+		for _, w := range niceWindows {
+			if points(w.duration) <= float64(budget) {
+				return w.flux, nil
+			}
+		}
+		return "", models.NewAPIError(models.ErrorCodeValidationFailed,
+			fmt.Sprintf("query too broad: no window fits the maximum API limit of %d points for %d series. Please reduce the time range", budget, series), nil, http.StatusBadRequest)
+	}
+
+	window, ok := parseWindow(rawWindow)
+	if !ok {
+		return "", models.NewAPIError(models.ErrorCodeInvalidFormat, "window_period must be a positive duration (e.g., '1h', '30m'), a calendar window ('1d', '1w', '1mo', '1y') or 'auto'", nil, http.StatusBadRequest)
+	}
+	if total := points(window); total > float64(budget) {
+		return "", models.NewAPIError(models.ErrorCodeValidationFailed,
+			fmt.Sprintf("query too broad: requested points %.0f exceeds maximum API limit %d. Please adjust time range or window period", total, budget), nil, http.StatusBadRequest)
+	}
+	return rawWindow, nil
+}
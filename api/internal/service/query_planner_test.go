@@ -0,0 +1,43 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeBound(t *testing.T) {
+	now := time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		raw     string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2024-03-01T00:00:00Z", time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), false},
+		{"now()", now, false},
+		{"-1h", now.Add(-time.Hour), false},
+		{"-1h30m", now.Add(-90 * time.Minute), false},
+		{"-500ms", now.Add(-500 * time.Millisecond), false},
+		{"-7d", time.Date(2024, time.March, 24, 12, 0, 0, 0, time.UTC), false},
+		{"-2w", time.Date(2024, time.March, 17, 12, 0, 0, 0, time.UTC), false},
+		{"-1mo", time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC), false}, // Clamped like Flux
+		{"-1y", time.Date(2023, time.March, 31, 12, 0, 0, 0, time.UTC), false},
+		{"-1y1mo", time.Date(2023, time.February, 28, 12, 0, 0, 0, time.UTC), false},
+		{"-1mo1mo", time.Date(2024, time.January, 31, 12, 0, 0, 0, time.UTC), false}, // Months are summed before clamping
+		{"-1mo2d", time.Date(2024, time.February, 27, 12, 0, 0, 0, time.UTC), false},
+		{"1h", time.Time{}, true},
+		{"-1.5h", time.Time{}, true},
+		{"-1h) |> drop()", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := parseTimeBound(tt.raw, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTimeBound(%q) error = %v, want error %v", tt.raw, err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("parseTimeBound(%q) = %s, want %s", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
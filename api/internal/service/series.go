@@ -0,0 +1,82 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"net/http"
+	"time"
+)
+
+// seriesSelector selects the aggregated series of one field of a device.
+type seriesSelector struct {
+	Source     string // "sensor" or "consumption"
+	LocationID string // Bucket of sensor sources, timezone only of consumption sources
+	DeviceID   string
+	Field      string
+	Window     string
+	Timezone   string
+	Unit       string
+	Fill       string // Empty windows, "null" by default
+}
+
+// fieldSeries runs the aggregated query of a selected field between start and stop and returns its windows with the
+// unit of their values. Empty windows have a nil value.
+func (s *DataService) fieldSeries(ctx context.Context, sel seriesSelector, start, stop time.Time) ([]models.DataPoint, string, error) {
+	rawStart, rawStop := start.Format(time.RFC3339), stop.Format(time.RFC3339)
+	var points []models.DataPoint
+	var unit string
+	switch sel.Source {
+	case models.SourceSensor:
+		data, err := s.GetData(models.QueryRequest{
+			LocationID:     sel.LocationID,
+			DeviceIDs:      []string{sel.DeviceID},
+			SensorType:     []string{sel.Field},
+			TimeRangeStart: rawStart,
+			TimeRangeStop:  rawStop,
+			WindowPeriod:   sel.Window,
+			Timezone:       sel.Timezone,
+			Units:          []string{sel.Unit},
+			Fill:           sel.Fill,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		for _, d := range data {
+			unit = d.Units[sel.Field]
+			for _, reading := range d.Readings[sel.Field] {
+				raw, _ := reading["time"].(string)
+				t, err := time.Parse(time.RFC3339, raw)
+				if err != nil {
+					continue
+				}
+				point := models.DataPoint{Time: t}
+				if value, ok := reading["value"].(float64); ok {
+					point.Value = &value
+				}
+				points = append(points, point)
+			}
+		}
+	case models.SourceConsumption:
+		data, err := s.GetConsumptionData(ctx, models.ConsumptionQueryRequest{
+			DeviceID:       sel.DeviceID,
+			LocationID:     sel.LocationID,
+			Metrics:        []string{sel.Field},
+			TimeRangeStart: rawStart,
+			TimeRangeStop:  rawStop,
+			WindowPeriod:   sel.Window,
+			Timezone:       sel.Timezone,
+			Units:          []string{sel.Unit},
+			Fill:           sel.Fill,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		for _, d := range data {
+			unit = d.Units[sel.Field]
+			points = append(points, d.Readings[sel.Field]...)
+		}
+	default:
+		return nil, "", models.NewAPIError(models.ErrorCodeValidationFailed, "source must be 'sensor' or 'consumption'", nil, http.StatusBadRequest)
+	}
+	return points, unit, nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+)
+
+// Limits of the stats endpoint.
+const (
+	defaultHistogramBins = 10
+	maxHistogramBins     = 1000
+	// maxStatsSamples bounds the raw values held in memory to compute exact percentiles.
+	maxStatsSamples = 2000000
+)
+
+// GetStats computes descriptive statistics and a histogram of each requested field of a device over a time range,
+// from the raw values streamed from InfluxDB.
+func (s *DataService) GetStats(ctx context.Context, req models.StatsRequest) (models.StatsResponse, error) {
+	if req.DeviceID == "" || len(req.Fields) == 0 {
+		return models.StatsResponse{}, models.NewAPIError(models.ErrorCodeMissingParameter, "device_id and at least one field are required", nil, http.StatusBadRequest)
+	}
+	start, stop, err := parseTimeRange(req.TimeRangeStart, req.TimeRangeStop)
+	if err != nil {
+		return models.StatsResponse{}, err
+	}
+	if req.Bins == 0 {
+		req.Bins = defaultHistogramBins
+	}
+	if req.Bins < 1 || req.Bins > maxHistogramBins {
+		return models.StatsResponse{}, models.NewAPIError(models.ErrorCodeValidationFailed, fmt.Sprintf("bins must be between 1 and %d", maxHistogramBins), nil, http.StatusBadRequest)
+	}
+	if req.HistMin != nil && req.HistMax != nil && *req.HistMin >= *req.HistMax {
+		return models.StatsResponse{}, models.NewAPIError(models.ErrorCodeValidationFailed, "hist_min must be lower than hist_max", nil, http.StatusBadRequest)
+	}
+
+	var bucket, measurement string
+	switch req.Source {
+	case models.SourceSensor:
+		if req.LocationID == "" {
+			return models.StatsResponse{}, models.NewAPIError(models.ErrorCodeMissingParameter, "location_id is required", nil, http.StatusBadRequest)
+		}
+		bucket, measurement = req.LocationID, "sensor_data"
+	case models.SourceConsumption:
+		bucket, measurement = "consumption_data", "consumption_data"
+	default:
+		return models.StatsResponse{}, models.NewAPIError(models.ErrorCodeValidationFailed, "source must be 'sensor' or 'consumption'", nil, http.StatusBadRequest)
+	}
+
+	outputUnits, err := s.units.OutputUnits(req.Fields, req.Units)
+	if err != nil {
+		return models.StatsResponse{}, err
+	}
+
+	values := make(map[string][]float64, len(req.Fields))
+	total := 0
+	err = s.repo.StreamFieldValues(ctx, bucket, measurement, req.DeviceID, req.Fields, start, stop, req.ExcludeFlagged, func(field string, value float64) error {
+		if total++; total > maxStatsSamples {
+			return models.NewAPIError(models.ErrorCodeValidationFailed,
+				fmt.Sprintf("query too broad: more than %d values. Please reduce the time range or the number of fields", maxStatsSamples), nil, http.StatusBadRequest)
+		}
+		if unit := outputUnits[field]; unit != "" && unit != s.units.CanonicalUnit(field) {
+			converted, err := s.units.FromCanonical(field, unit, value)
+			if err != nil {
+				return err
+			}
+			value = converted
+		}
+		values[field] = append(values[field], value)
+		return nil
+	})
+	if err != nil {
+		return models.StatsResponse{}, err
+	}
+
+	resp := models.StatsResponse{DeviceID: req.DeviceID, Fields: make([]models.FieldStats, 0, len(req.Fields))}
+	for _, field := range req.Fields {
+		stats := describe(values[field], req.Bins, req.HistMin, req.HistMax)
+		stats.Field = field
+		stats.Unit = outputUnits[field]
+		resp.Fields = append(resp.Fields, stats)
+	}
+	return resp, nil
+}
+
+// describe computes the statistics and histogram of values, which it sorts in place.
+func describe(values []float64, bins int, histMin, histMax *float64) models.FieldStats {
+	stats := models.FieldStats{Count: len(values), Histogram: []models.HistogramBin{}}
+	if len(values) == 0 {
+		return stats
+	}
+	sort.Float64s(values)
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	stddev := math.Sqrt(squares / float64(len(values)))
+
+	minimum, maximum := values[0], values[len(values)-1]
+	median := percentile(values, 50)
+	p5, p95, p99 := percentile(values, 5), percentile(values, 95), percentile(values, 99)
+	stats.Min, stats.Max, stats.Mean, stats.Median, stats.StdDev = &minimum, &maximum, &mean, &median, &stddev
+	stats.P5, stats.P95, stats.P99 = &p5, &p95, &p99
+
+	lower, upper := minimum, maximum
+	if histMin != nil {
+		lower = *histMin
+	}
+	if histMax != nil {
+		upper = *histMax
+	}
+	if upper <= lower {
+		// Every value is identical (or the range is inverted by a single bound), use a single bin
+		stats.Histogram = append(stats.Histogram, models.HistogramBin{Lower: lower, Upper: lower})
+		for _, v := range values {
+			if v == lower {
+				stats.Histogram[0].Count++
+			} else {
+				stats.Outside++
+			}
+		}
+		return stats
+	}
+	width := (upper - lower) / float64(bins)
+	for i := 0; i < bins; i++ {
+		stats.Histogram = append(stats.Histogram, models.HistogramBin{Lower: lower + float64(i)*width, Upper: lower + float64(i+1)*width})
+	}
+	stats.Histogram[bins-1].Upper = upper
+	for _, v := range values {
+		if v < lower || v > upper {
+			stats.Outside++
+			continue
+		}
+		i := int((v - lower) / width)
+		if i >= bins {
+			i = bins - 1
+		}
+		stats.Histogram[i].Count++
+	}
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted values, interpolating linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
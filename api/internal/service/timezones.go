@@ -0,0 +1,59 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TimezoneRegistry resolves the timezone calendar windows align to.
+type TimezoneRegistry struct {
+	defaultZone string
+	locations   map[string]string
+}
+
+// NewTimezoneRegistry creates a TimezoneRegistry with a default IANA timezone and per-location overrides.
+func NewTimezoneRegistry(defaultZone string, locations map[string]string) *TimezoneRegistry {
+	if defaultZone == "" {
+		defaultZone = "UTC"
+	}
+	return &TimezoneRegistry{defaultZone: defaultZone, locations: locations}
+}
+
+// Resolve returns the requested timezone, or else the one configured for the location, or else the default one.
+func (t *TimezoneRegistry) Resolve(requested, locationID string) (string, *time.Location, error) {
+	name := requested
+	if name == "" {
+		name = t.locations[locationID]
+	}
+	if name == "" {
+		name = t.defaultZone
+	}
+	loc, err := models.LoadTimezone(name)
+	if err != nil {
+		return "", nil, models.NewAPIError(models.ErrorCodeValidationFailed, fmt.Sprintf("unknown timezone '%s', expected an IANA name such as 'Europe/Paris'", name), nil, http.StatusBadRequest)
+	}
+	return name, loc, nil
+}
+
+// localizeSensorReadings expresses the window times of sensor readings in the given timezone.
+func localizeSensorReadings(readings map[string][]map[string]interface{}, loc *time.Location) {
+	for _, points := range readings {
+		for _, point := range points {
+			raw, _ := point["time"].(string)
+			if t, err := time.Parse(time.RFC3339, raw); err == nil {
+				point["time"] = t.In(loc).Format(time.RFC3339)
+			}
+		}
+	}
+}
+
+// localizeDataPoints expresses the window times of consumption data points in the given timezone.
+func localizeDataPoints(readings map[string][]models.DataPoint, loc *time.Location) {
+	for _, points := range readings {
+		for i := range points {
+			points[i].Time = points[i].Time.In(loc)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimezoneRegistryResolve(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Paris"); err != nil {
+		t.Skipf("timezone database unavailable: %v", err)
+	}
+	registry := NewTimezoneRegistry("", map[string]string{"site-paris": "Europe/Paris"})
+	tests := []struct {
+		requested, locationID string
+		want                  string
+		wantErr               bool
+	}{
+		{"", "", "UTC", false},
+		{"", "site-paris", "Europe/Paris", false},
+		{"America/New_York", "site-paris", "America/New_York", false},
+		{"Local", "site-paris", "", true},
+		{"Mars/Olympus", "", "", true},
+	}
+	for _, tt := range tests {
+		name, _, err := registry.Resolve(tt.requested, tt.locationID)
+		if (err != nil) != tt.wantErr || name != tt.want {
+			t.Errorf("Resolve(%q, %q) = %q, %v, want %q, error %v", tt.requested, tt.locationID, name, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// knownUnits lists every unit the API can convert. Scale/Offset convert a value to the base unit of the dimension
+// (the unit with Scale 1 and Offset 0).
+var knownUnits = []models.UnitDefinition{
+	// Temperature (base: °C)
+	{Symbol: "C", Dimension: "temperature", Scale: 1, Offset: 0},
+	{Symbol: "F", Dimension: "temperature", Scale: 5.0 / 9.0, Offset: -32 * 5.0 / 9.0},
+	{Symbol: "K", Dimension: "temperature", Scale: 1, Offset: -273.15},
+	// Power (base: W)
+	{Symbol: "W", Dimension: "power", Scale: 1},
+	{Symbol: "mW", Dimension: "power", Scale: 1e-3},
+	{Symbol: "kW", Dimension: "power", Scale: 1e3},
+	{Symbol: "MW", Dimension: "power", Scale: 1e6},
+	// Apparent power (base: VA)
+	{Symbol: "VA", Dimension: "apparent_power", Scale: 1},
+	{Symbol: "kVA", Dimension: "apparent_power", Scale: 1e3},
+	{Symbol: "MVA", Dimension: "apparent_power", Scale: 1e6},
+	// Current (base: A)
+	{Symbol: "A", Dimension: "current", Scale: 1},
+	{Symbol: "mA", Dimension: "current", Scale: 1e-3},
+	{Symbol: "kA", Dimension: "current", Scale: 1e3},
+	// Voltage (base: V)
+	{Symbol: "V", Dimension: "voltage", Scale: 1},
+	{Symbol: "mV", Dimension: "voltage", Scale: 1e-3},
+	{Symbol: "kV", Dimension: "voltage", Scale: 1e3},
+	// Energy (base: Wh)
+	{Symbol: "Wh", Dimension: "energy", Scale: 1},
+	{Symbol: "kWh", Dimension: "energy", Scale: 1e3},
+	{Symbol: "MWh", Dimension: "energy", Scale: 1e6},
+	// Pressure (base: Pa)
+	{Symbol: "Pa", Dimension: "pressure", Scale: 1},
+	{Symbol: "hPa", Dimension: "pressure", Scale: 1e2},
+	{Symbol: "kPa", Dimension: "pressure", Scale: 1e3},
+	{Symbol: "bar", Dimension: "pressure", Scale: 1e5},
+	{Symbol: "psi", Dimension: "pressure", Scale: 6894.757},
+	// Relative humidity
+	{Symbol: "%", Dimension: "humidity", Scale: 1},
+}
+
+// unitAliases maps alternative spellings to the symbols of knownUnits.
+var unitAliases = map[string]string{
+	"°c":         "C",
+	"degc":       "C",
+	"celsius":    "C",
+	"°f":         "F",
+	"degf":       "F",
+	"fahrenheit": "F",
+	"kelvin":     "K",
+	"percent":    "%",
+	"%rh":        "%",
+}
+
+// defaultFieldUnits is the canonical unit of the fields written by the devices.
+var defaultFieldUnits = map[string]string{
+	"temperature":    "C",
+	"humidity":       "%",
+	"current":        "A",
+	"voltage":        "V",
+	"power":          "W",
+	"apparent_power": "VA",
+	"energy":         "Wh",
+}
+
+// UnitRegistry knows the canonical unit of each field and converts values between units of the same dimension.
+type UnitRegistry struct {
+	units  map[string]models.UnitDefinition // keyed by symbol
+	fields map[string]models.FieldUnit
+}
+
+// NewUnitRegistry creates a registry with the default field units, overridden or extended by fieldUnits
+// (field name -> canonical unit symbol). A symbol that is not a known unit is registered as its own dimension,
+// so values are stored as-is and can only be requested in that same unit.
+func NewUnitRegistry(fieldUnits map[string]string) *UnitRegistry {
+	reg := &UnitRegistry{
+		units:  make(map[string]models.UnitDefinition),
+		fields: make(map[string]models.FieldUnit),
+	}
+	for _, u := range knownUnits {
+		reg.units[u.Symbol] = u
+	}
+
+	merged := make(map[string]string, len(defaultFieldUnits)+len(fieldUnits))
+	for field, symbol := range defaultFieldUnits {
+		merged[field] = symbol
+	}
+	for field, symbol := range fieldUnits {
+		merged[field] = symbol
+	}
+
+	for field, symbol := range merged {
+		reg.register(field, symbol)
+	}
+	return reg
+}
+
+// register sets the canonical unit of a field.
+func (u *UnitRegistry) register(field, symbol string) {
+	unit, ok := u.lookup(symbol)
+	if !ok {
+		unit = models.UnitDefinition{Symbol: symbol, Dimension: symbol, Scale: 1}
+		u.units[symbol] = unit
+	}
+	u.fields[field] = models.FieldUnit{Field: field, Dimension: unit.Dimension, CanonicalUnit: unit.Symbol}
+}
+
+// withFields returns a copy of the registry that also knows the canonical units of extra fields, such as the
+// virtual sensors of a query. The registry itself is left unchanged.
+func (u *UnitRegistry) withFields(fieldUnits map[string]string) *UnitRegistry {
+	reg := &UnitRegistry{
+		units:  make(map[string]models.UnitDefinition, len(u.units)),
+		fields: make(map[string]models.FieldUnit, len(u.fields)+len(fieldUnits)),
+	}
+	for symbol, unit := range u.units {
+		reg.units[symbol] = unit
+	}
+	for field, unit := range u.fields {
+		reg.fields[field] = unit
+	}
+	for field, symbol := range fieldUnits {
+		reg.register(field, symbol)
+	}
+	return reg
+}
+
+// lookup finds a unit by exact symbol, then by alias, then case-insensitively as long as the match is unambiguous
+// ("mw" could be mW or MW and is rejected).
+func (u *UnitRegistry) lookup(symbol string) (models.UnitDefinition, bool) {
+	symbol = strings.TrimSpace(symbol)
+	if unit, ok := u.units[symbol]; ok {
+		return unit, true
+	}
+	if alias, ok := unitAliases[strings.ToLower(symbol)]; ok {
+		unit, ok := u.units[alias]
+		return unit, ok
+	}
+
+	var found models.UnitDefinition
+	matches := 0
+	for key, unit := range u.units {
+		if strings.EqualFold(key, symbol) {
+			found = unit
+			matches++
+		}
+	}
+	return found, matches == 1
+}
+
+// CanonicalUnit returns the canonical unit symbol of a field, or "" when the field has no unit definition.
+func (u *UnitRegistry) CanonicalUnit(field string) string {
+	return u.fields[field].CanonicalUnit
+}
+
+// Fields returns the unit definition of every known field.
+func (u *UnitRegistry) Fields() []models.FieldUnit {
+	fields := make([]models.FieldUnit, 0, len(u.fields))
+	for _, f := range u.fields {
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// resolve returns the source unit and the canonical unit of a field, checking both share a dimension.
+func (u *UnitRegistry) resolve(field, symbol string) (models.UnitDefinition, models.UnitDefinition, error) {
+	fieldUnit, ok := u.fields[field]
+	if !ok {
+		return models.UnitDefinition{}, models.UnitDefinition{}, models.NewAPIError(models.ErrorCodeValidationFailed,
+			fmt.Sprintf("field '%s' has no unit definition, unit '%s' cannot be applied", field, symbol), nil, http.StatusBadRequest)
+	}
+	canonical, _ := u.lookup(fieldUnit.CanonicalUnit)
+	unit, ok := u.lookup(symbol)
+	if !ok {
+		return models.UnitDefinition{}, models.UnitDefinition{}, models.NewAPIError(models.ErrorCodeValidationFailed,
+			fmt.Sprintf("unknown unit '%s'", symbol), nil, http.StatusBadRequest)
+	}
+	if unit.Dimension != canonical.Dimension {
+		return models.UnitDefinition{}, models.UnitDefinition{}, models.NewAPIError(models.ErrorCodeValidationFailed,
+			fmt.Sprintf("unit '%s' is not a %s unit (field '%s')", symbol, canonical.Dimension, field), nil, http.StatusBadRequest)
+	}
+	return unit, canonical, nil
+}
+
+// ToCanonical converts a value of field expressed in symbol to the field's canonical unit.
+// An empty symbol means the value is already canonical.
+func (u *UnitRegistry) ToCanonical(field, symbol string, value float64) (float64, error) {
+	if symbol == "" {
+		return value, nil
+	}
+	unit, canonical, err := u.resolve(field, symbol)
+	if err != nil {
+		return 0, err
+	}
+	base := value*unit.Scale + unit.Offset
+	return (base - canonical.Offset) / canonical.Scale, nil
+}
+
+// FromCanonical converts a canonical value of field to the unit symbol.
+func (u *UnitRegistry) FromCanonical(field, symbol string, value float64) (float64, error) {
+	if symbol == "" {
+		return value, nil
+	}
+	unit, canonical, err := u.resolve(field, symbol)
+	if err != nil {
+		return 0, err
+	}
+	base := value*canonical.Scale + canonical.Offset
+	return (base - unit.Offset) / unit.Scale, nil
+}
+
+// OutputUnits matches the requested output units to the queried fields by dimension and returns the unit every
+// field will be reported in. Fields without a requested unit keep their canonical unit.
+// Every requested unit must apply to at least one field.
+func (u *UnitRegistry) OutputUnits(fields []string, requested []string) (map[string]string, error) {
+	out := make(map[string]string, len(fields))
+	for _, field := range fields {
+		if canonical := u.CanonicalUnit(field); canonical != "" {
+			out[field] = canonical
+		}
+	}
+
+	for _, symbol := range requested {
+		if symbol == "" {
+			continue
+		}
+		unit, ok := u.lookup(symbol)
+		if !ok {
+			return nil, models.NewAPIError(models.ErrorCodeValidationFailed, fmt.Sprintf("unknown unit '%s'", symbol), nil, http.StatusBadRequest)
+		}
+		matched := false
+		for _, field := range fields {
+			if f, ok := u.fields[field]; ok && f.Dimension == unit.Dimension {
+				out[field] = unit.Symbol
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, models.NewAPIError(models.ErrorCodeValidationFailed,
+				fmt.Sprintf("unit '%s' does not apply to any of the requested fields", symbol), nil, http.StatusBadRequest)
+		}
+	}
+	return out, nil
+}
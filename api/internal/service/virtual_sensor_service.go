@@ -0,0 +1,384 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// virtualSensorDocumentKind is the settings document kind holding one virtual sensor.
+const virtualSensorDocumentKind = "virtual_sensor"
+
+// maxVirtualInputs bounds the inputs of a virtual sensor.
+const maxVirtualInputs = 10
+
+// maxExpressionLength bounds the length of a virtual sensor expression, in bytes.
+const maxExpressionLength = 1024
+
+// virtualNamePattern restricts the names of virtual sensors and the fields of their inputs, which are used in Flux
+// queries.
+var virtualNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// variableNamePattern is the syntax of the input names, the variables of the expression.
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// virtualSensorStore caches the virtual sensor definitions of every location, keyed by ID.
+type virtualSensorStore struct {
+	mu      sync.RWMutex
+	sensors map[string]models.VirtualSensor
+}
+
+// LoadVirtualSensors loads the virtual sensors stored in InfluxDB into memory. Call it once at startup.
+func (s *DataService) LoadVirtualSensors(ctx context.Context) error {
+	sensors := make(map[string]models.VirtualSensor)
+	if err := loadDocuments(ctx, s.repo, virtualSensorDocumentKind, sensors); err != nil {
+		return err
+	}
+
+	s.virtualSensors.mu.Lock()
+	s.virtualSensors.sensors = sensors
+	s.virtualSensors.mu.Unlock()
+	log.Printf("Loaded %d virtual sensors", len(sensors))
+	return nil
+}
+
+// ListVirtualSensors returns the virtual sensors of a location.
+func (s *DataService) ListVirtualSensors(locationID string) []models.VirtualSensor {
+	s.virtualSensors.mu.RLock()
+	defer s.virtualSensors.mu.RUnlock()
+
+	sensors := []models.VirtualSensor{}
+	for _, sensor := range s.virtualSensors.sensors {
+		if sensor.LocationID == locationID {
+			sensors = append(sensors, sensor)
+		}
+	}
+	sort.Slice(sensors, func(i, j int) bool { return sensors[i].Name < sensors[j].Name })
+	return sensors
+}
+
+// GetVirtualSensor returns a virtual sensor of a location.
+func (s *DataService) GetVirtualSensor(locationID, sensorID string) (models.VirtualSensor, error) {
+	s.virtualSensors.mu.RLock()
+	defer s.virtualSensors.mu.RUnlock()
+
+	sensor, ok := s.virtualSensors.sensors[sensorID]
+	if !ok || sensor.LocationID != locationID {
+		return models.VirtualSensor{}, virtualSensorNotFound(sensorID)
+	}
+	return sensor, nil
+}
+
+// CreateVirtualSensor validates and stores a new virtual sensor for a location.
+func (s *DataService) CreateVirtualSensor(ctx context.Context, locationID string, sensor models.VirtualSensor) (models.VirtualSensor, error) {
+	sensor.ID = newID()
+	sensor.LocationID = locationID
+	if err := s.validateVirtualSensor(sensor); err != nil {
+		return models.VirtualSensor{}, err
+	}
+	if err := s.saveVirtualSensor(ctx, sensor); err != nil {
+		return models.VirtualSensor{}, err
+	}
+	return sensor, nil
+}
+
+// UpdateVirtualSensor replaces a virtual sensor of a location.
+func (s *DataService) UpdateVirtualSensor(ctx context.Context, locationID, sensorID string, sensor models.VirtualSensor) (models.VirtualSensor, error) {
+	if _, err := s.GetVirtualSensor(locationID, sensorID); err != nil {
+		return models.VirtualSensor{}, err
+	}
+	sensor.ID = sensorID
+	sensor.LocationID = locationID
+	if err := s.validateVirtualSensor(sensor); err != nil {
+		return models.VirtualSensor{}, err
+	}
+	if err := s.saveVirtualSensor(ctx, sensor); err != nil {
+		return models.VirtualSensor{}, err
+	}
+	return sensor, nil
+}
+
+// DeleteVirtualSensor removes a virtual sensor of a location.
+func (s *DataService) DeleteVirtualSensor(ctx context.Context, locationID, sensorID string) error {
+	if _, err := s.GetVirtualSensor(locationID, sensorID); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteDocument(ctx, virtualSensorDocumentKind, sensorID); err != nil {
+		return fmt.Errorf("error deleting virtual sensor: %w", err)
+	}
+
+	s.virtualSensors.mu.Lock()
+	delete(s.virtualSensors.sensors, sensorID)
+	s.virtualSensors.mu.Unlock()
+	return nil
+}
+
+func (s *DataService) saveVirtualSensor(ctx context.Context, sensor models.VirtualSensor) error {
+	if err := saveDocument(ctx, s.repo, virtualSensorDocumentKind, sensor.ID, sensor); err != nil {
+		return err
+	}
+
+	s.virtualSensors.mu.Lock()
+	if s.virtualSensors.sensors == nil {
+		s.virtualSensors.sensors = make(map[string]models.VirtualSensor)
+	}
+	s.virtualSensors.sensors[sensor.ID] = sensor
+	s.virtualSensors.mu.Unlock()
+	return nil
+}
+
+// validateVirtualSensor checks a virtual sensor definition. Its name must be unique in the location and must not hide
+// a stored field with a unit definition.
+func (s *DataService) validateVirtualSensor(sensor models.VirtualSensor) error {
+	invalid := func(message string) error {
+		return models.NewAPIError(models.ErrorCodeValidationFailed, message, nil, http.StatusBadRequest)
+	}
+
+	if !virtualNamePattern.MatchString(sensor.Name) {
+		return invalid("name is required and may only contain letters, digits, '_', '.' and '-'")
+	}
+	if s.units.CanonicalUnit(sensor.Name) != "" {
+		return invalid(fmt.Sprintf("name '%s' is a stored field", sensor.Name))
+	}
+	for _, other := range s.ListVirtualSensors(sensor.LocationID) {
+		if other.Name == sensor.Name && other.ID != sensor.ID {
+			return invalid(fmt.Sprintf("the location already has a virtual sensor named '%s'", sensor.Name))
+		}
+	}
+	if len(sensor.Inputs) == 0 || len(sensor.Inputs) > maxVirtualInputs {
+		return invalid(fmt.Sprintf("between 1 and %d inputs are required", maxVirtualInputs))
+	}
+
+	variables := make(map[string]bool, len(sensor.Inputs))
+	for _, input := range sensor.Inputs {
+		if !variableNamePattern.MatchString(input.Name) {
+			return invalid(fmt.Sprintf("input name '%s' must start with a letter or '_' and contain only letters, digits and '_'", input.Name))
+		}
+		if _, ok := expressionFunctions[input.Name]; ok {
+			return invalid(fmt.Sprintf("input name '%s' is a function", input.Name))
+		}
+		if _, ok := expressionConstants[input.Name]; ok {
+			return invalid(fmt.Sprintf("input name '%s' is a constant", input.Name))
+		}
+		if variables[input.Name] {
+			return invalid(fmt.Sprintf("duplicate input name '%s'", input.Name))
+		}
+		if !virtualNamePattern.MatchString(input.Field) {
+			return invalid(fmt.Sprintf("input '%s' needs a field made of letters, digits, '_', '.' and '-'", input.Name))
+		}
+		variables[input.Name] = true
+	}
+	if sensor.Expression == "" {
+		return invalid("expression is required")
+	}
+	if len(sensor.Expression) > maxExpressionLength {
+		return invalid(fmt.Sprintf("expression must not exceed %d characters", maxExpressionLength))
+	}
+	_, err := compileExpression(sensor.Expression, variables)
+	return err
+}
+
+func virtualSensorNotFound(sensorID string) error {
+	return models.NewAPIError(models.ErrorCodeResourceNotFound, fmt.Sprintf("virtual sensor '%s' not found", sensorID), nil, http.StatusNotFound)
+}
+
+// splitVirtualSensors separates the requested sensor types into the virtual sensors of the location and the stored
+// fields, keeping the request order.
+func (s *DataService) splitVirtualSensors(locationID string, sensorTypes []string) ([]models.VirtualSensor, []string) {
+	byName := make(map[string]models.VirtualSensor)
+	for _, sensor := range s.ListVirtualSensors(locationID) {
+		byName[sensor.Name] = sensor
+	}
+
+	var virtual []models.VirtualSensor
+	var stored []string
+	for _, sensorType := range sensorTypes {
+		if sensor, ok := byName[sensorType]; ok {
+			virtual = append(virtual, sensor)
+		} else {
+			stored = append(stored, sensorType)
+		}
+	}
+	return virtual, stored
+}
+
+// virtualSensorUnits returns the result unit of the virtual sensors that declare one.
+func virtualSensorUnits(sensors []models.VirtualSensor) map[string]string {
+	units := make(map[string]string)
+	for _, sensor := range sensors {
+		if sensor.Unit != "" {
+			units[sensor.Name] = sensor.Unit
+		}
+	}
+	return units
+}
+
+// virtualSensorInputs returns the devices and fields to query to evaluate the virtual sensors on the queried devices.
+func virtualSensorInputs(sensors []models.VirtualSensor, deviceIDs []string) ([]string, []string) {
+	devices := make(map[string]bool)
+	fields := make(map[string]bool)
+	for _, deviceID := range deviceIDs {
+		for _, sensor := range sensors {
+			if sensor.DeviceID != "" && sensor.DeviceID != deviceID {
+				continue
+			}
+			for _, input := range sensor.Inputs {
+				if input.DeviceID != "" {
+					devices[input.DeviceID] = true
+				} else {
+					devices[deviceID] = true
+				}
+				fields[input.Field] = true
+			}
+		}
+	}
+	return sortedKeys(devices), sortedKeys(fields)
+}
+
+// VirtualSensorInputDevices returns the devices read by the virtual sensors among sensorTypes when they are queried on
+// deviceIDs, other than deviceIDs themselves. Their rights are checked besides the ones of the queried devices.
+func (s *DataService) VirtualSensorInputDevices(locationID string, sensorTypes, deviceIDs []string) []string {
+	virtual, _ := s.splitVirtualSensors(locationID, sensorTypes)
+	if len(virtual) == 0 {
+		return nil
+	}
+	queried := make(map[string]bool, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		queried[deviceID] = true
+	}
+	inputDevices, _ := virtualSensorInputs(virtual, deviceIDs)
+	var others []string
+	for _, deviceID := range inputDevices {
+		if !queried[deviceID] {
+			others = append(others, deviceID)
+		}
+	}
+	return others
+}
+
+// queryVirtualSensors evaluates the virtual sensors on the queried devices and adds their readings to data. The inputs
+// are read in one query with the window and timezone of the request, so that their windows share the same times;
+// a window is null unless every input has a value in it.
+func (s *DataService) queryVirtualSensors(req models.QueryRequest, sensors []models.VirtualSensor, data []models.SensorQueryResponse) ([]models.SensorQueryResponse, error) {
+	expressions := make([]expression, len(sensors))
+	for i, sensor := range sensors {
+		variables := make(map[string]bool, len(sensor.Inputs))
+		for _, input := range sensor.Inputs {
+			variables[input.Name] = true
+		}
+		expr, err := compileExpression(sensor.Expression, variables)
+		if err != nil {
+			return nil, fmt.Errorf("virtual sensor '%s': %w", sensor.Name, err)
+		}
+		expressions[i] = expr
+	}
+
+	inputReq := req
+	inputReq.DeviceIDs, inputReq.SensorType = virtualSensorInputs(sensors, req.DeviceIDs)
+	inputReq.SkipEmpty = false
+	if len(inputReq.DeviceIDs) == 0 {
+		return data, nil
+	}
+	results, err := s.repo.Query(inputReq)
+	if err != nil {
+		return nil, fmt.Errorf("error querying virtual sensor inputs: %w", err)
+	}
+	// inputs[deviceID][field][time] is the value of a window, nil when empty
+	inputs := make(map[string]map[string]map[string]interface{})
+	for _, result := range results {
+		if inputs[result.DeviceID] == nil {
+			inputs[result.DeviceID] = make(map[string]map[string]interface{})
+		}
+		for field, points := range result.Readings {
+			if inputs[result.DeviceID][field] == nil {
+				inputs[result.DeviceID][field] = make(map[string]interface{}, len(points))
+			}
+			for _, point := range points {
+				raw, _ := point["time"].(string)
+				inputs[result.DeviceID][field][raw] = point["value"]
+			}
+		}
+	}
+
+	index := make(map[string]int, len(data))
+	for i := range data {
+		if _, ok := index[data[i].DeviceID]; !ok {
+			index[data[i].DeviceID] = i
+		}
+	}
+	for _, deviceID := range req.DeviceIDs {
+		for i, sensor := range sensors {
+			if sensor.DeviceID != "" && sensor.DeviceID != deviceID {
+				continue
+			}
+			points := evaluateVirtualSensor(sensor, expressions[i], deviceID, inputs, req.SkipEmpty)
+			if len(points) == 0 {
+				continue
+			}
+			k, ok := index[deviceID]
+			if !ok {
+				data = append(data, models.SensorQueryResponse{DeviceID: deviceID, Readings: make(map[string][]map[string]interface{})})
+				k = len(data) - 1
+				index[deviceID] = k
+			}
+			data[k].Readings[sensor.Name] = points
+		}
+	}
+
+	// Devices with only virtual readings keep the requested order
+	position := make(map[string]int, len(req.DeviceIDs))
+	for i, deviceID := range req.DeviceIDs {
+		position[deviceID] = i
+	}
+	sort.SliceStable(data, func(i, j int) bool { return position[data[i].DeviceID] < position[data[j].DeviceID] })
+	return data, nil
+}
+
+// evaluateVirtualSensor computes the windows of a virtual sensor on a device from the windows of its inputs.
+func evaluateVirtualSensor(sensor models.VirtualSensor, expr expression, deviceID string, inputs map[string]map[string]map[string]interface{}, skipEmpty bool) []map[string]interface{} {
+	series := make(map[string]map[string]interface{}, len(sensor.Inputs))
+	timeSet := make(map[string]bool)
+	for _, input := range sensor.Inputs {
+		inputDevice := input.DeviceID
+		if inputDevice == "" {
+			inputDevice = deviceID
+		}
+		series[input.Name] = inputs[inputDevice][input.Field]
+		for t := range series[input.Name] {
+			timeSet[t] = true
+		}
+	}
+	// The window times are RFC 3339 strings in UTC, their lexical order is chronological
+	times := sortedKeys(timeSet)
+
+	points := make([]map[string]interface{}, 0, len(times))
+	vars := make(map[string]float64, len(sensor.Inputs))
+	for _, t := range times {
+		var value interface{}
+		complete := true
+		for name, values := range series {
+			v, ok := values[t].(float64)
+			if !ok {
+				complete = false
+				break
+			}
+			vars[name] = v
+		}
+		if complete {
+			if v := expr(vars); !math.IsNaN(v) && !math.IsInf(v, 0) {
+				value = v
+			}
+		}
+		if value == nil && skipEmpty {
+			continue
+		}
+		points = append(points, map[string]interface{}{"time": t, "value": value})
+	}
+	return points
+}
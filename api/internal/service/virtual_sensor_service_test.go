@@ -0,0 +1,47 @@
+package service
+
+import (
+	"CapIot.influxDB/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestVirtualSensorInputDevices(t *testing.T) {
+	s := &DataService{}
+	s.virtualSensors.sensors = map[string]models.VirtualSensor{
+		"delta": {ID: "delta", Name: "delta_t", LocationID: "loc", Expression: "supply - return", Inputs: []models.VirtualInput{
+			{Name: "supply", Field: "temperature", DeviceID: "probe-supply"},
+			{Name: "return", Field: "temperature", DeviceID: "probe-return"},
+		}},
+		"local": {ID: "local", Name: "feels_like", LocationID: "loc", Expression: "t + h", Inputs: []models.VirtualInput{
+			{Name: "t", Field: "temperature"},
+			{Name: "h", Field: "humidity"},
+		}},
+		"pinned": {ID: "pinned", Name: "pump_power", LocationID: "loc", DeviceID: "pump", Expression: "p", Inputs: []models.VirtualInput{
+			{Name: "p", Field: "power", DeviceID: "meter"},
+		}},
+		"elsewhere": {ID: "elsewhere", Name: "delta_t", LocationID: "other", Expression: "x", Inputs: []models.VirtualInput{
+			{Name: "x", Field: "temperature", DeviceID: "foreign"},
+		}},
+	}
+	tests := []struct {
+		name        string
+		sensorTypes []string
+		deviceIDs   []string
+		want        []string
+	}{
+		{"stored fields only", []string{"temperature"}, []string{"dev"}, nil},
+		{"inputs on other devices", []string{"delta_t", "temperature"}, []string{"dev"}, []string{"probe-return", "probe-supply"}},
+		{"queried input device already checked", []string{"delta_t"}, []string{"probe-supply"}, []string{"probe-return"}},
+		{"inputs on the queried device", []string{"feels_like"}, []string{"dev"}, nil},
+		{"sensor of another device", []string{"pump_power"}, []string{"dev"}, nil},
+		{"sensor of the queried device", []string{"pump_power"}, []string{"pump"}, []string{"meter"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.VirtualSensorInputDevices("loc", tt.sensorTypes, tt.deviceIDs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VirtualSensorInputDevices = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}